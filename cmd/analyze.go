@@ -1,22 +1,172 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
 
+	"github.com/Drakmyth/wado/wad"
 	"github.com/spf13/cobra"
 )
 
+const (
+	FORMAT_TABLE = "table"
+	FORMAT_JSON  = "json"
+)
+
+var analyzeFormat string
+var analyzeReport string
+
 func init() {
 	rootCmd.AddCommand(analyzeCmd)
+	analyzeCmd.PersistentFlags().StringVarP(&analyzeFormat, "format", "f", FORMAT_TABLE, "Output format. One of: table, json.")
+	analyzeCmd.PersistentFlags().StringVarP(&analyzeReport, "report", "r", "",
+		`Also write a self-contained HTML report with
+charts and level maps to this file.`)
 }
 
 var analyzeCmd = &cobra.Command{
-	Use:   "analyze",
+	Use:   "analyze [flags] <input-wad-file>",
 	Short: "Analyze the difficulty of a WAD",
 	Long: `Analyzes each level in a WAD by looking at thing counts and
 calculates a estimated difficulty score along with other metrics. Optionally
 generates a graphical report.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("requires input file path")
+		}
+		if analyzeFormat != FORMAT_TABLE && analyzeFormat != FORMAT_JSON {
+			return fmt.Errorf("unknown format: %s", analyzeFormat)
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Print("This function is not yet implemented.")
+		wf, err := wad.OpenFile(args[0])
+		if err != nil {
+			panic(err)
+		}
+		printWarnings(args[0], wf)
+
+		analysis := analyze(args[0], wf)
+
+		if analyzeFormat == FORMAT_JSON {
+			err = printAnalysisJson(analysis)
+		} else {
+			err = printAnalysisTable(analysis)
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		if analyzeReport != "" {
+			err = writeReport(analyzeReport, wf, analysis)
+			if err != nil {
+				panic(err)
+			}
+		}
 	},
 }
+
+type wadAnalysis struct {
+	File          string             `json:"file"`
+	Levels        []levelAnalysis    `json:"levels"`
+	AverageScores map[string]float64 `json:"averageScores"`
+}
+
+type levelAnalysis struct {
+	Slot   string          `json:"slot"`
+	Name   string          `json:"name"`
+	Skills []skillAnalysis `json:"skills"`
+}
+
+type skillAnalysis struct {
+	Skill         string  `json:"skill"`
+	Monsters      int     `json:"monsters"`
+	MonsterHealth int     `json:"monsterHealth"`
+	Bullets       int     `json:"bullets"`
+	Shells        int     `json:"shells"`
+	Rockets       int     `json:"rockets"`
+	Cells         int     `json:"cells"`
+	Health        int     `json:"health"`
+	Armor         int     `json:"armor"`
+	Score         float64 `json:"score"`
+}
+
+func analyze(in_filepath string, wf *wad.WadFile) wadAnalysis {
+	analysis := wadAnalysis{
+		File:          in_filepath,
+		Levels:        make([]levelAnalysis, 0, len(wf.Levels)),
+		AverageScores: map[string]float64{},
+	}
+
+	for _, level := range wf.Levels {
+		la := levelAnalysis{
+			Slot:   level.Slot,
+			Name:   level.LevelInfo.Name,
+			Skills: make([]skillAnalysis, 0, len(wad.SKILLS)),
+		}
+
+		for _, skill := range wad.SKILLS {
+			stats := level.Analyze(skill)
+			la.Skills = append(la.Skills, skillAnalysis{
+				Skill:         skill.String(),
+				Monsters:      stats.Monsters,
+				MonsterHealth: stats.MonsterHealth,
+				Bullets:       stats.Ammo.Bullets,
+				Shells:        stats.Ammo.Shells,
+				Rockets:       stats.Ammo.Rockets,
+				Cells:         stats.Ammo.Cells,
+				Health:        stats.Health,
+				Armor:         stats.Armor,
+				Score:         roundScore(stats.Score),
+			})
+			analysis.AverageScores[skill.String()] += stats.Score
+		}
+
+		analysis.Levels = append(analysis.Levels, la)
+	}
+
+	for skill, total := range analysis.AverageScores {
+		analysis.AverageScores[skill] = roundScore(total / float64(len(analysis.Levels)))
+	}
+
+	return analysis
+}
+
+func roundScore(score float64) float64 {
+	return math.Round(score*100) / 100
+}
+
+func printAnalysisJson(analysis wadAnalysis) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(analysis)
+}
+
+func printAnalysisTable(analysis wadAnalysis) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Level\tName\tSkill\tMonsters\tMonster HP\tBullets\tShells\tRockets\tCells\tHealth\tArmor\tScore\t")
+
+	for _, level := range analysis.Levels {
+		for _, skill := range level.Skills {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%.2f\t\n",
+				level.Slot, level.Name, skill.Skill, skill.Monsters, skill.MonsterHealth,
+				skill.Bullets, skill.Shells, skill.Rockets, skill.Cells, skill.Health, skill.Armor, skill.Score)
+		}
+	}
+
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	for _, skill := range wad.SKILLS {
+		fmt.Printf("Average %s score: %.2f\n", skill, analysis.AverageScores[skill.String()])
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+var flagCompressBlockmap bool
+var flagZeroReject bool
+var flagBuildNodesSave saveFlags
+
+func init() {
+	rootCmd.AddCommand(buildNodesCmd)
+	buildNodesCmd.PersistentFlags().BoolVarP(&flagCompressBlockmap, "compress-blockmap", "c", true,
+		`Share identical blocklists in the BLOCKMAP to
+keep it small.`)
+	buildNodesCmd.PersistentFlags().BoolVarP(&flagZeroReject, "zero-reject", "z", false,
+		`Write a zero-filled REJECT table instead of
+rejecting sectors that can't see each other.`)
+	addSaveFlags(buildNodesCmd, &flagBuildNodesSave)
+}
+
+var buildNodesCmd = &cobra.Command{
+	Use:   "build-nodes [flags] <input-wad-file> <output-wad-file>",
+	Short: "Rebuild the BSP nodes of every level in a WAD",
+	Long: `Rebuilds the NODES, SEGS, SSECTORS, BLOCKMAP and
+REJECT lumps of every level from its linedefs,
+sidedefs, vertexes and sectors. Use this after
+changing level geometry so vanilla engines can
+still load the level. The REJECT table only
+rejects sectors that aren't connected to each
+other at all. UDMF levels are skipped, since
+their nodes come from a ZDoom node builder.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("requires input file path and output file path")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := buildNodes(args[0], args[1])
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+func buildNodes(in_filepath string, out_filepath string) error {
+	err := flagBuildNodesSave.validate()
+	if err != nil {
+		return err
+	}
+
+	wf, err := wad.OpenFile(in_filepath)
+	if err != nil {
+		return err
+	}
+	printWarnings(in_filepath, wf)
+
+	err = rebuildLevels(wf.Levels, flagCompressBlockmap, flagZeroReject)
+	if err != nil {
+		return err
+	}
+
+	return saveWad(wf, out_filepath, flagBuildNodesSave)
+}
+
+// Rebuilds the nodes, BLOCKMAP and REJECT of every level that isn't UDMF
+func rebuildLevels(levels []wad.Level, compressBlockmap bool, zeroReject bool) error {
+	for i := range levels {
+		if levels[i].Format == wad.LEVEL_FORMAT_UDMF {
+			fmt.Printf("Skipped %s, wado can't build nodes for UDMF levels\n", levels[i].Slot)
+			continue
+		}
+
+		err := levels[i].BuildNodes()
+		if err != nil {
+			return err
+		}
+
+		err = levels[i].BuildBlockmap(compressBlockmap)
+		if err != nil {
+			return err
+		}
+
+		levels[i].BuildReject(zeroReject)
+		fmt.Printf("Built nodes for %s\n", levels[i].Slot)
+	}
+
+	return nil
+}
@@ -3,9 +3,7 @@
 import (
 	"errors"
 	"fmt"
-	"io"
 	"math/rand/v2"
-	"os"
 	"regexp"
 	"slices"
 	"strconv"
@@ -56,6 +54,7 @@
 	"SKINTEK2": "SKSPINE1",
 	"SKULWAL3": "SKSPINE1",
 	"SKULWALL": "SKSPINE1",
+	"SKY4":     "SKY3",
 	"SLADRIP1": "SLADWALL",
 	"SLADRIP2": "SLADWALL",
 	"SLADRIP3": "SLADWALL",
@@ -86,11 +85,22 @@
 	"DEMO3":    "DEMO3_D",
 }
 
+// Full-screen pictures in the Doom 2 IWAD that an ending can show
+var DOOM2_END_PICS = []string{"CREDIT", "HELP", "TITLEPIC", "INTERPIC", "BOSSBACK"}
+
+// Pictures the bunny scroller ending needs, which only Doom has
+var BUNNY_END_PICS = []string{"PFUB1", "PFUB2"}
+
 var D2_REPLACEMENT_CANDIDATES = []int16{wad.ENEMY_SHOTGUN, wad.ENEMY_IMP, wad.ENEMY_PINKY, wad.ENEMY_BARON, wad.ENEMY_PISTOL, wad.ENEMY_CACO, wad.ENEMY_SOUL}
 
 var convertSeed uint64
 var flagUpdateThings bool
 var flagUpdateSidedefs bool
+var flagConvertBuildNodes bool
+var flagConvertMapInfo []string
+var flagConvertIWad string
+var flagConvertDoomIWad string
+var flagConvertSave saveFlags
 
 func init() {
 	rootCmd.AddCommand(convertCmd)
@@ -102,15 +112,30 @@ func init() {
 	convertCmd.PersistentFlags().BoolVarP(&flagUpdateSidedefs, "textures", "t", false,
 		`Replace textures that don't exist in Doom 2 with
 similar ones.`)
+	convertCmd.PersistentFlags().BoolVarP(&flagConvertBuildNodes, "build-nodes", "n", false,
+		`Rebuild the BSP nodes, BLOCKMAP and REJECT of
+every converted level.`)
+	convertCmd.PersistentFlags().StringVar(&flagConvertIWad, "iwad", "",
+		`Doom 2 IWAD to check the converted textures and
+flats against. Ones that exist in neither it nor
+the WAD are listed for each level.`)
+	convertCmd.PersistentFlags().StringVar(&flagConvertDoomIWad, "doom-iwad", "",
+		`Doom IWAD to copy the textures and flats the
+levels use that Doom 2 doesn't have from, along
+with the textures' patches, instead of replacing
+them with similar ones. Requires --iwad.`)
+	convertCmd.PersistentFlags().StringSliceVarP(&flagConvertMapInfo, "mapinfo", "m", mapInfoFlag(wad.DEFAULT_MAPINFO_FORMATS...), MAPINFO_FLAG_USAGE)
+	addSaveFlags(convertCmd, &flagConvertSave)
 }
 
 var convertCmd = &cobra.Command{
 	Use:   "convert [flags] <input-wad-file> <output-wad-file>",
 	Short: "Convert a WAD from Doom to Doom 2",
 	Long: `Converts Doom WADs to Doom 2 WADs by updating map
-ids and optionally replacing textures. Can also
-replace a few enemies with some Doom 2 things to
-make it a little spicier!`,
+ids and optionally replacing textures, or copying
+them from the Doom IWAD. Can also replace a few
+enemies with some Doom 2 things to make it a
+little spicier!`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 2 {
 			return errors.New("requires input file path and output file path")
@@ -130,19 +155,48 @@ func init() {
 }
 
 func convert(in_filepath string, out_filepath string) error {
-	// Copy to output file so we don't have to worry about messing up the format or the source file
-	err := copyFile(in_filepath, out_filepath)
+	mapInfoFormats, err := parseMapInfoFormats(flagConvertMapInfo)
 	if err != nil {
 		return err
 	}
 
-	// Open file
-	wf, err := wad.OpenFile(out_filepath)
+	err = flagConvertSave.validate()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Seed: %d", convertSeed)
+	if flagConvertDoomIWad != "" && flagConvertIWad == "" {
+		return errors.New("--doom-iwad requires --iwad, since the copied textures are added to the Doom 2 PNAMES")
+	}
+
+	// Open file. The source file is left alone, since the changes are saved to the output file.
+	wf, err := wad.OpenFile(in_filepath)
+	if err != nil {
+		return err
+	}
+	printWarnings(in_filepath, wf)
+	wf.MapInfoFormats = mapInfoFormats
+
+	var iwad *wad.WadFile
+	if flagConvertIWad != "" {
+		iwad, err = wad.OpenFileLazy(flagConvertIWad)
+		if err != nil {
+			return err
+		}
+		printWarnings(flagConvertIWad, iwad)
+		defer iwad.Close()
+	}
+
+	// Copied textures are kept as they are rather than replaced
+	copiedTextures := wad.TextureSet{}
+	if flagConvertDoomIWad != "" {
+		copiedTextures, err = copyDoomTextures(wf, iwad, flagConvertDoomIWad)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Seed: %d\n", convertSeed)
 	rng := rand.New(rand.NewPCG(convertSeed, convertSeed))
 
 	// For each lump...
@@ -155,30 +209,38 @@ func convert(in_filepath string, out_filepath string) error {
 	}
 
 	// For each level...
-	levelNameRegexp := regexp.MustCompile(`^E(\d)M(\d)$`)
 	for i, level := range wf.Levels {
 		// Skip non-Doom1 levels
 		if !level.IsLevelFromGame(wad.GAME_DOOM) {
 			continue
 		}
 
-		// Get episode number
-		parts := levelNameRegexp.FindStringSubmatch(level.Slot)
-		episodeNumber, err := strconv.Atoi(parts[1])
+		// Convert map slot from ExMy to MAPxx
+		newSlot, err := doom2Slot(level.Slot)
 		if err != nil {
 			return err
 		}
+		wf.Levels[i].Slot = newSlot
 
-		// Get mission number
-		missionNumber, err := strconv.Atoi(parts[2])
-		if err != nil {
-			return err
+		// Point exits at the converted slots too
+		levelInfo := &wf.Levels[i].LevelInfo
+		if wad.IsLevelSlotFromGame(levelInfo.Next, wad.GAME_DOOM) {
+			levelInfo.Next, err = doom2Slot(levelInfo.Next)
+			if err != nil {
+				return err
+			}
+		}
+		if wad.IsLevelSlotFromGame(levelInfo.NextSecret, wad.GAME_DOOM) {
+			levelInfo.NextSecret, err = doom2Slot(levelInfo.NextSecret)
+			if err != nil {
+				return err
+			}
 		}
 
-		// Convert map slot from ExMy to MAPxx
-		mapNumber := ((episodeNumber - 1) * 9) + missionNumber
-		newSlot := fmt.Sprintf("MAP%02d", mapNumber)
-		wf.Levels[i].Slot = newSlot
+		updateEnding(levelInfo, wf.Lumps)
+
+		// Keep the episode's sky, since Doom 2 picks one from the map number
+		levelInfo.SkyTexture = getNewTexName(doomSky(level), copiedTextures)
 
 		// Replace things
 		if flagUpdateThings {
@@ -187,33 +249,70 @@ func convert(in_filepath string, out_filepath string) error {
 
 		// Fix textures
 		if flagUpdateSidedefs {
-			updateSidedefs(&wf.Levels[i])
+			updateSidedefs(&wf.Levels[i], copiedTextures)
 		}
+
+		// Rebuild nodes
+		if flagConvertBuildNodes {
+			err = rebuildLevels(wf.Levels[i:i+1], true, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if iwad != nil {
+		textures, err := availableTextures(iwad, wf)
+		if err != nil {
+			return err
+		}
+		printMissingTextures(wf.Levels, textures, availableFlats(iwad, wf))
 	}
 
-	return wf.Save()
+	return saveWad(wf, out_filepath, flagConvertSave)
 }
 
-func copyFile(srcPath string, destPath string) error {
-	srcFile, err := os.Open(srcPath)
+// Maps a Doom 1 ExMy slot to the MAPxx slot it's converted to
+func doom2Slot(doom1Slot string) (string, error) {
+	levelNameRegexp := regexp.MustCompile(`^E(\d)M(\d)$`)
+	parts := levelNameRegexp.FindStringSubmatch(doom1Slot)
+
+	// Get episode number
+	episodeNumber, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer srcFile.Close()
 
-	destFile, err := os.Create(destPath)
+	// Get mission number
+	missionNumber, err := strconv.Atoi(parts[2])
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, srcFile)
-	if err != nil {
-		return err
+	mapNumber := ((episodeNumber - 1) * 9) + missionNumber
+	return fmt.Sprintf("MAP%02d", mapNumber), nil
+}
+
+// Endings that show pictures Doom 2 doesn't have, and the WAD doesn't bring, show the cast
+// instead
+func updateEnding(levelInfo *wad.LevelInfo, lumps []wad.Lump) {
+	pics := []string{}
+	switch {
+	case levelInfo.EndBunny:
+		pics = BUNNY_END_PICS
+	case levelInfo.EndPic != "":
+		pics = []string{levelInfo.EndPic}
 	}
 
-	err = destFile.Sync()
-	return err
+	for _, pic := range pics {
+		hasPic := slices.Contains(DOOM2_END_PICS, pic) || slices.ContainsFunc(lumps, func(lump wad.Lump) bool {
+			return lump.Name == pic
+		})
+		if !hasPic {
+			levelInfo.EndPic, levelInfo.EndBunny, levelInfo.EndCast = "", false, true
+			return
+		}
+	}
 }
 
 func updateThings(level *wad.Level, rng *rand.Rand) {
@@ -262,16 +361,16 @@ func updateThings(level *wad.Level, rng *rand.Rand) {
 	}, rng)
 }
 
-func updateSidedefs(level *wad.Level) {
+func updateSidedefs(level *wad.Level, copied wad.TextureSet) {
 	// Update texture names in sidedefs
 	for i, sidedef := range level.Sidedefs {
 		if shouldShiftTex(sidedef) {
 			sidedef.XOffset += 32
 		}
 
-		sidedef.UpperTex = getNewTexName(sidedef.UpperTex)
-		sidedef.MiddleTex = getNewTexName(sidedef.MiddleTex)
-		sidedef.LowerTex = getNewTexName(sidedef.LowerTex)
+		sidedef.UpperTex = getNewTexName(sidedef.UpperTex, copied)
+		sidedef.MiddleTex = getNewTexName(sidedef.MiddleTex, copied)
+		sidedef.LowerTex = getNewTexName(sidedef.LowerTex, copied)
 		level.Sidedefs[i] = sidedef
 	}
 }
@@ -282,11 +381,69 @@ func shouldShiftTex(sidedef wad.Sidedef) bool {
 	})
 }
 
-func getNewTexName(oldName string) string {
+func getNewTexName(oldName string, copied wad.TextureSet) string {
 	newName, replaced := TEXTURE_REPLACEMENTS[oldName]
-	if !replaced {
+	if !replaced || copied.Contains(oldName) {
 		newName = oldName
 	}
 
 	return newName
 }
+
+// The sky a Doom level shows, which is its episode's unless the level info gives one
+func doomSky(level wad.Level) string {
+	if level.LevelInfo.SkyTexture != "" {
+		return level.LevelInfo.SkyTexture
+	}
+	return "SKY" + level.Slot[1:2]
+}
+
+// Copies the textures, skies and flats the Doom levels use that neither Doom 2 nor the WAD has
+// from the Doom IWAD
+func copyDoomTextures(wf *wad.WadFile, iwad *wad.WadFile, doomIWad_filepath string) (wad.TextureSet, error) {
+	doomIWad, err := wad.OpenFileLazy(doomIWad_filepath)
+	if err != nil {
+		return nil, err
+	}
+	printWarnings(doomIWad_filepath, doomIWad)
+	defer doomIWad.Close()
+
+	textures, err := availableTextures(iwad, wf)
+	if err != nil {
+		return nil, err
+	}
+	flats := availableFlats(iwad, wf)
+
+	textureNames, flatNames := []string{}, []string{}
+	for _, level := range wf.Levels {
+		if !level.IsLevelFromGame(wad.GAME_DOOM) {
+			continue
+		}
+		for _, missing := range level.MissingTextures(textures) {
+			if !slices.Contains(textureNames, missing.Name) {
+				textureNames = append(textureNames, missing.Name)
+			}
+		}
+		if sky := doomSky(level); !textures.Contains(sky) && !slices.Contains(textureNames, sky) {
+			textureNames = append(textureNames, sky)
+		}
+		for _, missing := range level.MissingFlats(flats) {
+			if !slices.Contains(flatNames, missing.Name) {
+				flatNames = append(flatNames, missing.Name)
+			}
+		}
+	}
+
+	copiedTextures, err := wf.CopyTextures(textureNames, doomIWad, iwad)
+	if err != nil {
+		return nil, err
+	}
+	copiedFlats, err := wf.CopyFlats(flatNames, doomIWad)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Copied %d textures and %d flats from %s\n", len(copiedTextures), len(copiedFlats), doomIWad_filepath)
+
+	return wad.NewTextureSet(copiedTextures), nil
+}
@@ -0,0 +1,458 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+const (
+	DIFF_ADDED   = "added"
+	DIFF_REMOVED = "removed"
+	DIFF_CHANGED = "changed"
+)
+
+var flagDiffJson bool
+var flagDiffExitCode bool
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.PersistentFlags().BoolVar(&flagDiffJson, "json", false, "Print the differences as JSON.")
+	diffCmd.PersistentFlags().BoolVar(&flagDiffExitCode, "exit-code", false,
+		`Exit with status 1 when the WADs differ, for
+use in scripts.`)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [flags] <old-wad-file> <new-wad-file>",
+	Short: "Show what changed between two WADs",
+	Long: `Compares two WADs lump by lump and lists the
+lumps that were added, removed or changed. Levels
+are compared by slot, and levels left over on
+both sides are paired in order, so a level moved
+to another slot is still compared with itself.
+For each level, the lumps that changed are listed
+along with the LevelInfo fields, things, linedef
+specials and sidedef textures that changed.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("requires old and new file paths")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		diff, err := diffWads(args[0], args[1])
+		if err != nil {
+			panic(err)
+		}
+
+		if flagDiffJson {
+			err = printDiffJson(diff)
+		} else {
+			printDiffText(diff)
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		if flagDiffExitCode && diff.hasChanges() {
+			os.Exit(1)
+		}
+	},
+}
+
+type wadDiff struct {
+	Old    diffFile      `json:"old"`
+	New    diffFile      `json:"new"`
+	Lumps  []lumpChange  `json:"lumps"`
+	Levels []levelChange `json:"levels"`
+}
+
+type diffFile struct {
+	File       string `json:"file"`
+	Identifier string `json:"identifier"`
+}
+
+type lumpChange struct {
+	Name    string `json:"name"`
+	Change  string `json:"change"`
+	OldSize int    `json:"oldSize"`
+	NewSize int    `json:"newSize"`
+}
+
+type levelChange struct {
+	OldSlot   string          `json:"oldSlot,omitempty"`
+	NewSlot   string          `json:"newSlot,omitempty"`
+	Change    string          `json:"change"`
+	Lumps     []lumpChange    `json:"lumps,omitempty"`
+	LevelInfo []fieldChange   `json:"levelInfo,omitempty"`
+	Things    []elementChange `json:"things,omitempty"`
+	Linedefs  []elementChange `json:"linedefs,omitempty"`
+	Sidedefs  []elementChange `json:"sidedefs,omitempty"`
+}
+
+type fieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+type elementChange struct {
+	Index  int    `json:"index"`
+	Change string `json:"change"`
+	Old    any    `json:"old,omitempty"`
+	New    any    `json:"new,omitempty"`
+}
+
+// Only the parts of level elements the diff reports on, so other changes such as a linedef's
+// vertexes don't show up as changed specials
+type diffThing struct {
+	Type  int16 `json:"type"`
+	X     int16 `json:"x"`
+	Y     int16 `json:"y"`
+	Angle int16 `json:"angle"`
+	Flags int16 `json:"flags"`
+}
+
+type diffLinedef struct {
+	Special int16 `json:"special"`
+	Tag     int16 `json:"tag"`
+}
+
+type diffSidedef struct {
+	Upper  string `json:"upper"`
+	Lower  string `json:"lower"`
+	Middle string `json:"middle"`
+}
+
+func (t diffThing) String() string {
+	return fmt.Sprintf("type %d at (%d, %d) angle %d flags %d", t.Type, t.X, t.Y, t.Angle, t.Flags)
+}
+
+func (l diffLinedef) String() string {
+	return fmt.Sprintf("special %d tag %d", l.Special, l.Tag)
+}
+
+func (s diffSidedef) String() string {
+	return fmt.Sprintf("upper %s lower %s middle %s", s.Upper, s.Lower, s.Middle)
+}
+
+func (d wadDiff) hasChanges() bool {
+	return d.Old.Identifier != d.New.Identifier || len(d.Lumps) > 0 || len(d.Levels) > 0
+}
+
+func diffWads(old_filepath string, new_filepath string) (wadDiff, error) {
+	oldWad, oldGroups, err := openDiffWad(old_filepath)
+	if err != nil {
+		return wadDiff{}, err
+	}
+	defer oldWad.Close()
+
+	newWad, newGroups, err := openDiffWad(new_filepath)
+	if err != nil {
+		return wadDiff{}, err
+	}
+	defer newWad.Close()
+
+	diff := wadDiff{
+		Old:    diffFile{File: old_filepath, Identifier: oldWad.Identifier},
+		New:    diffFile{File: new_filepath, Identifier: newWad.Identifier},
+		Lumps:  diffLumps(oldGroups[""], newGroups[""]),
+		Levels: []levelChange{},
+	}
+
+	for _, pair := range pairLevels(oldWad.Levels, newWad.Levels) {
+		oldLevel, newLevel := pair[0], pair[1]
+		switch {
+		case oldLevel == nil:
+			diff.Levels = append(diff.Levels, levelChange{NewSlot: newLevel.Slot, Change: DIFF_ADDED})
+		case newLevel == nil:
+			diff.Levels = append(diff.Levels, levelChange{OldSlot: oldLevel.Slot, Change: DIFF_REMOVED})
+		default:
+			change := diffLevels(*oldLevel, *newLevel, oldGroups[oldLevel.Slot], newGroups[newLevel.Slot])
+			if oldLevel.Slot != newLevel.Slot || change.hasChanges() {
+				diff.Levels = append(diff.Levels, change)
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// Lumps are compared as Save would write them, without generating any metadata, so UMAPINFO
+// is compared through the LevelInfo it was read into
+func openDiffWad(in_filepath string) (*wad.WadFile, map[string][]wad.Lump, error) {
+	wf, err := wad.OpenFileLazy(in_filepath)
+	if err != nil {
+		return nil, nil, err
+	}
+	printWarnings(in_filepath, wf)
+
+	wf.MapInfoFormats = []wad.MapInfoFormat{}
+	groups, err := wf.LumpGroups()
+	if err != nil {
+		wf.Close()
+		return nil, nil, err
+	}
+
+	lumps := map[string][]wad.Lump{}
+	for _, group := range groups {
+		lumps[group.Level] = append(lumps[group.Level], group.Lumps...)
+	}
+	return wf, lumps, nil
+}
+
+// Lumps of the same name are paired in the order they appear in
+func diffLumps(oldLumps []wad.Lump, newLumps []wad.Lump) []lumpChange {
+	changes := []lumpChange{}
+
+	used := make([]bool, len(newLumps))
+	for _, oldLump := range oldLumps {
+		index := -1
+		for i, newLump := range newLumps {
+			if !used[i] && newLump.Name == oldLump.Name {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 {
+			changes = append(changes, lumpChange{Name: oldLump.Name, Change: DIFF_REMOVED, OldSize: len(oldLump.Data)})
+			continue
+		}
+
+		used[index] = true
+		if !bytes.Equal(oldLump.Data, newLumps[index].Data) {
+			changes = append(changes, lumpChange{Name: oldLump.Name, Change: DIFF_CHANGED, OldSize: len(oldLump.Data), NewSize: len(newLumps[index].Data)})
+		}
+	}
+
+	for i, newLump := range newLumps {
+		if !used[i] {
+			changes = append(changes, lumpChange{Name: newLump.Name, Change: DIFF_ADDED, NewSize: len(newLump.Data)})
+		}
+	}
+
+	return changes
+}
+
+// Pairs levels with the same slot, then pairs the levels left over on both sides in order
+func pairLevels(oldLevels []wad.Level, newLevels []wad.Level) [][2]*wad.Level {
+	pairs := [][2]*wad.Level{}
+	oldPaired := make([]bool, len(oldLevels))
+	newPaired := make([]bool, len(newLevels))
+
+	for i := range oldLevels {
+		for j := range newLevels {
+			if !newPaired[j] && oldLevels[i].Slot == newLevels[j].Slot {
+				pairs = append(pairs, [2]*wad.Level{&oldLevels[i], &newLevels[j]})
+				oldPaired[i], newPaired[j] = true, true
+				break
+			}
+		}
+	}
+
+	j := 0
+	for i := range oldLevels {
+		if oldPaired[i] {
+			continue
+		}
+		for j < len(newLevels) && newPaired[j] {
+			j++
+		}
+		if j < len(newLevels) {
+			pairs = append(pairs, [2]*wad.Level{&oldLevels[i], &newLevels[j]})
+			newPaired[j] = true
+		} else {
+			pairs = append(pairs, [2]*wad.Level{&oldLevels[i], nil})
+		}
+	}
+
+	for j := range newLevels {
+		if !newPaired[j] {
+			pairs = append(pairs, [2]*wad.Level{nil, &newLevels[j]})
+		}
+	}
+
+	return pairs
+}
+
+func diffLevels(oldLevel wad.Level, newLevel wad.Level, oldLumps []wad.Lump, newLumps []wad.Lump) levelChange {
+	change := levelChange{
+		OldSlot: oldLevel.Slot,
+		NewSlot: newLevel.Slot,
+		Change:  DIFF_CHANGED,
+	}
+
+	// The level's marker is named after its slot, which is already reported
+	change.Lumps = diffLumps(oldLumps[1:], newLumps[1:])
+	change.LevelInfo = diffLevelInfo(oldLevel.LevelInfo, newLevel.LevelInfo)
+
+	oldThings, oldLinedefs, oldSidedefs := levelElements(oldLevel)
+	newThings, newLinedefs, newSidedefs := levelElements(newLevel)
+
+	change.Things = diffElements(oldThings, newThings)
+	change.Linedefs = diffElements(oldLinedefs, newLinedefs)
+	change.Sidedefs = diffElements(oldSidedefs, newSidedefs)
+	return change
+}
+
+func (c levelChange) hasChanges() bool {
+	return len(c.Lumps) > 0 || len(c.LevelInfo) > 0 || len(c.Things) > 0 ||
+		len(c.Linedefs) > 0 || len(c.Sidedefs) > 0
+}
+
+// Levels are compared in Doom format, so a level whose format changed is still compared element
+// by element
+func levelElements(level wad.Level) ([]diffThing, []diffLinedef, []diffSidedef) {
+	things := []diffThing{}
+	for _, thing := range level.ThingsAsDoom() {
+		things = append(things, diffThing{Type: thing.Type, X: thing.X, Y: thing.Y, Angle: thing.Angle, Flags: thing.Flags})
+	}
+
+	linedefs := []diffLinedef{}
+	for _, linedef := range level.LinedefsAsDoom() {
+		linedefs = append(linedefs, diffLinedef{Special: linedef.SpecialType, Tag: linedef.Tag})
+	}
+
+	sidedefs := []diffSidedef{}
+	for _, sidedef := range level.SidedefsAsDoom() {
+		sidedefs = append(sidedefs, diffSidedef{Upper: sidedef.UpperTex, Lower: sidedef.LowerTex, Middle: sidedef.MiddleTex})
+	}
+
+	return things, linedefs, sidedefs
+}
+
+// Elements are compared by index, since that's how the rest of the level refers to them
+func diffElements[T comparable](oldElements []T, newElements []T) []elementChange {
+	changes := []elementChange{}
+	for i := 0; i < max(len(oldElements), len(newElements)); i++ {
+		switch {
+		case i >= len(oldElements):
+			changes = append(changes, elementChange{Index: i, Change: DIFF_ADDED, New: newElements[i]})
+		case i >= len(newElements):
+			changes = append(changes, elementChange{Index: i, Change: DIFF_REMOVED, Old: oldElements[i]})
+		case oldElements[i] != newElements[i]:
+			changes = append(changes, elementChange{Index: i, Change: DIFF_CHANGED, Old: oldElements[i], New: newElements[i]})
+		}
+	}
+	return changes
+}
+
+// Compares every LevelInfo field, so new fields are compared without changes here
+func diffLevelInfo(oldInfo wad.LevelInfo, newInfo wad.LevelInfo) []fieldChange {
+	changes := []fieldChange{}
+	oldValue, newValue := reflect.ValueOf(oldInfo), reflect.ValueOf(newInfo)
+	for i := 0; i < oldValue.NumField(); i++ {
+		oldField, newField := oldValue.Field(i), newValue.Field(i)
+		if reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			continue
+		}
+		if isEmptyField(oldField) && isEmptyField(newField) {
+			continue
+		}
+
+		changes = append(changes, fieldChange{
+			Field: oldValue.Type().Field(i).Name,
+			Old:   oldField.Interface(),
+			New:   newField.Interface(),
+		})
+	}
+	return changes
+}
+
+// A nil slice and an empty one mean the same to a LevelInfo
+func isEmptyField(field reflect.Value) bool {
+	return field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0)
+}
+
+func formatDiffValue(value any) string {
+	field := reflect.ValueOf(value)
+	switch {
+	case field.Kind() == reflect.Pointer && field.IsNil():
+		return "-"
+	case field.Kind() == reflect.Pointer:
+		return fmt.Sprintf("%v", field.Elem().Interface())
+	case field.Kind() == reflect.String:
+		return fmt.Sprintf("%q", value)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func printDiffJson(diff wadDiff) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diff)
+}
+
+func printDiffText(diff wadDiff) {
+	fmt.Printf("--- %s (%s)\n", diff.Old.File, diff.Old.Identifier)
+	fmt.Printf("+++ %s (%s)\n", diff.New.File, diff.New.Identifier)
+
+	if !diff.hasChanges() {
+		fmt.Println("No differences")
+		return
+	}
+
+	if len(diff.Lumps) > 0 {
+		fmt.Println("\nLumps")
+		printLumpChanges(diff.Lumps)
+	}
+
+	for _, level := range diff.Levels {
+		switch level.Change {
+		case DIFF_ADDED:
+			fmt.Printf("\n+ %s\n", level.NewSlot)
+			continue
+		case DIFF_REMOVED:
+			fmt.Printf("\n- %s\n", level.OldSlot)
+			continue
+		}
+
+		if level.OldSlot != level.NewSlot {
+			fmt.Printf("\n%s -> %s\n", level.OldSlot, level.NewSlot)
+		} else {
+			fmt.Printf("\n%s\n", level.NewSlot)
+		}
+
+		printLumpChanges(level.Lumps)
+		for _, field := range level.LevelInfo {
+			fmt.Printf("  ~ %s: %s -> %s\n", field.Field, formatDiffValue(field.Old), formatDiffValue(field.New))
+		}
+		printElementChanges("thing", level.Things)
+		printElementChanges("linedef", level.Linedefs)
+		printElementChanges("sidedef", level.Sidedefs)
+	}
+}
+
+func printLumpChanges(changes []lumpChange) {
+	for _, lump := range changes {
+		switch lump.Change {
+		case DIFF_ADDED:
+			fmt.Printf("  + %s (%d bytes)\n", lump.Name, lump.NewSize)
+		case DIFF_REMOVED:
+			fmt.Printf("  - %s (%d bytes)\n", lump.Name, lump.OldSize)
+		default:
+			fmt.Printf("  ~ %s (%d -> %d bytes)\n", lump.Name, lump.OldSize, lump.NewSize)
+		}
+	}
+}
+
+func printElementChanges(element string, changes []elementChange) {
+	for _, change := range changes {
+		switch change.Change {
+		case DIFF_ADDED:
+			fmt.Printf("  + %s %d: %v\n", element, change.Index, change.New)
+		case DIFF_REMOVED:
+			fmt.Printf("  - %s %d: %v\n", element, change.Index, change.Old)
+		default:
+			fmt.Printf("  ~ %s %d: %v -> %v\n", element, change.Index, change.Old, change.New)
+		}
+	}
+}
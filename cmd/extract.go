@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(extractCmd)
+}
+
+var extractCmd = &cobra.Command{
+	Use:   "extract <input-wad-file> <output-folder> [lump-or-level...]",
+	Short: "Extract lumps from a WAD to a folder",
+	Long: `Writes the lumps of a WAD to a folder as .lmp
+files, along with a manifest.json that records
+their order, which level they belong to and the
+markers between them. Level lumps go in a folder
+named after the level. Names of lumps or levels
+can be given to only extract those. The folder
+can be turned back into a WAD with pack.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("requires input file path and output folder path")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := extract(args[0], args[1], args[2:])
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+func extract(in_filepath string, out_folderpath string, names []string) error {
+	wf, err := wad.OpenFileLazy(in_filepath)
+	if err != nil {
+		return err
+	}
+	printWarnings(in_filepath, wf)
+	defer wf.Close()
+
+	// Lumps are extracted as they are in the file, in file order, so pack can rebuild it as it was
+	groups, err := wf.FileLumpGroups()
+	if err != nil {
+		return err
+	}
+
+	// Levels are only extracted whole, so their lumps are selected by the level's slot
+	selected := make([]wad.LumpGroup, 0, len(groups))
+	found := map[string]bool{}
+	for _, group := range groups {
+		groupName := group.Level
+		if groupName == "" {
+			groupName = group.Lumps[0].Name
+		}
+		if len(names) > 0 && !slices.ContainsFunc(names, func(name string) bool {
+			return strings.EqualFold(name, groupName)
+		}) {
+			continue
+		}
+		selected = append(selected, group)
+		found[strings.ToUpper(groupName)] = true
+	}
+
+	for _, name := range names {
+		if !found[strings.ToUpper(name)] {
+			return fmt.Errorf("no lump or level named %s", name)
+		}
+	}
+
+	manifest := lumpManifest{
+		Identifier: wf.Identifier,
+		Lumps:      []manifestLump{},
+	}
+	used := map[string]bool{}
+	for _, group := range selected {
+		for _, lump := range group.Lumps {
+			entry := manifestLump{Name: lump.Name, Level: group.Level}
+			if len(lump.Data) > 0 {
+				entry.File = lumpFilePath(group.Level, lump.Name, used)
+
+				lumpPath := filepath.Join(out_folderpath, filepath.FromSlash(entry.File))
+				err = os.MkdirAll(filepath.Dir(lumpPath), 0755)
+				if err != nil {
+					return err
+				}
+				err = os.WriteFile(lumpPath, lump.Data, 0644)
+				if err != nil {
+					return err
+				}
+			}
+			manifest.Lumps = append(manifest.Lumps, entry)
+		}
+	}
+
+	err = os.MkdirAll(out_folderpath, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = writeManifest(out_folderpath, manifest)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Extracted %d lumps to %s\n", len(manifest.Lumps), out_folderpath)
+	return nil
+}
@@ -13,6 +13,10 @@
 )
 
 var generateSeed uint64
+var flagGenerateBuildNodes bool
+var flagGenerateMapInfo []string
+var flagGenerateSkipConflicts bool
+var flagGenerateSave saveFlags
 
 func init() {
 	rootCmd.AddCommand(generateCmd)
@@ -20,6 +24,24 @@ func init() {
 		`Specify a seed value to influence randomization.
 The same seed will produce the same results every
 time.`)
+	generateCmd.PersistentFlags().BoolVarP(&flagGenerateBuildNodes, "build-nodes", "n", false,
+		`Rebuild the BSP nodes, BLOCKMAP and REJECT of
+every selected level.`)
+	generateCmd.PersistentFlags().StringSliceVarP(&flagGenerateMapInfo, "mapinfo", "m", mapInfoFlag(wad.MAPINFO_FORMAT_UMAPINFO, wad.MAPINFO_FORMAT_DEHACKED), MAPINFO_FLAG_USAGE)
+	generateCmd.PersistentFlags().BoolVar(&flagGenerateSkipConflicts, "skip-conflicts", false,
+		`Leave out levels whose DEHACKED patch conflicts
+with a patch from an already selected level,
+instead of failing.`)
+	addSaveFlags(generateCmd, &flagGenerateSave)
+}
+
+// A level's slot along with the WAD it came from and that WAD's DEHACKED patch, if it has one.
+// WADs are closed once they've been scanned, and only opened again for the selected levels.
+type generateCandidate struct {
+	Slot       string
+	Path       string
+	SecretExit bool
+	Patch      *wad.Dehacked
 }
 
 var generateCmd = &cobra.Command{
@@ -28,7 +50,16 @@ func init() {
 	Long: `Generates a new WAD by randomly selecting levels
 from WADs in the input folder. Will not perform
 any conversion on the levels, so ensure the folder
-only contains wads targetting the same game.`,
+only contains wads targetting the same game.
+
+DEHACKED patches from the selected levels' WADs
+are merged into the new WAD. Levels whose patch
+changes the same thing, frame, weapon, ammo or
+string as an already selected patch in a
+different way can't be combined, and are
+reported or left out. Level names, par times and
+intermission text in the patches are left out,
+since they belong to the levels' old slots.`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 2 {
 			return errors.New("requires input folder path and output file path")
@@ -48,10 +79,20 @@ func init() {
 }
 
 func generate(in_folderpath string, out_filepath string) error {
+	mapInfoFormats, err := parseMapInfoFormats(flagGenerateMapInfo)
+	if err != nil {
+		return err
+	}
+
+	err = flagGenerateSave.validate()
+	if err != nil {
+		return err
+	}
+
 	wadPaths := []string{}
 
 	// Find the wad files in the provided directory
-	err := filepath.WalkDir(in_folderpath, func(path string, d fs.DirEntry, err error) error {
+	err = filepath.WalkDir(in_folderpath, func(path string, d fs.DirEntry, err error) error {
 		if strings.HasSuffix(d.Name(), ".wad") {
 			wadPaths = append(wadPaths, path)
 		}
@@ -62,45 +103,76 @@ func generate(in_folderpath string, out_filepath string) error {
 	}
 
 	// Read all levels from inputs wads and bucket by existance of secret exits
-	levelsWithSecretExits := make([]wad.Level, 0, 9)
-	levels := make([]wad.Level, 0, 9)
+	levelsWithSecretExits := make([]generateCandidate, 0, 9)
+	levels := make([]generateCandidate, 0, 9)
 	for _, path := range wadPaths {
-		// Open file
-		wf, err := wad.OpenFile(path)
+		candidates, err := scanGenerateWad(path)
 		if err != nil {
 			return err
 		}
 
-		for _, level := range wf.Levels {
-			if level.HasSecretExit() {
-				levelsWithSecretExits = append(levelsWithSecretExits, level)
+		for _, candidate := range candidates {
+			if candidate.SecretExit {
+				levelsWithSecretExits = append(levelsWithSecretExits, candidate)
 			} else {
-				levels = append(levels, level)
+				levels = append(levels, candidate)
 			}
 		}
 	}
 
 	// Create output wad
-	wf, err := wad.CreateFile(out_filepath)
-	if err != nil {
-		return err
-	}
+	wf := wad.NewFile(out_filepath)
+	wf.MapInfoFormats = mapInfoFormats
 
-	fmt.Printf("Seed: %d", generateSeed)
+	fmt.Printf("Seed: %d\n", generateSeed)
 	rng := rand.New(rand.NewPCG(generateSeed, generateSeed))
 
+	patch := &wad.Dehacked{DoomVersion: wad.DEHACKED_DOOM_VERSION, PatchFormat: wad.DEHACKED_PATCH_FORMAT}
+	patchPaths := map[string]bool{}
+
 	// Ensure exactly one level prior to level 8 has a secret exit
 	secretExitLevelSlot := rng.IntN(7) + 1
 	for i := 1; i < 10; i++ {
-		var level wad.Level
+		var candidate generateCandidate
 
-		// Pull a random level
-		if i == secretExitLevelSlot {
-			level = levelsWithSecretExits[rng.IntN(len(levelsWithSecretExits))]
-		} else {
-			levelIndex := rng.IntN(len(levels))
-			level = levels[levelIndex]
-			levels = append(levels[:levelIndex], levels[levelIndex+1:]...)
+		// Pull a random level whose patch can be combined with the ones already selected
+		for {
+			pool := &levels
+			if i == secretExitLevelSlot {
+				pool = &levelsWithSecretExits
+			}
+			if len(*pool) == 0 {
+				return fmt.Errorf("not enough levels to fill MAP%02d", i)
+			}
+
+			levelIndex := rng.IntN(len(*pool))
+			candidate = (*pool)[levelIndex]
+
+			conflicts := []wad.DehackedConflict{}
+			if candidate.Patch != nil && !patchPaths[candidate.Path] {
+				conflicts = patch.Conflicts(*candidate.Patch)
+			}
+
+			if len(conflicts) == 0 || flagGenerateSkipConflicts {
+				*pool = append((*pool)[:levelIndex], (*pool)[levelIndex+1:]...)
+			}
+			if len(conflicts) == 0 {
+				break
+			}
+
+			if !flagGenerateSkipConflicts {
+				return fmt.Errorf("DEHACKED patch for %s in %s can't be combined with the other selected levels:\n%s", candidate.Slot, candidate.Path, formatConflicts(conflicts))
+			}
+			fmt.Printf("\nLeaving out %s from %s, its DEHACKED patch conflicts with the other selected levels:\n%s", candidate.Slot, candidate.Path, formatConflicts(conflicts))
+		}
+
+		if candidate.Patch != nil && !patchPaths[candidate.Path] {
+			patch.Merge(*candidate.Patch)
+			patchPaths[candidate.Path] = true
+		}
+		level, err := loadGenerateLevel(candidate)
+		if err != nil {
+			return fmt.Errorf("%s: %w", candidate.Path, err)
 		}
 
 		// Identify the level slot
@@ -120,10 +192,100 @@ func generate(in_folderpath string, out_filepath string) error {
 
 		level.LevelInfo.Next = next
 		level.LevelInfo.NextSecret = nextSecret
-		level.LevelInfo.EndGame = i == 8
+
+		// Only MAP08 ends the game, whatever the level did in its original WAD. The text of an
+		// ending the level had goes with it.
+		endGame := i == 8
+		if level.LevelInfo.EndGame && !endGame {
+			level.LevelInfo.InterText = nil
+			level.LevelInfo.InterBackdrop = ""
+		}
+		level.LevelInfo.EndGame = endGame
+		level.LevelInfo.EndCast = endGame
+		level.LevelInfo.NoIntermission = endGame
+		level.LevelInfo.EndBunny = false
+		level.LevelInfo.EndPic = ""
+		level.LevelInfo.Episode = nil
 
 		wf.Levels = append(wf.Levels, level)
 	}
 
-	return wf.Save()
+	if !patch.IsEmpty() {
+		wf.Lumps = append(wf.Lumps, wad.Lump{Name: wad.LUMP_DEHACKED, Data: patch.Bytes()})
+	}
+
+	if flagGenerateBuildNodes {
+		err = rebuildLevels(wf.Levels, true, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return saveWad(wf, out_filepath, flagGenerateSave)
+}
+
+// Lists the levels in a WAD as candidates, closing it again once they have been found
+func scanGenerateWad(path string) ([]generateCandidate, error) {
+	// Open file, leaving levels unparsed since few of them are selected
+	wf, err := wad.OpenFileLazy(path)
+	if err != nil {
+		return nil, err
+	}
+	printWarnings(path, wf)
+	defer wf.Close()
+
+	patch, err := findDehacked(wf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	candidates := make([]generateCandidate, len(wf.Levels))
+	for i, level := range wf.Levels {
+		candidates[i] = generateCandidate{Slot: level.Slot, Path: path, SecretExit: level.HasSecretExit(), Patch: patch}
+	}
+	return candidates, nil
+}
+
+// Opens the candidate's WAD again to read its level
+func loadGenerateLevel(candidate generateCandidate) (wad.Level, error) {
+	wf, err := wad.OpenFileLazy(candidate.Path)
+	if err != nil {
+		return wad.Level{}, err
+	}
+	defer wf.Close()
+
+	for _, level := range wf.Levels {
+		if level.Slot == candidate.Slot {
+			err = level.Load()
+			return level, err
+		}
+	}
+	return wad.Level{}, fmt.Errorf("%s is no longer in the file", candidate.Slot)
+}
+
+// The WAD's DEHACKED patch without its level strings, which are generated for the new slots
+func findDehacked(wf *wad.WadFile) (*wad.Dehacked, error) {
+	for _, lump := range wf.Lumps {
+		if lump.Name == wad.LUMP_DEHACKED {
+			err := lump.Load()
+			if err != nil {
+				return nil, err
+			}
+			patch, err := wad.ParseDehacked(lump.Data)
+			if err != nil {
+				return nil, err
+			}
+			stripped := patch.WithoutLevelStrings()
+			return &stripped, nil
+		}
+	}
+	return nil, nil
+}
+
+func formatConflicts(conflicts []wad.DehackedConflict) string {
+	builder := strings.Builder{}
+	for _, conflict := range conflicts {
+		builder.WriteString(fmt.Sprintf("  %s\n", conflict))
+	}
+	return builder.String()
 }
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"text/tabwriter"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+var flagInfoJson bool
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+	infoCmd.PersistentFlags().BoolVar(&flagInfoJson, "json", false, "Print the information as JSON.")
+}
+
+var infoCmd = &cobra.Command{
+	Use:     "info [flags] <input-wad-file>",
+	Aliases: []string{"ls"},
+	Short:   "Show what wado finds inside a WAD",
+	Long: `Prints the header identifier and lump directory
+of a WAD, followed by the levels wado detects in
+it with their format, thing, linedef and sidedef
+counts, whether they have a secret exit and the
+LevelInfo read for them. Levels that can't be
+parsed are listed with the error instead.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("requires input file path")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		info, err := wadInfo(args[0])
+		if err != nil {
+			panic(err)
+		}
+
+		if flagInfoJson {
+			err = printInfoJson(info)
+		} else {
+			err = printInfoTable(info)
+		}
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+type fileInfo struct {
+	File       string      `json:"file"`
+	Identifier string      `json:"identifier"`
+	Lumps      []lumpInfo  `json:"lumps"`
+	Levels     []levelInfo `json:"levels"`
+}
+
+type lumpInfo struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"`
+	Size   int    `json:"size"`
+}
+
+type levelInfo struct {
+	Slot       string         `json:"slot"`
+	Format     string         `json:"format"`
+	Things     int            `json:"things"`
+	Linedefs   int            `json:"linedefs"`
+	Sidedefs   int            `json:"sidedefs"`
+	SecretExit bool           `json:"secretExit"`
+	LevelInfo  *wad.LevelInfo `json:"levelInfo,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func wadInfo(in_filepath string) (fileInfo, error) {
+	wf, err := wad.OpenFileLazy(in_filepath)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	printWarnings(in_filepath, wf)
+	defer wf.Close()
+
+	info := fileInfo{
+		File:       in_filepath,
+		Identifier: wf.Identifier,
+		Lumps:      make([]lumpInfo, 0, len(wf.Directory)),
+		Levels:     make([]levelInfo, 0, len(wf.Levels)),
+	}
+
+	for _, entry := range wf.Directory {
+		info.Lumps = append(info.Lumps, lumpInfo{Name: entry.Name, Offset: entry.Offset, Size: entry.Size})
+	}
+
+	// Levels are loaded one at a time, so one that can't be parsed doesn't hide the others
+	for _, level := range wf.Levels {
+		li := levelInfo{
+			Slot:   level.Slot,
+			Format: level.Format.String(),
+		}
+
+		err = level.Load()
+		if err != nil {
+			li.Error = err.Error()
+			info.Levels = append(info.Levels, li)
+			continue
+		}
+
+		li.Things = len(level.ThingsAsDoom())
+		li.Linedefs = len(level.LinedefsAsDoom())
+		li.Sidedefs = len(level.SidedefsAsDoom())
+		li.SecretExit = level.HasSecretExit()
+		li.LevelInfo = &level.LevelInfo
+
+		info.Levels = append(info.Levels, li)
+	}
+
+	return info, nil
+}
+
+func printInfoJson(info fileInfo) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(info)
+}
+
+func printInfoTable(info fileInfo) error {
+	fmt.Printf("%s: %s, %d lumps, %d levels\n\n", info.File, info.Identifier, len(info.Lumps), len(info.Levels))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Lump\tName\tOffset\tSize\t")
+	for i, lump := range info.Lumps {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t\n", i, lump.Name, lump.Offset, lump.Size)
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if len(info.Levels) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Level\tFormat\tThings\tLinedefs\tSidedefs\tSecret Exit\t")
+	for _, level := range info.Levels {
+		if level.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\t\n", level.Slot, level.Format)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%t\t\n", level.Slot, level.Format, level.Things, level.Linedefs, level.Sidedefs, level.SecretExit)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	for _, level := range info.Levels {
+		fmt.Printf("\n%s\n", level.Slot)
+		if level.Error != "" {
+			fmt.Printf("  Error: %s\n", level.Error)
+			continue
+		}
+		printLevelInfoFields(*level.LevelInfo)
+	}
+
+	return nil
+}
+
+// Prints every LevelInfo field that's set, so new fields show up without changes here
+func printLevelInfoFields(levelInfo wad.LevelInfo) {
+	value := reflect.ValueOf(levelInfo)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0) {
+			continue
+		}
+
+		if field.Kind() == reflect.Pointer {
+			field = field.Elem()
+		}
+		fmt.Printf("  %s: %v\n", value.Type().Field(i).Name, field.Interface())
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const MANIFEST_FILENAME = "manifest.json"
+
+// Lumps of an extracted WAD in the order they're packed. Lumps with no data, such as markers,
+// have no file.
+type lumpManifest struct {
+	Identifier string         `json:"identifier"`
+	Lumps      []manifestLump `json:"lumps"`
+}
+
+type manifestLump struct {
+	Name  string `json:"name"`
+	Level string `json:"level,omitempty"`
+	File  string `json:"file,omitempty"`
+}
+
+func readManifest(folderpath string) (lumpManifest, error) {
+	manifest := lumpManifest{}
+	data, err := os.ReadFile(filepath.Join(folderpath, MANIFEST_FILENAME))
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("%s: %w", MANIFEST_FILENAME, err)
+	}
+	return manifest, nil
+}
+
+func writeManifest(folderpath string, manifest lumpManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(folderpath, MANIFEST_FILENAME), append(data, '\n'), 0644)
+}
+
+// Lump names can contain characters that aren't allowed in file names, such as \ in VILE\1,
+// so anything other than letters, digits and a few safe symbols is written as %XX
+func lumpFileName(name string) string {
+	builder := strings.Builder{}
+	for _, c := range []byte(name) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', strings.IndexByte("_-[]", c) >= 0:
+			builder.WriteByte(c)
+		default:
+			builder.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return builder.String()
+}
+
+// Path of a lump's file relative to the extracted folder, with a number added when another
+// lump of the same name already uses it
+func lumpFilePath(level string, name string, used map[string]bool) string {
+	dir := ""
+	if level != "" {
+		dir = lumpFileName(level)
+	}
+
+	base := lumpFileName(name)
+	file := path.Join(dir, base+".lmp")
+	for i := 2; used[strings.ToUpper(file)]; i++ {
+		file = path.Join(dir, fmt.Sprintf("%s~%d.lmp", base, i))
+	}
+	used[strings.ToUpper(file)] = true
+
+	return file
+}
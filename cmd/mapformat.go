@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+var flagMapFormatSave saveFlags
+
+func init() {
+	rootCmd.AddCommand(mapFormatCmd)
+	addSaveFlags(mapFormatCmd, &flagMapFormatSave)
+}
+
+var mapFormatCmd = &cobra.Command{
+	Use:   "map-format [flags] <doom|udmf> <input-wad-file> <output-wad-file>",
+	Short: "Convert levels between binary Doom and UDMF formats",
+	Long: `Converts every level in a WAD to the binary Doom
+format or to UDMF. Only UDMF levels in the doom
+namespace that don't use any UDMF-only features
+can be converted to the Doom format, and their
+nodes, blockmap and reject are rebuilt.
+Hexen-format levels are converted to UDMF in the
+hexen namespace, keeping their BEHAVIOR and
+SCRIPTS lumps.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 3 {
+			return errors.New("requires target format, input file path and output file path")
+		}
+		if args[0] != wad.LEVEL_FORMAT_DOOM.String() && args[0] != wad.LEVEL_FORMAT_UDMF.String() {
+			return fmt.Errorf("unknown level format: %s", args[0])
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := convertMapFormat(args[0], args[1], args[2])
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+func convertMapFormat(format string, in_filepath string, out_filepath string) error {
+	err := flagMapFormatSave.validate()
+	if err != nil {
+		return err
+	}
+
+	wf, err := wad.OpenFile(in_filepath)
+	if err != nil {
+		return err
+	}
+	printWarnings(in_filepath, wf)
+
+	for i := range wf.Levels {
+		if format == wad.LEVEL_FORMAT_UDMF.String() {
+			wf.Levels[i].ConvertToUDMF()
+		} else {
+			err = wf.Levels[i].ConvertToDoom()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return saveWad(wf, out_filepath, flagMapFormatSave)
+}
@@ -0,0 +1,312 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/Drakmyth/wado/wad"
+)
+
+// Space around the level geometry, in map units
+const MAP_PADDING = 64
+
+// Size of thing markers, in map units
+const THING_MARKER_RADIUS = 16
+
+var (
+	COLOR_BACKGROUND    = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	COLOR_ONE_SIDED     = color.RGBA{0xfc, 0x00, 0x00, 0xff}
+	COLOR_FLOOR_CHANGE  = color.RGBA{0xbc, 0x78, 0x43, 0xff}
+	COLOR_CEIL_CHANGE   = color.RGBA{0xfc, 0xfc, 0x00, 0xff}
+	COLOR_TWO_SIDED     = color.RGBA{0x80, 0x80, 0x80, 0xff}
+	COLOR_SECRET        = color.RGBA{0xff, 0x00, 0xff, 0xff}
+	COLOR_SPECIAL       = color.RGBA{0x00, 0xc0, 0xff, 0xff}
+	COLOR_THING_PLAYER  = color.RGBA{0x00, 0xff, 0x00, 0xff}
+	COLOR_THING_MONSTER = color.RGBA{0xff, 0x60, 0x60, 0xff}
+	COLOR_THING_ITEM    = color.RGBA{0x60, 0x90, 0xff, 0xff}
+	COLOR_THING_OTHER   = color.RGBA{0xa0, 0xa0, 0xa0, 0xff}
+)
+
+var PLAYER_START_THINGS = []int16{1, 2, 3, 4, 11}
+
+type mapBounds struct {
+	MinX int
+	MinY int
+	MaxX int
+	MaxY int
+}
+
+func (b mapBounds) width() int {
+	return b.MaxX - b.MinX + 2*MAP_PADDING
+}
+
+func (b mapBounds) height() int {
+	return b.MaxY - b.MinY + 2*MAP_PADDING
+}
+
+// Convert map coordinates to image coordinates. Doom's Y axis points up, images point down.
+func (b mapBounds) project(x float64, y float64) (float64, float64) {
+	return x - float64(b.MinX) + MAP_PADDING, float64(b.MaxY) - y + MAP_PADDING
+}
+
+type mapLine struct {
+	X1    float64
+	Y1    float64
+	X2    float64
+	Y2    float64
+	Color color.RGBA
+}
+
+type mapMarker struct {
+	X     float64
+	Y     float64
+	Angle float64
+	Color color.RGBA
+}
+
+type mapDrawing struct {
+	Bounds  mapBounds
+	Lines   []mapLine
+	Markers []mapMarker
+}
+
+// The elements of a level in Doom format, so levels in every format are drawn the same way
+type mapElements struct {
+	Things   []wad.Thing
+	Linedefs []wad.Linedef
+	Sidedefs []wad.Sidedef
+	Vertexes []wad.Vertex
+	Sectors  []wad.Sector
+}
+
+func newMapElements(level wad.Level) mapElements {
+	return mapElements{
+		Things:   level.ThingsAsDoom(),
+		Linedefs: level.LinedefsAsDoom(),
+		Sidedefs: level.SidedefsAsDoom(),
+		Vertexes: level.VertexesAsDoom(),
+		Sectors:  level.SectorsAsDoom(),
+	}
+}
+
+func levelBounds(elements mapElements) mapBounds {
+	bounds := mapBounds{MinX: math.MaxInt, MinY: math.MaxInt, MaxX: math.MinInt, MaxY: math.MinInt}
+	for _, linedef := range elements.Linedefs {
+		for _, vi := range []int16{linedef.Start, linedef.End} {
+			if int(vi) < 0 || int(vi) >= len(elements.Vertexes) {
+				continue
+			}
+			v := elements.Vertexes[vi]
+			bounds.MinX = min(bounds.MinX, int(v.X))
+			bounds.MinY = min(bounds.MinY, int(v.Y))
+			bounds.MaxX = max(bounds.MaxX, int(v.X))
+			bounds.MaxY = max(bounds.MaxY, int(v.Y))
+		}
+	}
+
+	if bounds.MinX > bounds.MaxX {
+		return mapBounds{}
+	}
+	return bounds
+}
+
+func drawLevel(level wad.Level) mapDrawing {
+	elements := newMapElements(level)
+	drawing := mapDrawing{
+		Bounds:  levelBounds(elements),
+		Lines:   make([]mapLine, 0, len(elements.Linedefs)),
+		Markers: make([]mapMarker, 0, len(elements.Things)),
+	}
+
+	for _, linedef := range elements.Linedefs {
+		if int(linedef.Start) < 0 || int(linedef.Start) >= len(elements.Vertexes) ||
+			int(linedef.End) < 0 || int(linedef.End) >= len(elements.Vertexes) {
+			continue
+		}
+
+		start, end := elements.Vertexes[linedef.Start], elements.Vertexes[linedef.End]
+		x1, y1 := drawing.Bounds.project(float64(start.X), float64(start.Y))
+		x2, y2 := drawing.Bounds.project(float64(end.X), float64(end.Y))
+		drawing.Lines = append(drawing.Lines, mapLine{X1: x1, Y1: y1, X2: x2, Y2: y2, Color: linedefColor(elements, linedef)})
+	}
+
+	for _, thing := range elements.Things {
+		x, y := drawing.Bounds.project(float64(thing.X), float64(thing.Y))
+		drawing.Markers = append(drawing.Markers, mapMarker{X: x, Y: y, Angle: float64(thing.Angle), Color: thingColor(thing)})
+	}
+
+	return drawing
+}
+
+func linedefColor(elements mapElements, linedef wad.Linedef) color.RGBA {
+	switch {
+	case linedef.Flags&wad.LINEDEF_FLAG_SECRET != 0:
+		return COLOR_SECRET
+	case linedef.SpecialType != 0:
+		return COLOR_SPECIAL
+	case linedef.Back == wad.NO_SIDEDEF:
+		return COLOR_ONE_SIDED
+	}
+
+	front, frontOk := facingSector(elements, linedef.Front)
+	back, backOk := facingSector(elements, linedef.Back)
+	switch {
+	case !frontOk || !backOk:
+		return COLOR_TWO_SIDED
+	case front.FloorHeight != back.FloorHeight:
+		return COLOR_FLOOR_CHANGE
+	case front.CeilingHeight != back.CeilingHeight:
+		return COLOR_CEIL_CHANGE
+	}
+
+	return COLOR_TWO_SIDED
+}
+
+func facingSector(elements mapElements, sidedefIndex int16) (wad.Sector, bool) {
+	if int(sidedefIndex) < 0 || int(sidedefIndex) >= len(elements.Sidedefs) {
+		return wad.Sector{}, false
+	}
+
+	sectorIndex := elements.Sidedefs[sidedefIndex].FacingSector
+	if int(sectorIndex) < 0 || int(sectorIndex) >= len(elements.Sectors) {
+		return wad.Sector{}, false
+	}
+
+	return elements.Sectors[sectorIndex], true
+}
+
+func thingColor(thing wad.Thing) color.RGBA {
+	_, isMonster := wad.MONSTER_HEALTH[thing.Type]
+	_, isAmmo := wad.AMMO_PICKUPS[thing.Type]
+	_, isHealth := wad.HEALTH_PICKUPS[thing.Type]
+	_, isArmor := wad.ARMOR_PICKUPS[thing.Type]
+
+	switch {
+	case slices.Contains(PLAYER_START_THINGS, thing.Type):
+		return COLOR_THING_PLAYER
+	case isMonster:
+		return COLOR_THING_MONSTER
+	case isAmmo || isHealth || isArmor:
+		return COLOR_THING_ITEM
+	}
+
+	return COLOR_THING_OTHER
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func levelMapSvg(level wad.Level, width int) string {
+	drawing := drawLevel(level)
+	bounds := drawing.Bounds
+	height := width * bounds.height() / max(bounds.width(), 1)
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		width, height, bounds.width(), bounds.height()))
+	builder.WriteString(fmt.Sprintf(`<rect width="%d" height="%d" fill="%s"/>`, bounds.width(), bounds.height(), hexColor(COLOR_BACKGROUND)))
+
+	for _, line := range drawing.Lines {
+		builder.WriteString(fmt.Sprintf(`<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="1.5" vector-effect="non-scaling-stroke"/>`,
+			line.X1, line.Y1, line.X2, line.Y2, hexColor(line.Color)))
+	}
+
+	for _, marker := range drawing.Markers {
+		dx, dy := markerDirection(marker)
+		builder.WriteString(fmt.Sprintf(`<circle cx="%g" cy="%g" r="%d" fill="none" stroke="%s" stroke-width="1" vector-effect="non-scaling-stroke"/>`,
+			marker.X, marker.Y, THING_MARKER_RADIUS, hexColor(marker.Color)))
+		builder.WriteString(fmt.Sprintf(`<line x1="%g" y1="%g" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="1" vector-effect="non-scaling-stroke"/>`,
+			marker.X, marker.Y, marker.X+dx, marker.Y+dy, hexColor(marker.Color)))
+	}
+
+	builder.WriteString("</svg>")
+	return builder.String()
+}
+
+// Thing angles are in degrees counter-clockwise from east, with Y pointing up
+func markerDirection(marker mapMarker) (float64, float64) {
+	radians := marker.Angle * math.Pi / 180
+	return math.Cos(radians) * THING_MARKER_RADIUS, -math.Sin(radians) * THING_MARKER_RADIUS
+}
+
+func writeLevelMapPng(w io.Writer, level wad.Level, width int) error {
+	drawing := drawLevel(level)
+	bounds := drawing.Bounds
+	scale := float64(width) / float64(max(bounds.width(), 1))
+	height := max(int(float64(bounds.height())*scale), 1)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, COLOR_BACKGROUND)
+		}
+	}
+
+	for _, line := range drawing.Lines {
+		drawPngLine(img, line.X1*scale, line.Y1*scale, line.X2*scale, line.Y2*scale, line.Color)
+	}
+
+	for _, marker := range drawing.Markers {
+		dx, dy := markerDirection(marker)
+		radius := math.Max(THING_MARKER_RADIUS*scale, 2)
+		drawPngCircle(img, marker.X*scale, marker.Y*scale, radius, marker.Color)
+		drawPngLine(img, marker.X*scale, marker.Y*scale, (marker.X+dx)*scale, (marker.Y+dy)*scale, marker.Color)
+	}
+
+	return png.Encode(w, img)
+}
+
+// Bresenham's line algorithm
+func drawPngLine(img *image.RGBA, fx1 float64, fy1 float64, fx2 float64, fy2 float64, c color.RGBA) {
+	x1, y1 := int(math.Round(fx1)), int(math.Round(fy1))
+	x2, y2 := int(math.Round(fx2)), int(math.Round(fy2))
+
+	dx, dy := abs(x2-x1), -abs(y2-y1)
+	sx, sy := 1, 1
+	if x1 > x2 {
+		sx = -1
+	}
+	if y1 > y2 {
+		sy = -1
+	}
+
+	err := dx + dy
+	for {
+		img.SetRGBA(x1, y1, c)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x1 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y1 += sy
+		}
+	}
+}
+
+func drawPngCircle(img *image.RGBA, cx float64, cy float64, radius float64, c color.RGBA) {
+	steps := max(int(radius*8), 8)
+	for i := 0; i < steps; i++ {
+		radians := 2 * math.Pi * float64(i) / float64(steps)
+		img.SetRGBA(int(math.Round(cx+math.Cos(radians)*radius)), int(math.Round(cy+math.Sin(radians)*radius)), c)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
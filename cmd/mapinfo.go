@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Drakmyth/wado/wad"
+)
+
+const MAPINFO_FLAG_USAGE = `Metadata lumps to write, any of umapinfo,
+zmapinfo, mapinfo, emapinfo and dehacked. The
+levels from zmapinfo and mapinfo replace only
+their own definitions in any existing lump, and
+the level names from dehacked are merged into
+any existing DEHACKED.`
+
+func mapInfoFlag(formats ...wad.MapInfoFormat) []string {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = string(format)
+	}
+	return names
+}
+
+func parseMapInfoFormats(names []string) ([]wad.MapInfoFormat, error) {
+	formats := make([]wad.MapInfoFormat, 0, len(names))
+	for _, name := range names {
+		format := wad.MapInfoFormat(strings.ToLower(name))
+		if !slices.Contains(wad.MAPINFO_FORMATS, format) {
+			return nil, fmt.Errorf("unknown mapinfo format: %s", name)
+		}
+		if !slices.Contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	return formats, nil
+}
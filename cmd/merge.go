@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+var flagMergeRenumber bool
+var flagMergeSlots []string
+var flagMergeMapInfo []string
+var flagMergeSave saveFlags
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+	mergeCmd.PersistentFlags().BoolVarP(&flagMergeRenumber, "renumber", "r", true,
+		`Move a level whose slot is already taken to the
+next free slot. When false, a collision fails the
+merge so the slots can be given with --slot.`)
+	mergeCmd.PersistentFlags().StringArrayVar(&flagMergeSlots, "slot", []string{},
+		`Move a level before merging, as
+<input-number>:<slot>=<new-slot>, where inputs are
+numbered from 1. For example 2:MAP01=MAP12.`)
+	mergeCmd.PersistentFlags().StringSliceVarP(&flagMergeMapInfo, "mapinfo", "m", mapInfoFlag(wad.DEFAULT_MAPINFO_FORMATS...), MAPINFO_FLAG_USAGE)
+	addSaveFlags(mergeCmd, &flagMergeSave)
+}
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge [flags] <input-wad-file>... <output-wad-file>",
+	Short: "Merge several WADs into one",
+	Long: `Merges WADs into one, in the order given, as if
+they were loaded together. Levels keep their slots
+unless they collide with a level from an earlier
+WAD. Sprites, flats and patches are combined into
+one marker range each, and TEXTURE1, TEXTURE2,
+PNAMES and DEHACKED are merged, with later WADs
+replacing earlier definitions. MAPINFO, ZMAPINFO
+and EMAPINFO are joined together, and other lumps
+are all kept. Map definitions and DEHACKED level
+names and par times of levels that moved follow
+them to their new slots.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 3 {
+			return errors.New("requires at least two input file paths and an output file path")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := merge(args[:len(args)-1], args[len(args)-1])
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+var slotFlagRegexp = regexp.MustCompile(`^(\d+):([^=]+)=(.+)$`)
+
+func merge(in_filepaths []string, out_filepath string) error {
+	mapInfoFormats, err := parseMapInfoFormats(flagMergeMapInfo)
+	if err != nil {
+		return err
+	}
+
+	err = flagMergeSave.validate()
+	if err != nil {
+		return err
+	}
+
+	slotMaps := make([]map[string]string, len(in_filepaths))
+	for _, slot := range flagMergeSlots {
+		parts := slotFlagRegexp.FindStringSubmatch(slot)
+		if parts == nil {
+			return fmt.Errorf("invalid slot mapping: %s", slot)
+		}
+		input, _ := strconv.Atoi(parts[1])
+		if input < 1 || input > len(in_filepaths) {
+			return fmt.Errorf("invalid slot mapping: %s: there is no input %d", slot, input)
+		}
+		if slotMaps[input-1] == nil {
+			slotMaps[input-1] = map[string]string{}
+		}
+		slotMaps[input-1][strings.ToUpper(parts[2])] = strings.ToUpper(parts[3])
+	}
+
+	files := make([]*wad.WadFile, 0, len(in_filepaths))
+	for _, path := range in_filepaths {
+		wf, err := wad.OpenFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		printWarnings(path, wf)
+		files = append(files, wf)
+	}
+
+	wf := wad.NewFile(out_filepath)
+	wf.MapInfoFormats = mapInfoFormats
+
+	report, err := wad.Merge(wf, files, wad.MergeOptions{SlotMaps: slotMaps, Renumber: flagMergeRenumber})
+	if err != nil {
+		if errors.Is(err, wad.ErrSlotCollision) {
+			return fmt.Errorf("%w (move it with --slot or use --renumber)", err)
+		}
+		return err
+	}
+
+	for _, change := range report.Renumbered {
+		fmt.Printf("Moved %s from %s to %s\n", change.From, in_filepaths[change.File], change.To)
+	}
+	if len(report.Conflicts) > 0 {
+		fmt.Printf("DEHACKED patches conflict, later WADs win:\n%s", formatConflicts(report.Conflicts))
+	}
+
+	return saveWad(wf, out_filepath, flagMergeSave)
+}
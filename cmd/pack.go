@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+var flagPackSave saveFlags
+
+func init() {
+	rootCmd.AddCommand(packCmd)
+	addSaveFlags(packCmd, &flagPackSave)
+}
+
+var packCmd = &cobra.Command{
+	Use:   "pack [flags] <input-folder> <output-wad-file>",
+	Short: "Build a WAD from an extracted folder",
+	Long: `Builds a WAD from a folder written by extract,
+using the lumps in the order its manifest.json
+lists them. Lumps are written exactly as they
+are, so packing an unchanged folder always gives
+the same WAD.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("requires input folder path and output file path")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := pack(args[0], args[1])
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+func pack(in_folderpath string, out_filepath string) error {
+	err := flagPackSave.validate()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := readManifest(in_folderpath)
+	if err != nil {
+		return err
+	}
+	if manifest.Identifier != "IWAD" && manifest.Identifier != "PWAD" {
+		return fmt.Errorf("%s: unknown identifier: %s", MANIFEST_FILENAME, manifest.Identifier)
+	}
+
+	lumps := make([]wad.Lump, 0, len(manifest.Lumps))
+	for _, entry := range manifest.Lumps {
+		if entry.Name == "" || len(entry.Name) > 8 {
+			return fmt.Errorf("%s: invalid lump name: %q", MANIFEST_FILENAME, entry.Name)
+		}
+
+		data := []byte{}
+		if entry.File != "" {
+			// Only read files inside the folder, whatever the manifest says
+			if !filepath.IsLocal(filepath.FromSlash(entry.File)) {
+				return fmt.Errorf("%s: %s is outside the folder", MANIFEST_FILENAME, entry.File)
+			}
+
+			data, err = os.ReadFile(filepath.Join(in_folderpath, filepath.FromSlash(entry.File)))
+			if err != nil {
+				return err
+			}
+		}
+
+		lumps = append(lumps, wad.Lump{Name: entry.Name, Data: data})
+	}
+
+	wf := wad.NewFile(out_filepath)
+	wf.Identifier = manifest.Identifier
+	wf.Lumps = lumps
+
+	// Any metadata lumps were extracted along with the rest and are packed as they are
+	wf.MapInfoFormats = []wad.MapInfoFormat{}
+
+	return saveWad(wf, out_filepath, flagPackSave)
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FORMAT_SVG = "svg"
+	FORMAT_PNG = "png"
+)
+
+// Pass this instead of a level slot to render every level in the WAD
+const ALL_LEVELS = "all"
+
+var renderFormat string
+var renderWidth int
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+	renderCmd.PersistentFlags().StringVarP(&renderFormat, "format", "f", "",
+		`Image format. One of: svg, png. Defaults to the
+output file extension, or svg when rendering all
+levels.`)
+	renderCmd.PersistentFlags().IntVarP(&renderWidth, "width", "w", 1024, "Width of the rendered image in pixels.")
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render [flags] <input-wad-file> <level|all> <output-file|output-folder>",
+	Short: "Render level maps to SVG or PNG images",
+	Long: `Renders a top-down automap-style picture of a level.
+Walls, height changes, secret and special lines are
+colour-coded and things are drawn as markers. When
+rendering all levels, the output is a folder and
+each image is named after its level slot.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 3 {
+			return errors.New("requires input file path, level and output path")
+		}
+		if renderFormat != "" && renderFormat != FORMAT_SVG && renderFormat != FORMAT_PNG {
+			return fmt.Errorf("unknown format: %s", renderFormat)
+		}
+		if renderWidth <= 0 {
+			return errors.New("width must be positive")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := render(args[0], args[1], args[2])
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+func render(in_filepath string, slot string, out_path string) error {
+	wf, err := wad.OpenFile(in_filepath)
+	if err != nil {
+		return err
+	}
+	printWarnings(in_filepath, wf)
+
+	if !strings.EqualFold(slot, ALL_LEVELS) {
+		for _, level := range wf.Levels {
+			if strings.EqualFold(level.Slot, slot) {
+				return renderLevel(level, out_path, imageFormat(out_path))
+			}
+		}
+		return fmt.Errorf("level %s not found in %s", slot, in_filepath)
+	}
+
+	err = os.MkdirAll(out_path, 0755)
+	if err != nil {
+		return err
+	}
+
+	format := renderFormat
+	if format == "" {
+		format = FORMAT_SVG
+	}
+
+	for _, level := range wf.Levels {
+		err = renderLevel(level, filepath.Join(out_path, fmt.Sprintf("%s.%s", level.Slot, format)), format)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func imageFormat(out_filepath string) string {
+	if renderFormat != "" {
+		return renderFormat
+	}
+
+	if strings.EqualFold(filepath.Ext(out_filepath), ".png") {
+		return FORMAT_PNG
+	}
+	return FORMAT_SVG
+}
+
+func renderLevel(level wad.Level, out_filepath string, format string) error {
+	f, err := os.Create(out_filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == FORMAT_PNG {
+		err = writeLevelMapPng(f, level, renderWidth)
+	} else {
+		_, err = f.WriteString(levelMapSvg(level, renderWidth))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rendered %s to %s\n", level.Slot, out_filepath)
+	return f.Sync()
+}
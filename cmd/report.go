@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Drakmyth/wado/wad"
+)
+
+const (
+	CHART_WIDTH  = 480
+	CHART_HEIGHT = 240
+	CHART_MARGIN = 40
+	MAP_WIDTH    = 480
+)
+
+var SKILL_COLORS = map[string]string{
+	"easy":   "#4caf50",
+	"medium": "#ff9800",
+	"hard":   "#e53935",
+}
+
+var SERIES_COLORS = []string{"#e53935", "#1e88e5", "#43a047"}
+
+//go:embed report.template.html
+var REPORT_TEMPLATE string
+
+type report struct {
+	File     string
+	Episodes []reportEpisode
+	Levels   []reportLevel
+}
+
+type reportEpisode struct {
+	Name  string
+	Chart template.HTML
+}
+
+type reportLevel struct {
+	Analysis levelAnalysis
+	Chart    template.HTML
+	Map      template.HTML
+}
+
+type chartSeries struct {
+	Name   string
+	Color  string
+	Values []float64
+}
+
+func writeReport(out_filepath string, wf *wad.WadFile, analysis wadAnalysis) error {
+	rep := report{
+		File:     analysis.File,
+		Episodes: makeEpisodes(analysis),
+		Levels:   make([]reportLevel, 0, len(analysis.Levels)),
+	}
+
+	for i, la := range analysis.Levels {
+		rep.Levels = append(rep.Levels, reportLevel{
+			Analysis: la,
+			Chart:    template.HTML(levelChartSvg(la)),
+			Map:      template.HTML(levelMapSvg(wf.Levels[i], MAP_WIDTH)),
+		})
+	}
+
+	temp := template.Must(template.New("report").Parse(REPORT_TEMPLATE))
+
+	f, err := os.Create(out_filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = temp.Execute(f, rep)
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+func makeEpisodes(analysis wadAnalysis) []reportEpisode {
+	names := []string{}
+	levelsByEpisode := map[string][]levelAnalysis{}
+	for _, la := range analysis.Levels {
+		name := episodeName(la.Slot)
+		if _, seen := levelsByEpisode[name]; !seen {
+			names = append(names, name)
+		}
+		levelsByEpisode[name] = append(levelsByEpisode[name], la)
+	}
+
+	episodes := make([]reportEpisode, 0, len(names))
+	for _, name := range names {
+		episodes = append(episodes, reportEpisode{
+			Name:  name,
+			Chart: template.HTML(episodeChartSvg(levelsByEpisode[name])),
+		})
+	}
+
+	return episodes
+}
+
+// Doom 2 has no episodes, so its levels are grouped by slot into the fixed ranges that vanilla
+// ends with intermission text. A WAD's own clusters aren't read.
+func episodeName(slot string) string {
+	d1LevelNameRegexp := regexp.MustCompile(`^E(\d)M(\d)$`)
+	if parts := d1LevelNameRegexp.FindStringSubmatch(slot); parts != nil {
+		return fmt.Sprintf("Episode %s", parts[1])
+	}
+
+	d2LevelNameRegexp := regexp.MustCompile(`^MAP(\d+)$`)
+	if parts := d2LevelNameRegexp.FindStringSubmatch(slot); parts != nil {
+		mapNumber, _ := strconv.Atoi(parts[1])
+		switch {
+		case mapNumber <= 6:
+			return "MAP01 - MAP06"
+		case mapNumber <= 11:
+			return "MAP07 - MAP11"
+		case mapNumber <= 20:
+			return "MAP12 - MAP20"
+		case mapNumber <= 30:
+			return "MAP21 - MAP30"
+		default:
+			return "Secret Levels"
+		}
+	}
+
+	return "Other"
+}
+
+func levelChartSvg(la levelAnalysis) string {
+	labels := make([]string, 0, len(la.Skills))
+	series := []chartSeries{
+		{Name: "Monster HP", Color: SERIES_COLORS[0]},
+		{Name: "Ammo damage", Color: SERIES_COLORS[1]},
+		{Name: "Health + armor", Color: SERIES_COLORS[2]},
+	}
+
+	for _, skill := range la.Skills {
+		ammo := wad.Ammo{Bullets: skill.Bullets + wad.PISTOL_START_BULLETS, Shells: skill.Shells, Rockets: skill.Rockets, Cells: skill.Cells}
+		labels = append(labels, skill.Skill)
+		series[0].Values = append(series[0].Values, float64(skill.MonsterHealth))
+		series[1].Values = append(series[1].Values, float64(ammo.Damage()))
+		series[2].Values = append(series[2].Values, float64(wad.PISTOL_START_HEALTH+skill.Health+skill.Armor))
+	}
+
+	return barChartSvg(labels, series)
+}
+
+func episodeChartSvg(levels []levelAnalysis) string {
+	labels := make([]string, 0, len(levels))
+	series := []chartSeries{}
+	for _, skill := range wad.SKILLS {
+		series = append(series, chartSeries{Name: skill.String(), Color: SKILL_COLORS[skill.String()]})
+	}
+
+	for _, la := range levels {
+		labels = append(labels, la.Slot)
+		for i, skill := range la.Skills {
+			series[i].Values = append(series[i].Values, skill.Score)
+		}
+	}
+
+	return lineChartSvg(labels, series)
+}
+
+func barChartSvg(labels []string, series []chartSeries) string {
+	builder := strings.Builder{}
+	yMax := chartMax(series)
+	plotWidth := float64(CHART_WIDTH - 2*CHART_MARGIN)
+	plotHeight := float64(CHART_HEIGHT - 2*CHART_MARGIN)
+	groupWidth := plotWidth / float64(max(len(labels), 1))
+	barWidth := groupWidth * 0.8 / float64(len(series))
+
+	writeChartFrame(&builder, yMax, series)
+	for i, label := range labels {
+		groupX := float64(CHART_MARGIN) + float64(i)*groupWidth
+		for j, s := range series {
+			barHeight := s.Values[i] / yMax * plotHeight
+			x := groupX + groupWidth*0.1 + float64(j)*barWidth
+			y := float64(CHART_HEIGHT-CHART_MARGIN) - barHeight
+			builder.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %g</title></rect>`,
+				x, y, barWidth, barHeight, s.Color, html.EscapeString(s.Name), s.Values[i]))
+		}
+		builder.WriteString(fmt.Sprintf(`<text x="%.1f" y="%d" text-anchor="middle">%s</text>`,
+			groupX+groupWidth/2, CHART_HEIGHT-CHART_MARGIN+16, html.EscapeString(label)))
+	}
+	builder.WriteString("</svg>")
+
+	return builder.String()
+}
+
+func lineChartSvg(labels []string, series []chartSeries) string {
+	builder := strings.Builder{}
+	yMax := chartMax(series)
+	plotWidth := float64(CHART_WIDTH - 2*CHART_MARGIN)
+	plotHeight := float64(CHART_HEIGHT - 2*CHART_MARGIN)
+	step := plotWidth / float64(max(len(labels), 1))
+
+	writeChartFrame(&builder, yMax, series)
+	for i, label := range labels {
+		builder.WriteString(fmt.Sprintf(`<text x="%.1f" y="%d" text-anchor="middle">%s</text>`,
+			float64(CHART_MARGIN)+step*(float64(i)+0.5), CHART_HEIGHT-CHART_MARGIN+16, html.EscapeString(label)))
+	}
+
+	for _, s := range series {
+		points := make([]string, 0, len(s.Values))
+		for i, value := range s.Values {
+			x := float64(CHART_MARGIN) + step*(float64(i)+0.5)
+			y := float64(CHART_HEIGHT-CHART_MARGIN) - value/yMax*plotHeight
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+			builder.WriteString(fmt.Sprintf(`<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s %s: %g</title></circle>`,
+				x, y, s.Color, html.EscapeString(labels[i]), html.EscapeString(s.Name), value))
+		}
+		builder.WriteString(fmt.Sprintf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`,
+			strings.Join(points, " "), s.Color))
+	}
+	builder.WriteString("</svg>")
+
+	return builder.String()
+}
+
+// Writes the opening svg tag, axes, gridlines and legend shared by every chart
+func writeChartFrame(builder *strings.Builder, yMax float64, series []chartSeries) {
+	builder.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" class="chart" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		CHART_WIDTH, CHART_HEIGHT, CHART_WIDTH, CHART_HEIGHT))
+
+	plotHeight := float64(CHART_HEIGHT - 2*CHART_MARGIN)
+	for i := 0; i <= 4; i++ {
+		value := yMax * float64(i) / 4
+		y := float64(CHART_HEIGHT-CHART_MARGIN) - plotHeight*float64(i)/4
+		builder.WriteString(fmt.Sprintf(`<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`,
+			CHART_MARGIN, y, CHART_WIDTH-CHART_MARGIN, y))
+		builder.WriteString(fmt.Sprintf(`<text x="%d" y="%.1f" text-anchor="end">%g</text>`,
+			CHART_MARGIN-4, y+4, value))
+	}
+
+	for i, s := range series {
+		x := CHART_MARGIN + i*110
+		builder.WriteString(fmt.Sprintf(`<rect x="%d" y="10" width="10" height="10" fill="%s"/>`, x, s.Color))
+		builder.WriteString(fmt.Sprintf(`<text x="%d" y="19">%s</text>`, x+14, html.EscapeString(s.Name)))
+	}
+}
+
+// Round the largest value up to a number that makes for readable gridlines
+func chartMax(series []chartSeries) float64 {
+	largest := 0.0
+	for _, s := range series {
+		for _, value := range s.Values {
+			largest = math.Max(largest, value)
+		}
+	}
+
+	if largest <= 0 {
+		return 1
+	}
+
+	magnitude := math.Pow(10, math.Floor(math.Log10(largest)))
+	for _, multiple := range []float64{1, 2, 4, 5, 8, 10} {
+		if largest <= multiple*magnitude {
+			return multiple * magnitude
+		}
+	}
+	return 10 * magnitude
+}
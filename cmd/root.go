@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
+	"os"
 
+	"github.com/Drakmyth/wado/wad"
 	"github.com/spf13/cobra"
 )
 
@@ -17,3 +20,10 @@ func Execute() {
 		log.Fatal(err)
 	}
 }
+
+// Prints the problems wado worked around when reading a WAD
+func printWarnings(path string, wf *wad.WadFile) {
+	for _, warning := range wf.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", path, warning)
+	}
+}
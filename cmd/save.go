@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+// Flags shared by every command that writes a WAD
+type saveFlags struct {
+	Backup        bool
+	PreserveOrder bool
+	Deduplicate   bool
+	Align         int
+}
+
+func addSaveFlags(cmd *cobra.Command, flags *saveFlags) {
+	cmd.PersistentFlags().BoolVar(&flags.Backup, "backup", false,
+		`Keep the previous contents of the output file
+as <output-wad-file>.bak when overwriting it.`)
+	cmd.PersistentFlags().BoolVar(&flags.PreserveOrder, "preserve-order", false,
+		`Write lumps and levels in the order they had in
+the input file instead of levels first, with
+generated metadata in place of the lumps it
+replaces. Keeps marker ranges such as S_START
+and S_END intact.`)
+	cmd.PersistentFlags().BoolVarP(&flags.Deduplicate, "deduplicate", "d", false,
+		`Store identical lump data once, with every lump
+that has it sharing the same offset.`)
+	cmd.PersistentFlags().IntVar(&flags.Align, "align", 0,
+		`Start the data of every lump at a multiple of
+this many bytes, such as 4.`)
+}
+
+func (flags saveFlags) validate() error {
+	if flags.Align < 0 {
+		return fmt.Errorf("invalid alignment: %d", flags.Align)
+	}
+	return nil
+}
+
+func saveWad(wf *wad.WadFile, out_filepath string, flags saveFlags) error {
+	wf.Backup = flags.Backup
+	wf.PreserveOrder = flags.PreserveOrder
+	wf.Deduplicate = flags.Deduplicate
+	wf.Alignment = flags.Align
+
+	err := wf.SaveAs(out_filepath)
+	if err != nil {
+		return err
+	}
+
+	if flags.Deduplicate || flags.Align > 1 {
+		fmt.Printf("Saved %d bytes: %d bytes of duplicate lumps, %d bytes of padding\n", wf.Stats.BytesSaved(), wf.Stats.DuplicateBytes, wf.Stats.PaddingBytes)
+	}
+	return nil
+}
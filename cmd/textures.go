@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/Drakmyth/wado/wad"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(checkTexturesCmd)
+}
+
+var checkTexturesCmd = &cobra.Command{
+	Use:   "check-textures <iwad-file> <input-wad-file>",
+	Short: "List textures and flats that don't exist",
+	Long: `Checks that every texture used by the sidedefs
+of a WAD's levels is defined by the IWAD it's
+played with or by the WAD's own TEXTURE1 and
+TEXTURE2, and that every flat used by their
+sectors is in one of them, and lists the ones
+that aren't for each level. Missing textures show
+up as HOM in-game.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("requires IWAD file path and input file path")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := checkTextures(args[0], args[1])
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+func checkTextures(iwad_filepath string, in_filepath string) error {
+	wf, err := wad.OpenFile(in_filepath)
+	if err != nil {
+		return err
+	}
+	printWarnings(in_filepath, wf)
+
+	iwad, err := wad.OpenFileLazy(iwad_filepath)
+	if err != nil {
+		return err
+	}
+	printWarnings(iwad_filepath, iwad)
+	defer iwad.Close()
+
+	textures, err := availableTextures(iwad, wf)
+	if err != nil {
+		return err
+	}
+
+	printMissingTextures(wf.Levels, textures, availableFlats(iwad, wf))
+	return nil
+}
+
+// Textures from the IWAD plus the ones the WAD defines itself
+func availableTextures(iwad *wad.WadFile, wf *wad.WadFile) (wad.TextureSet, error) {
+	iwadPatchNames, err := iwad.PatchNames()
+	if err != nil {
+		return nil, fmt.Errorf("IWAD %w", err)
+	}
+	iwadTextures, err := iwad.Textures(nil)
+	if err != nil {
+		return nil, fmt.Errorf("IWAD %w", err)
+	}
+
+	wadTextures, err := wf.Textures(iwadPatchNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return wad.NewTextureSet(iwadTextures, wadTextures), nil
+}
+
+// Flats from the IWAD plus the ones the WAD has itself
+func availableFlats(iwad *wad.WadFile, wf *wad.WadFile) wad.TextureSet {
+	flats := iwad.Flats()
+	maps.Copy(flats, wf.Flats())
+	return flats
+}
+
+func printMissingTextures(levels []wad.Level, textures wad.TextureSet, flats wad.TextureSet) {
+	found := false
+	for _, level := range levels {
+		missingTextures := level.MissingTextures(textures)
+		missingFlats := level.MissingFlats(flats)
+		if len(missingTextures) == 0 && len(missingFlats) == 0 {
+			continue
+		}
+
+		found = true
+		fmt.Printf("%s: %d missing textures, %d missing flats\n", level.Slot, len(missingTextures), len(missingFlats))
+		for _, texture := range missingTextures {
+			fmt.Printf("  %-8s  sidedefs %s\n", texture.Name, joinIndexes(texture.Sidedefs))
+		}
+		for _, flat := range missingFlats {
+			fmt.Printf("  %-8s  sectors %s\n", flat.Name, joinIndexes(flat.Sectors))
+		}
+	}
+
+	if !found {
+		fmt.Println("No missing textures or flats")
+	}
+}
+
+func joinIndexes(indexes []int) string {
+	strs := make([]string, len(indexes))
+	for i, index := range indexes {
+		strs[i] = strconv.Itoa(index)
+	}
+	return strings.Join(strs, ", ")
+}
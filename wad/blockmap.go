@@ -0,0 +1,131 @@
+package wad
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const BLOCKMAP_BLOCK_SIZE = 128
+
+// Space left between the level geometry and the edge of the blockmap
+const BLOCKMAP_MARGIN = 8
+
+const (
+	BLOCKLIST_START uint16 = 0x0000
+	BLOCKLIST_END   uint16 = 0xffff
+)
+
+// Blockmap offsets are 16-bit counts of 2-byte words from the start of the lump
+const BLOCKMAP_MAX_OFFSET = math.MaxUint16
+
+// UDMF levels return ErrUDMFNodes, since ports build their blockmap themselves
+func (l *Level) BuildBlockmap(compress bool) error {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		return &MapError{Slot: l.Slot, Err: ErrUDMFNodes}
+	}
+
+	l.rebuilt(LUMP_BLOCKMAP)
+	if len(l.Vertexes) == 0 {
+		l.Blockmap = []byte{}
+		return nil
+	}
+
+	minX, minY, maxX, maxY := math.MaxInt, math.MaxInt, math.MinInt, math.MinInt
+	for _, v := range l.Vertexes {
+		minX, minY = min(minX, int(v.X)), min(minY, int(v.Y))
+		maxX, maxY = max(maxX, int(v.X)), max(maxY, int(v.Y))
+	}
+
+	originX, originY := minX-BLOCKMAP_MARGIN, minY-BLOCKMAP_MARGIN
+	columns := (maxX-originX)/BLOCKMAP_BLOCK_SIZE + 1
+	rows := (maxY-originY)/BLOCKMAP_BLOCK_SIZE + 1
+
+	blocks := make([][]uint16, columns*rows)
+	for i, linedef := range l.LinedefsAsDoom() {
+		if int(linedef.Start) < 0 || int(linedef.Start) >= len(l.Vertexes) ||
+			int(linedef.End) < 0 || int(linedef.End) >= len(l.Vertexes) {
+			continue
+		}
+
+		v1, v2 := l.Vertexes[linedef.Start], l.Vertexes[linedef.End]
+		firstColumn := (min(int(v1.X), int(v2.X)) - originX) / BLOCKMAP_BLOCK_SIZE
+		lastColumn := (max(int(v1.X), int(v2.X)) - originX) / BLOCKMAP_BLOCK_SIZE
+		firstRow := (min(int(v1.Y), int(v2.Y)) - originY) / BLOCKMAP_BLOCK_SIZE
+		lastRow := (max(int(v1.Y), int(v2.Y)) - originY) / BLOCKMAP_BLOCK_SIZE
+
+		for row := firstRow; row <= lastRow; row++ {
+			for column := firstColumn; column <= lastColumn; column++ {
+				blockX := originX + column*BLOCKMAP_BLOCK_SIZE
+				blockY := originY + row*BLOCKMAP_BLOCK_SIZE
+				if lineTouchesBlock(v1, v2, blockX, blockY) {
+					blocks[row*columns+column] = append(blocks[row*columns+column], uint16(i))
+				}
+			}
+		}
+	}
+
+	// Header, then one offset per block, then the blocklists themselves
+	words := make([]uint16, 0, 4+len(blocks)*3)
+	words = append(words, uint16(int16(originX)), uint16(int16(originY)), uint16(columns), uint16(rows))
+	words = append(words, make([]uint16, len(blocks))...)
+
+	shared := map[string]uint16{}
+	for i, block := range blocks {
+		key := blocklistKey(block)
+		if offset, exists := shared[key]; compress && exists {
+			words[4+i] = offset
+			continue
+		}
+
+		if len(words) > BLOCKMAP_MAX_OFFSET {
+			return fmt.Errorf("building blockmap for %s: blockmap is too large", l.Slot)
+		}
+
+		offset := uint16(len(words))
+		shared[key] = offset
+		words[4+i] = offset
+		words = append(words, BLOCKLIST_START)
+		words = append(words, block...)
+		words = append(words, BLOCKLIST_END)
+	}
+
+	data := make([]byte, len(words)*2)
+	for i, word := range words {
+		binary.LittleEndian.PutUint16(data[i*2:i*2+2], word)
+	}
+
+	l.Blockmap = data
+	return nil
+}
+
+// Lines that only touch the edge of a block are included, since the engine may check either block
+func lineTouchesBlock(v1 Vertex, v2 Vertex, blockX int, blockY int) bool {
+	x1, y1, x2, y2 := int64(v1.X), int64(v1.Y), int64(v2.X), int64(v2.Y)
+	dx, dy := x2-x1, y2-y1
+
+	corners := [][2]int64{
+		{int64(blockX), int64(blockY)},
+		{int64(blockX + BLOCKMAP_BLOCK_SIZE), int64(blockY)},
+		{int64(blockX), int64(blockY + BLOCKMAP_BLOCK_SIZE)},
+		{int64(blockX + BLOCKMAP_BLOCK_SIZE), int64(blockY + BLOCKMAP_BLOCK_SIZE)},
+	}
+
+	front, back := false, false
+	for _, corner := range corners {
+		cross := dx*(corner[1]-y1) - dy*(corner[0]-x1)
+		front = front || cross <= 0
+		back = back || cross >= 0
+	}
+
+	return front && back
+}
+
+func blocklistKey(block []uint16) string {
+	builder := strings.Builder{}
+	for _, linedef := range block {
+		builder.WriteString(fmt.Sprintf("%d,", linedef))
+	}
+	return builder.String()
+}
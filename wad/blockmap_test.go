@@ -0,0 +1,144 @@
+package wad
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func blockmapWords(data []byte) []uint16 {
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return words
+}
+
+// Linedefs listed for each block, read back through the offsets
+func blocklists(words []uint16) [][]uint16 {
+	columns, rows := int(words[2]), int(words[3])
+	lists := make([][]uint16, columns*rows)
+	for i := range lists {
+		offset := int(words[4+i])
+		list := []uint16{}
+		for _, word := range words[offset+1:] {
+			if word == BLOCKLIST_END {
+				break
+			}
+			list = append(list, word)
+		}
+		lists[i] = list
+	}
+	return lists
+}
+
+func TestBuildBlockmap(t *testing.T) {
+	// The 256x256 room has a 3x3 grid of blocks starting 8 units outside its corner, with each
+	// wall in the blocks along its side
+	square := []uint16{
+		0xfff8, 0xfff8, 3, 3,
+		13, 17, 20, 24, 27, 29, 32, 36, 39,
+		0, 0, 3, BLOCKLIST_END,
+		0, 3, BLOCKLIST_END,
+		0, 2, 3, BLOCKLIST_END,
+		0, 0, BLOCKLIST_END,
+		0, BLOCKLIST_END,
+		0, 2, BLOCKLIST_END,
+		0, 0, 1, BLOCKLIST_END,
+		0, 1, BLOCKLIST_END,
+		0, 1, 2, BLOCKLIST_END,
+	}
+
+	tests := []struct {
+		name     string
+		level    Level
+		compress bool
+		want     []uint16
+	}{
+		{name: "square room", level: testSquareLevel(256), compress: false, want: square},
+		{name: "square room compressed", level: testSquareLevel(256), compress: true, want: square},
+		{name: "large room", level: testSquareLevel(512), compress: false},
+		{name: "large room compressed", level: testSquareLevel(512), compress: true},
+		{name: "two rooms", level: testTwoRoomLevel(), compress: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			level := test.level
+			err := level.BuildBlockmap(test.compress)
+			if err != nil {
+				t.Fatalf("BuildBlockmap() error = %v", err)
+			}
+
+			words := blockmapWords(level.Blockmap)
+			if test.want != nil && !slices.Equal(words, test.want) {
+				t.Errorf("BuildBlockmap() = %v, want %v", words, test.want)
+			}
+
+			// Compression only shares identical blocklists, so every block lists the same lines
+			uncompressed := test.level
+			err = uncompressed.BuildBlockmap(false)
+			if err != nil {
+				t.Fatalf("BuildBlockmap() error = %v", err)
+			}
+			got, want := blocklists(words), blocklists(blockmapWords(uncompressed.Blockmap))
+			if !slices.EqualFunc(got, want, slices.Equal) {
+				t.Errorf("blocklists = %v, want %v", got, want)
+			}
+			if test.compress && len(level.Blockmap) > len(uncompressed.Blockmap) {
+				t.Errorf("compressed blockmap is %d bytes, more than the %d uncompressed", len(level.Blockmap), len(uncompressed.Blockmap))
+			}
+		})
+	}
+}
+
+func TestBuildBlockmapSharesEmptyBlocks(t *testing.T) {
+	level := testSquareLevel(512)
+	err := level.BuildBlockmap(true)
+	if err != nil {
+		t.Fatalf("BuildBlockmap() error = %v", err)
+	}
+
+	// The 5x5 grid has 9 empty blocks inside the walls, which all point at one blocklist
+	words := blockmapWords(level.Blockmap)
+	empty := map[uint16]bool{}
+	for i, list := range blocklists(words) {
+		if len(list) == 0 {
+			empty[words[4+i]] = true
+		}
+	}
+	if len(empty) != 1 {
+		t.Errorf("empty blocks use %d blocklists, want 1", len(empty))
+	}
+}
+
+func TestBuildReject(t *testing.T) {
+	// Two rooms that don't share a line, so neither can see into the other
+	separate := newTestLevel(
+		[]Vertex{{0, 0}, {0, 128}, {128, 128}, {128, 0}, {256, 0}, {256, 128}, {384, 128}, {384, 0}},
+		[]testLine{{0, 1, 0, -1}, {1, 2, 0, -1}, {2, 3, 0, -1}, {3, 0, 0, -1}, {4, 5, 1, -1}, {5, 6, 1, -1}, {6, 7, 1, -1}, {7, 4, 1, -1}},
+		2,
+	)
+
+	tests := []struct {
+		name     string
+		level    Level
+		zeroFill bool
+		want     []byte
+	}{
+		{name: "joined rooms", level: testTwoRoomLevel(), zeroFill: false, want: []byte{0x00}},
+		{name: "separate rooms", level: separate, zeroFill: false, want: []byte{0x06}},
+		{name: "separate rooms zero filled", level: separate, zeroFill: true, want: []byte{0x00}},
+		{name: "one room", level: testSquareLevel(256), zeroFill: false, want: []byte{0x00}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			level := test.level
+			level.BuildReject(test.zeroFill)
+			if !slices.Equal(level.Reject, test.want) {
+				t.Errorf("BuildReject() = %08b, want %08b", level.Reject, test.want)
+			}
+		})
+	}
+}
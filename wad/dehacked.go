@@ -0,0 +1,272 @@
+package wad
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const LUMP_DEHACKED = "DEHACKED"
+
+// Automap level names as they appear in the original executables, which vanilla Text
+// replacements have to match exactly
+var VANILLA_LEVEL_NAMES = map[string]string{
+	"E1M1": "E1M1: Hangar",
+	"E1M2": "E1M2: Nuclear Plant",
+	"E1M3": "E1M3: Toxin Refinery",
+	"E1M4": "E1M4: Command Control",
+	"E1M5": "E1M5: Phobos Lab",
+	"E1M6": "E1M6: Central Processing",
+	"E1M7": "E1M7: Computer Station",
+	"E1M8": "E1M8: Phobos Anomaly",
+	"E1M9": "E1M9: Military Base",
+	"E2M1": "E2M1: Deimos Anomaly",
+	"E2M2": "E2M2: Containment Area",
+	"E2M3": "E2M3: Refinery",
+	"E2M4": "E2M4: Deimos Lab",
+	"E2M5": "E2M5: Command Center",
+	"E2M6": "E2M6: Halls of the Damned",
+	"E2M7": "E2M7: Spawning Vats",
+	"E2M8": "E2M8: Tower of Babel",
+	"E2M9": "E2M9: Fortress of Mystery",
+	"E3M1": "E3M1: Hell Keep",
+	"E3M2": "E3M2: Slough of Despair",
+	"E3M3": "E3M3: Pandemonium",
+	"E3M4": "E3M4: House of Pain",
+	"E3M5": "E3M5: Unholy Cathedral",
+	"E3M6": "E3M6: Mt. Erebus",
+	"E3M7": "E3M7: Limbo",
+	"E3M8": "E3M8: Dis",
+	"E3M9": "E3M9: Warrens",
+	"E4M1": "E4M1: Hell Beneath",
+	"E4M2": "E4M2: Perfect Hatred",
+	"E4M3": "E4M3: Sever The Wicked",
+	"E4M4": "E4M4: Unruly Evil",
+	"E4M5": "E4M5: They Will Repent",
+	"E4M6": "E4M6: Against Thee Wickedly",
+	"E4M7": "E4M7: And Hell Followed",
+	"E4M8": "E4M8: Unto The Cruel",
+	"E4M9": "E4M9: Fear",
+
+	"MAP01": "level 1: entryway",
+	"MAP02": "level 2: underhalls",
+	"MAP03": "level 3: the gantlet",
+	"MAP04": "level 4: the focus",
+	"MAP05": "level 5: the waste tunnels",
+	"MAP06": "level 6: the crusher",
+	"MAP07": "level 7: dead simple",
+	"MAP08": "level 8: tricks and traps",
+	"MAP09": "level 9: the pit",
+	"MAP10": "level 10: refueling base",
+	"MAP11": "level 11: 'o' of destruction!",
+	"MAP12": "level 12: the factory",
+	"MAP13": "level 13: downtown",
+	"MAP14": "level 14: the inmost dens",
+	"MAP15": "level 15: industrial zone",
+	"MAP16": "level 16: suburbs",
+	"MAP17": "level 17: tenements",
+	"MAP18": "level 18: the courtyard",
+	"MAP19": "level 19: the citadel",
+	"MAP20": "level 20: gotcha!",
+	"MAP21": "level 21: nirvana",
+	"MAP22": "level 22: the catacombs",
+	"MAP23": "level 23: barrels o' fun",
+	"MAP24": "level 24: the chasm",
+	"MAP25": "level 25: bloodfalls",
+	"MAP26": "level 26: the abandoned mines",
+	"MAP27": "level 27: monster condo",
+	"MAP28": "level 28: the spirit world",
+	"MAP29": "level 29: the living end",
+	"MAP30": "level 30: icon of sin",
+	"MAP31": "level 31: wolfenstein",
+	"MAP32": "level 32: grosse",
+}
+
+// BEX string names for the text shown after leaving a level, and for the text shown after
+// leaving through the secret exit
+var BEX_INTERTEXT_STRINGS = map[string]string{
+	"E1M8":  "E1TEXT",
+	"E2M8":  "E2TEXT",
+	"E3M8":  "E3TEXT",
+	"E4M8":  "E4TEXT",
+	"MAP06": "C1TEXT",
+	"MAP11": "C2TEXT",
+	"MAP20": "C3TEXT",
+	"MAP30": "C4TEXT",
+}
+
+var BEX_INTERTEXT_SECRET_STRINGS = map[string]string{
+	"MAP15": "C5TEXT",
+	"MAP31": "C6TEXT",
+}
+
+var doom1SlotRegexp = regexp.MustCompile(`^E(\d)M(\d)$`)
+var doom2SlotRegexp = regexp.MustCompile(`^MAP(\d+)$`)
+
+// Adds the level names as vanilla Text replacements, which every DeHackEd-capable port
+// understands, and BEX strings with the full names, par times and intermission text for ports
+// that support them. Any patch already in the file is kept, but loses to the generated changes.
+func makeDehackedLump(levels []Level, lumps []Lump) (Lump, error) {
+	patch := &Dehacked{DoomVersion: DEHACKED_DOOM_VERSION, PatchFormat: DEHACKED_PATCH_FORMAT}
+	index := slices.IndexFunc(lumps, func(lump Lump) bool {
+		return lump.Name == LUMP_DEHACKED
+	})
+	if index >= 0 {
+		var err error
+		patch, err = ParseDehacked(lumps[index].Data)
+		if err != nil {
+			return Lump{}, err
+		}
+	}
+
+	patch.Merge(makeDehacked(levels))
+
+	return Lump{
+		Name: LUMP_DEHACKED,
+		Data: patch.Bytes(),
+	}, nil
+}
+
+func makeDehacked(levels []Level) Dehacked {
+	patch := Dehacked{DoomVersion: DEHACKED_DOOM_VERSION, PatchFormat: DEHACKED_PATCH_FORMAT}
+	texts := patch.block(DEHACKED_BLOCK_TEXT, 0, "")
+	strs := patch.block(DEHACKED_BLOCK_STRINGS, 0, "")
+	pars := patch.block(DEHACKED_BLOCK_PARS, 0, "")
+	for _, level := range levels {
+		original, known := VANILLA_LEVEL_NAMES[level.Slot]
+		if !known {
+			continue
+		}
+
+		// Vanilla ports always show the slot the level is in, whatever its label says
+		name := fmt.Sprintf("%s: %s", vanillaLevelLabel(level.Slot), level.LevelInfo.Name)
+
+		vanillaName := fitVanillaText(original, name, level.LevelInfo.Name)
+		if vanillaName != original {
+			texts.set(original, vanillaName)
+		}
+		if name != original {
+			strs.set(bexLevelNameString(level.Slot), bexString(name))
+		}
+
+		if text, hasText := BEX_INTERTEXT_STRINGS[level.Slot]; hasText && len(level.LevelInfo.InterText) > 0 {
+			strs.set(text, bexString(strings.Join(level.LevelInfo.InterText, "\n")))
+		}
+		if text, hasText := BEX_INTERTEXT_SECRET_STRINGS[level.Slot]; hasText && len(level.LevelInfo.InterTextSecret) > 0 {
+			strs.set(text, bexString(strings.Join(level.LevelInfo.InterTextSecret, "\n")))
+		}
+
+		if level.LevelInfo.ParTime > 0 {
+			pars.set(bexParSlot(level.Slot), fmt.Sprint(level.LevelInfo.ParTime))
+		}
+	}
+
+	return patch
+}
+
+// Vanilla strings are stored null-terminated and padded to 4 bytes, so a replacement can only
+// use that space. Falls back to the name without its label, then to cutting the name short.
+func fitVanillaText(original string, candidates ...string) string {
+	maxLength := (len(original)+1+3)/4*4 - 1
+	for _, candidate := range candidates {
+		if len(candidate) <= maxLength {
+			return candidate
+		}
+	}
+
+	last := candidates[len(candidates)-1]
+	return strings.TrimSpace(last[:maxLength])
+}
+
+func vanillaLevelLabel(slot string) string {
+	if parts := doom2SlotRegexp.FindStringSubmatch(slot); parts != nil {
+		number, _ := strconv.Atoi(parts[1])
+		return fmt.Sprintf("Level %d", number)
+	}
+	return slot
+}
+
+func bexLevelNameString(slot string) string {
+	if parts := doom2SlotRegexp.FindStringSubmatch(slot); parts != nil {
+		number, _ := strconv.Atoi(parts[1])
+		return fmt.Sprintf("HUSTR_%d", number)
+	}
+	return "HUSTR_" + slot
+}
+
+// Doom 2 par times are keyed by map number and Doom 1 par times by episode and mission
+func bexParSlot(slot string) string {
+	if parts := doom1SlotRegexp.FindStringSubmatch(slot); parts != nil {
+		return fmt.Sprintf("%s %s", parts[1], parts[2])
+	}
+	parts := doom2SlotRegexp.FindStringSubmatch(slot)
+	number, _ := strconv.Atoi(parts[1])
+	return fmt.Sprint(number)
+}
+
+// BEX strings are a single line with C-style escapes for line breaks
+func bexString(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(value)
+}
+
+// The patch with the level names and par times of levels that have changed slot moved to their
+// new slots, so a patch from a WAD whose levels were renumbered still names the same levels.
+// Names that start with the old slot's label get the new one.
+func (d Dehacked) WithSlots(slotMap map[string]string) Dehacked {
+	// New keys for the old ones in each block, along with the slots they're for
+	type rename struct{ key, from, to string }
+	renames := map[string]map[string]rename{DEHACKED_BLOCK_TEXT: {}, DEHACKED_BLOCK_STRINGS: {}, DEHACKED_BLOCK_PARS: {}}
+	for from, to := range slotMap {
+		if from == to || !isVanillaSlot(from) || !isVanillaSlot(to) {
+			continue
+		}
+		original, knownFrom := VANILLA_LEVEL_NAMES[from]
+		newOriginal, knownTo := VANILLA_LEVEL_NAMES[to]
+		if knownFrom && knownTo {
+			renames[DEHACKED_BLOCK_TEXT][original] = rename{newOriginal, from, to}
+		}
+		for _, prefix := range []string{"", "P", "T"} {
+			renames[DEHACKED_BLOCK_STRINGS][prefix+bexLevelNameString(from)] = rename{prefix + bexLevelNameString(to), from, to}
+		}
+		renames[DEHACKED_BLOCK_PARS][bexParSlot(from)] = rename{bexParSlot(to), from, to}
+	}
+
+	moved := Dehacked{DoomVersion: d.DoomVersion, PatchFormat: d.PatchFormat, Blocks: []DehackedBlock{}}
+	for _, block := range d.Blocks {
+		properties := make([]DehackedProperty, len(block.Properties))
+		for i, property := range block.Properties {
+			key := property.Key
+			if block.Type == DEHACKED_BLOCK_STRINGS {
+				key = strings.ToUpper(key)
+			}
+			if r, renamed := renames[block.Type][key]; renamed {
+				property.Key = r.key
+				if block.Type != DEHACKED_BLOCK_PARS {
+					property.Value = relabelLevelName(property.Value, r.from, r.to)
+				}
+				if block.Type == DEHACKED_BLOCK_TEXT {
+					property.Value = fitVanillaText(r.key, property.Value)
+				}
+			}
+			properties[i] = property
+		}
+		block.Properties = properties
+		moved.Blocks = append(moved.Blocks, block)
+	}
+	return moved
+}
+
+// Swaps the label of a level's old slot at the start of its name for the new slot's
+func relabelLevelName(name string, from string, to string) string {
+	label := vanillaLevelLabel(from) + ": "
+	if len(name) < len(label) || !strings.EqualFold(name[:len(label)], label) {
+		return name
+	}
+	return vanillaLevelLabel(to) + ": " + name[len(label):]
+}
+
+func isVanillaSlot(slot string) bool {
+	return doom1SlotRegexp.MatchString(slot) || doom2SlotRegexp.MatchString(slot)
+}
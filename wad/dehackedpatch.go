@@ -0,0 +1,307 @@
+package wad
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEHACKED_BLOCK_TEXT    = "Text"
+	DEHACKED_BLOCK_STRINGS = "[STRINGS]"
+	DEHACKED_BLOCK_PARS    = "[PARS]"
+)
+
+const (
+	DEHACKED_DOOM_VERSION = 19
+	DEHACKED_PATCH_FORMAT = 6
+)
+
+// Changes made by a DeHackEd or BEX patch. Text replacements are kept in a single Text block
+// keyed by the original text, and BEX sections are blocks with no ID.
+type Dehacked struct {
+	DoomVersion int
+	PatchFormat int
+	Blocks      []DehackedBlock
+}
+
+type DehackedBlock struct {
+	Type       string
+	ID         int
+	Name       string
+	Properties []DehackedProperty
+}
+
+type DehackedProperty struct {
+	Key   string
+	Value string
+}
+
+// Two patches that change the same property of the same block to different values
+type DehackedConflict struct {
+	Block    string
+	Key      string
+	Existing string
+	Incoming string
+}
+
+func (c DehackedConflict) String() string {
+	return fmt.Sprintf("%s: %s is %q in one patch and %q in another", c.Block, c.Key, c.Existing, c.Incoming)
+}
+
+// Blocks whose changes can clash between patches. Other blocks, such as Misc and Cheat, take the
+// last patch's value.
+var DEHACKED_CONFLICT_BLOCKS = []string{"Thing", "Frame", "Pointer", "Weapon", "Ammo", DEHACKED_BLOCK_TEXT, DEHACKED_BLOCK_STRINGS, "[CODEPTR]"}
+
+// BEX strings that belong to a level slot rather than to the game: level names and the text
+// shown after an episode or cluster
+var dehackedLevelStringRegexp = regexp.MustCompile(`(?i)^(?:[PT]?HUSTR_\w+|[CEPT]\d+TEXT)$`)
+
+var dehackedBlockRegexp = regexp.MustCompile(`(?i)^(Thing|Frame|Pointer|Sound|Ammo|Weapon|Sprite|Cheat|Misc)\s+(\d+)\s*(?:\((.*)\))?$`)
+var dehackedTextRegexp = regexp.MustCompile(`(?i)^Text\s+(\d+)\s+(\d+)$`)
+var dehackedSectionRegexp = regexp.MustCompile(`^\[(\w+)\]$`)
+
+func ParseDehacked(data []byte) (*Dehacked, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	d := &Dehacked{DoomVersion: DEHACKED_DOOM_VERSION, PatchFormat: DEHACKED_PATCH_FORMAT}
+
+	var block *DehackedBlock
+	lineNumber := 0
+	for len(text) > 0 {
+		line, rest, _ := strings.Cut(text, "\n")
+		text = rest
+		lineNumber++
+
+		// BEX strings continue onto the next line when they end with a backslash
+		for block != nil && block.Type == DEHACKED_BLOCK_STRINGS && strings.HasSuffix(strings.TrimSpace(line), `\`) && len(text) > 0 {
+			next, rest, _ := strings.Cut(text, "\n")
+			line = strings.TrimSuffix(strings.TrimSpace(line), `\`) + strings.TrimSpace(next)
+			text = rest
+			lineNumber++
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if parts := dehackedTextRegexp.FindStringSubmatch(line); parts != nil {
+			oldLength, _ := strconv.Atoi(parts[1])
+			newLength, _ := strconv.Atoi(parts[2])
+			if oldLength+newLength > len(text) {
+				return nil, fmt.Errorf("DEHACKED line %d: text is shorter than %d characters", lineNumber, oldLength+newLength)
+			}
+
+			d.block(DEHACKED_BLOCK_TEXT, 0, "").set(text[:oldLength], text[oldLength:oldLength+newLength])
+			lineNumber += strings.Count(text[:oldLength+newLength], "\n")
+			text = text[oldLength+newLength:]
+			block = nil
+			continue
+		}
+
+		if parts := dehackedBlockRegexp.FindStringSubmatch(line); parts != nil {
+			id, _ := strconv.Atoi(parts[2])
+			block = d.block(strings.ToUpper(parts[1][:1])+strings.ToLower(parts[1][1:]), id, parts[3])
+			continue
+		}
+
+		if parts := dehackedSectionRegexp.FindStringSubmatch(line); parts != nil {
+			block = d.block("["+strings.ToUpper(parts[1])+"]", 0, "")
+			continue
+		}
+
+		if block != nil && block.Type == DEHACKED_BLOCK_PARS {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || !strings.EqualFold(fields[0], "par") {
+				return nil, fmt.Errorf("DEHACKED line %d: expected par [episode] map seconds", lineNumber)
+			}
+			block.set(strings.Join(fields[1:len(fields)-1], " "), fields[len(fields)-1])
+			continue
+		}
+
+		key, value, isProperty := strings.Cut(line, "=")
+		if !isProperty {
+			// Vanilla DeHackEd skips lines it doesn't understand, such as the patch file header
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		if block == nil {
+			switch strings.ToLower(key) {
+			case "doom version":
+				d.DoomVersion, _ = strconv.Atoi(value)
+			case "patch format":
+				d.PatchFormat, _ = strconv.Atoi(value)
+			}
+			continue
+		}
+		block.set(key, value)
+	}
+
+	return d, nil
+}
+
+// Finds the block of this type and ID, adding it if the patch doesn't change it yet
+func (d *Dehacked) block(blockType string, id int, name string) *DehackedBlock {
+	for i, block := range d.Blocks {
+		if block.Type == blockType && block.ID == id {
+			return &d.Blocks[i]
+		}
+	}
+
+	d.Blocks = append(d.Blocks, DehackedBlock{Type: blockType, ID: id, Name: name})
+	return &d.Blocks[len(d.Blocks)-1]
+}
+
+// Property keys are case-insensitive except for Text blocks, which are keyed by the original text
+func (b DehackedBlock) Get(key string) (string, bool) {
+	for _, property := range b.Properties {
+		if property.Key == key || (b.Type != DEHACKED_BLOCK_TEXT && strings.EqualFold(property.Key, key)) {
+			return property.Value, true
+		}
+	}
+	return "", false
+}
+
+func (b *DehackedBlock) set(key string, value string) {
+	for i, property := range b.Properties {
+		if property.Key == key || (b.Type != DEHACKED_BLOCK_TEXT && strings.EqualFold(property.Key, key)) {
+			b.Properties[i].Value = value
+			return
+		}
+	}
+	b.Properties = append(b.Properties, DehackedProperty{Key: key, Value: value})
+}
+
+func (b DehackedBlock) String() string {
+	if b.Type == DEHACKED_BLOCK_TEXT || strings.HasPrefix(b.Type, "[") {
+		return b.Type
+	}
+	return fmt.Sprintf("%s %d", b.Type, b.ID)
+}
+
+func (d Dehacked) IsEmpty() bool {
+	return !slices.ContainsFunc(d.Blocks, func(block DehackedBlock) bool {
+		return len(block.Properties) > 0
+	})
+}
+
+// The patch without the level names, par times and intermission text it sets. These belong to
+// the slots the levels were in, so they're generated from LevelInfo instead when levels move.
+func (d Dehacked) WithoutLevelStrings() Dehacked {
+	levelTexts := []string{strings.Join(E1_END_TEXT, "\n"), strings.Join(E2_END_TEXT, "\n"), strings.Join(E3_END_TEXT, "\n"), strings.Join(E4_END_TEXT, "\n")}
+	for _, name := range VANILLA_LEVEL_NAMES {
+		levelTexts = append(levelTexts, name)
+	}
+
+	stripped := Dehacked{DoomVersion: d.DoomVersion, PatchFormat: d.PatchFormat, Blocks: []DehackedBlock{}}
+	for _, block := range d.Blocks {
+		if block.Type == DEHACKED_BLOCK_PARS {
+			continue
+		}
+
+		properties := []DehackedProperty{}
+		for _, property := range block.Properties {
+			isLevelString := (block.Type == DEHACKED_BLOCK_TEXT && slices.Contains(levelTexts, property.Key)) ||
+				(block.Type == DEHACKED_BLOCK_STRINGS && dehackedLevelStringRegexp.MatchString(property.Key))
+			if !isLevelString {
+				properties = append(properties, property)
+			}
+		}
+		block.Properties = properties
+		stripped.Blocks = append(stripped.Blocks, block)
+	}
+	return stripped
+}
+
+// Properties both patches change to different values, in the blocks listed in
+// DEHACKED_CONFLICT_BLOCKS
+func (d Dehacked) Conflicts(other Dehacked) []DehackedConflict {
+	conflicts := []DehackedConflict{}
+	for _, otherBlock := range other.Blocks {
+		if !slices.Contains(DEHACKED_CONFLICT_BLOCKS, otherBlock.Type) {
+			continue
+		}
+
+		index := slices.IndexFunc(d.Blocks, func(block DehackedBlock) bool {
+			return block.Type == otherBlock.Type && block.ID == otherBlock.ID
+		})
+		if index < 0 {
+			continue
+		}
+
+		for _, property := range otherBlock.Properties {
+			existing, changed := d.Blocks[index].Get(property.Key)
+			if changed && existing != property.Value {
+				conflicts = append(conflicts, DehackedConflict{
+					Block:    otherBlock.String(),
+					Key:      property.Key,
+					Existing: existing,
+					Incoming: property.Value,
+				})
+			}
+		}
+	}
+	return conflicts
+}
+
+// Adds the other patch's changes to this one. Where both change the same property, the
+// other patch wins, so check Conflicts first to avoid that.
+func (d *Dehacked) Merge(other Dehacked) {
+	for _, otherBlock := range other.Blocks {
+		block := d.block(otherBlock.Type, otherBlock.ID, otherBlock.Name)
+		if block.Name == "" {
+			block.Name = otherBlock.Name
+		}
+		for _, property := range otherBlock.Properties {
+			block.set(property.Key, property.Value)
+		}
+	}
+}
+
+func (d Dehacked) Bytes() []byte {
+	builder := strings.Builder{}
+	builder.WriteString("Patch File for DeHackEd v3.0\n")
+	builder.WriteString(fmt.Sprintf("Doom version = %d\n", d.DoomVersion))
+	builder.WriteString(fmt.Sprintf("Patch format = %d\n", d.PatchFormat))
+
+	// BEX sections go after the vanilla blocks, so vanilla tools reading the patch see those first
+	blocks := slices.Clone(d.Blocks)
+	slices.SortStableFunc(blocks, func(a DehackedBlock, b DehackedBlock) int {
+		return strings.Compare(fmt.Sprint(strings.HasPrefix(a.Type, "[")), fmt.Sprint(strings.HasPrefix(b.Type, "[")))
+	})
+
+	for _, block := range blocks {
+		if len(block.Properties) == 0 {
+			continue
+		}
+
+		switch {
+		case block.Type == DEHACKED_BLOCK_TEXT:
+			for _, property := range block.Properties {
+				builder.WriteString(fmt.Sprintf("\nText %d %d\n%s%s\n", len(property.Key), len(property.Value), property.Key, property.Value))
+			}
+			continue
+		case block.Type == DEHACKED_BLOCK_PARS:
+			builder.WriteString("\n" + block.Type + "\n")
+			for _, property := range block.Properties {
+				builder.WriteString(fmt.Sprintf("par %s %s\n", property.Key, property.Value))
+			}
+			continue
+		case strings.HasPrefix(block.Type, "["):
+			builder.WriteString("\n" + block.Type + "\n")
+		case block.Name != "":
+			builder.WriteString(fmt.Sprintf("\n%s %d (%s)\n", block.Type, block.ID, block.Name))
+		default:
+			builder.WriteString(fmt.Sprintf("\n%s %d\n", block.Type, block.ID))
+		}
+
+		for _, property := range block.Properties {
+			builder.WriteString(fmt.Sprintf("%s = %s\n", property.Key, property.Value))
+		}
+	}
+
+	return []byte(builder.String())
+}
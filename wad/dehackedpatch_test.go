@@ -0,0 +1,153 @@
+package wad
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDehacked(t *testing.T) {
+	data := "Patch File for DeHackEd v3.0\r\n" +
+		"# Comment\r\n" +
+		"Doom version = 21\r\n" +
+		"Patch format = 6\r\n" +
+		"\r\n" +
+		"Thing 1 (Player)\r\n" +
+		"Initial health = 200\r\n" +
+		"\r\n" +
+		"frame 12\r\n" +
+		"Duration = 4\r\n" +
+		"\r\n" +
+		"Text 12 5\r\n" +
+		"E1M1: HangarStart\r\n" +
+		"[STRINGS]\r\n" +
+		"GOTARMOR = Got \\\r\n" +
+		"  the armor.\r\n" +
+		"\r\n" +
+		"[PARS]\r\n" +
+		"par 1 1 30\r\n" +
+		"par 7 120\r\n"
+
+	want := &Dehacked{
+		DoomVersion: 21,
+		PatchFormat: 6,
+		Blocks: []DehackedBlock{
+			{Type: "Thing", ID: 1, Name: "Player", Properties: []DehackedProperty{{Key: "Initial health", Value: "200"}}},
+			{Type: "Frame", ID: 12, Properties: []DehackedProperty{{Key: "Duration", Value: "4"}}},
+			{Type: DEHACKED_BLOCK_TEXT, Properties: []DehackedProperty{{Key: "E1M1: Hangar", Value: "Start"}}},
+			{Type: DEHACKED_BLOCK_STRINGS, Properties: []DehackedProperty{{Key: "GOTARMOR", Value: "Got the armor."}}},
+			{Type: DEHACKED_BLOCK_PARS, Properties: []DehackedProperty{{Key: "1 1", Value: "30"}, {Key: "7", Value: "120"}}},
+		},
+	}
+
+	patch, err := ParseDehacked([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseDehacked() error = %v", err)
+	}
+	if !reflect.DeepEqual(patch, want) {
+		t.Errorf("ParseDehacked() = %+v, want %+v", patch.Blocks, want.Blocks)
+	}
+
+	reparsed, err := ParseDehacked(patch.Bytes())
+	if err != nil {
+		t.Fatalf("ParseDehacked(Bytes()) error = %v\n%s", err, patch.Bytes())
+	}
+	if !reflect.DeepEqual(reparsed, patch) {
+		t.Errorf("ParseDehacked(Bytes()) = %+v, want %+v", reparsed, patch)
+	}
+}
+
+func TestParseDehackedErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "short text", data: "Text 12 5\nE1M1: Hang"},
+		{name: "bad par", data: "[PARS]\npar 30\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseDehacked([]byte(test.data))
+			if err == nil {
+				t.Errorf("ParseDehacked() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestDehackedConflicts(t *testing.T) {
+	base := dehackedPatch(t, "Thing 1\nInitial health = 200\n\nMisc 0\nMax health = 200\n\n[STRINGS]\nGOTARMOR = Armor!\nHUSTR_1 = Base level\n")
+
+	tests := []struct {
+		name  string
+		other string
+		want  []DehackedConflict
+	}{
+		{name: "same values", other: "Thing 1\nInitial health = 200\n"},
+		{name: "different things", other: "Thing 2\nInitial health = 50\n"},
+		{
+			name:  "thing property",
+			other: "Thing 1\ninitial HEALTH = 100\n",
+			want:  []DehackedConflict{{Block: "Thing 1", Key: "initial HEALTH", Existing: "200", Incoming: "100"}},
+		},
+		{
+			name:  "string",
+			other: "[STRINGS]\nGOTARMOR = Armour!\n",
+			want:  []DehackedConflict{{Block: DEHACKED_BLOCK_STRINGS, Key: "GOTARMOR", Existing: "Armor!", Incoming: "Armour!"}},
+		},
+		{name: "misc isn't a conflict", other: "Misc 0\nMax health = 100\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conflicts := base.Conflicts(*dehackedPatch(t, test.other))
+			if len(conflicts) != len(test.want) || (len(conflicts) > 0 && !reflect.DeepEqual(conflicts, test.want)) {
+				t.Errorf("Conflicts() = %v, want %v", conflicts, test.want)
+			}
+		})
+	}
+}
+
+func TestDehackedMerge(t *testing.T) {
+	patch := dehackedPatch(t, "Thing 1\nInitial health = 200\n\n[STRINGS]\nGOTARMOR = Armor!\n")
+	patch.Merge(*dehackedPatch(t, "Thing 1 (Player)\nSpeed = 8\n\nThing 2\nHit points = 50\n\n[STRINGS]\nGOTARMOR = Armour!\n"))
+
+	want := dehackedPatch(t, "Thing 1 (Player)\nInitial health = 200\nSpeed = 8\n\n[STRINGS]\nGOTARMOR = Armour!\n\nThing 2\nHit points = 50\n")
+	if !reflect.DeepEqual(patch, want) {
+		t.Errorf("Merge() = %+v, want %+v", patch, want)
+	}
+}
+
+func TestDehackedWithoutLevelStrings(t *testing.T) {
+	data := "Thing 1\nInitial health = 200\n\n" +
+		"Text 12 6\nE1M1: HangarMy map\n" +
+		"Text 17 4\nlevel 1: entrywayOops\n" +
+		"Text 5 5\nArmorArmor\n" +
+		"[STRINGS]\nHUSTR_E1M1 = My map\nHUSTR_1 = My map\nPHUSTR_1 = My map\nTHUSTR_1 = My map\nC1TEXT = Done\nE2TEXT = Done\nGOTARMOR = Armor!\n\n" +
+		"[PARS]\npar 1 30\n"
+	patch := dehackedPatch(t, data)
+
+	stripped := patch.WithoutLevelStrings()
+	want := dehackedPatch(t, "Thing 1\nInitial health = 200\n\nText 5 5\nArmorArmor\n[STRINGS]\nGOTARMOR = Armor!\n")
+	if !reflect.DeepEqual(stripped.Blocks[:3], want.Blocks) {
+		t.Errorf("WithoutLevelStrings() = %+v, want %+v", stripped.Blocks, want.Blocks)
+	}
+	if strings.Contains(string(stripped.Bytes()), "[PARS]") {
+		t.Errorf("WithoutLevelStrings() kept the par times:\n%s", stripped.Bytes())
+	}
+
+	// The original patch is left alone
+	if reparsed := dehackedPatch(t, data); !reflect.DeepEqual(patch, reparsed) {
+		t.Errorf("WithoutLevelStrings() changed the patch to %+v", patch)
+	}
+}
+
+func dehackedPatch(t *testing.T, data string) *Dehacked {
+	t.Helper()
+	patch, err := ParseDehacked([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseDehacked() error = %v", err)
+	}
+	return patch
+}
@@ -0,0 +1,176 @@
+package wad
+
+type Skill int
+
+const (
+	SKILL_EASY Skill = iota
+	SKILL_MEDIUM
+	SKILL_HARD
+)
+
+var SKILLS = []Skill{SKILL_EASY, SKILL_MEDIUM, SKILL_HARD}
+
+func (s Skill) String() string {
+	switch s {
+	case SKILL_EASY:
+		return "easy"
+	case SKILL_MEDIUM:
+		return "medium"
+	case SKILL_HARD:
+		return "hard"
+	}
+
+	return "unknown"
+}
+
+func (s Skill) thingFlag() int16 {
+	switch s {
+	case SKILL_EASY:
+		return THING_FLAG_EASY
+	case SKILL_MEDIUM:
+		return THING_FLAG_MEDIUM
+	case SKILL_HARD:
+		return THING_FLAG_HARD
+	}
+
+	return 0
+}
+
+type Ammo struct {
+	Bullets int
+	Shells  int
+	Rockets int
+	Cells   int
+}
+
+func (a Ammo) add(other Ammo) Ammo {
+	return Ammo{
+		Bullets: a.Bullets + other.Bullets,
+		Shells:  a.Shells + other.Shells,
+		Rockets: a.Rockets + other.Rockets,
+		Cells:   a.Cells + other.Cells,
+	}
+}
+
+// Rough average damage dealt per unit of ammo with the weapon that uses it
+const (
+	DAMAGE_PER_BULLET = 10
+	DAMAGE_PER_SHELL  = 70
+	DAMAGE_PER_ROCKET = 150
+	DAMAGE_PER_CELL   = 22
+)
+
+func (a Ammo) Damage() int {
+	return a.Bullets*DAMAGE_PER_BULLET + a.Shells*DAMAGE_PER_SHELL + a.Rockets*DAMAGE_PER_ROCKET + a.Cells*DAMAGE_PER_CELL
+}
+
+// Resources every player has available when starting a level from a pistol start
+const (
+	PISTOL_START_HEALTH  = 100
+	PISTOL_START_BULLETS = 50
+)
+
+var MONSTER_HEALTH = map[int16]int{
+	ENEMY_PISTOL:      20,
+	ENEMY_SHOTGUN:     30,
+	ENEMY_CHAINGUNNER: 70,
+	ENEMY_SS:          50,
+	ENEMY_IMP:         60,
+	ENEMY_PINKY:       150,
+	ENEMY_SPECTRE:     150,
+	ENEMY_SOUL:        100,
+	ENEMY_CACO:        400,
+	ENEMY_PAIN:        400,
+	ENEMY_KNIGHT:      500,
+	ENEMY_BARON:       1000,
+	ENEMY_ARACH:       500,
+	ENEMY_REVENANT:    300,
+	ENEMY_MANCUBUS:    600,
+	ENEMY_ARCHVILE:    700,
+	ENEMY_SPIDER:      3000,
+	ENEMY_CYBERDEMON:  4000,
+	ENEMY_KEEN:        100,
+}
+
+var AMMO_PICKUPS = map[int16]Ammo{
+	THING_CLIP:      {Bullets: 10},
+	THING_BULLETS:   {Bullets: 50},
+	THING_SHELLS:    {Shells: 4},
+	THING_SHELLBOX:  {Shells: 20},
+	THING_ROCKET:    {Rockets: 1},
+	THING_ROCKETBOX: {Rockets: 5},
+	THING_CELL:      {Cells: 20},
+	THING_CELLPACK:  {Cells: 100},
+	THING_BACKPACK:  {Bullets: 10, Shells: 4, Rockets: 1, Cells: 20},
+	THING_SHOTGUN:   {Shells: 8},
+	THING_SSG:       {Shells: 8},
+	THING_CHAINGUN:  {Bullets: 20},
+	THING_LAUNCHER:  {Rockets: 2},
+	THING_PLASMA:    {Cells: 40},
+	THING_BFG:       {Cells: 40},
+}
+
+var HEALTH_PICKUPS = map[int16]int{
+	THING_HEALTH:     1,
+	THING_STIM:       10,
+	THING_MEDKIT:     25,
+	THING_SOULSPHERE: 100,
+	THING_MEGASPHERE: 100,
+	THING_BERSERK:    100,
+}
+
+var ARMOR_PICKUPS = map[int16]int{
+	THING_ARMOR:      1,
+	THING_GREENARMOR: 100,
+	THING_BLUEARMOR:  200,
+	THING_MEGASPHERE: 200,
+}
+
+type SkillStats struct {
+	Skill         Skill
+	Monsters      int
+	MonsterHealth int
+	Ammo          Ammo
+	Health        int
+	Armor         int
+	Score         float64
+}
+
+func (l Level) Analyze(skill Skill) SkillStats {
+	stats := SkillStats{Skill: skill}
+
+	for _, thing := range l.ThingsAsDoom() {
+		// Skip things that don't appear in single player on this skill
+		if thing.Flags&skill.thingFlag() == 0 || thing.Flags&THING_FLAG_MULTIPLAYER != 0 {
+			continue
+		}
+
+		if health, isMonster := MONSTER_HEALTH[thing.Type]; isMonster {
+			stats.Monsters++
+			stats.MonsterHealth += health
+		}
+		stats.Ammo = stats.Ammo.add(AMMO_PICKUPS[thing.Type])
+		stats.Health += HEALTH_PICKUPS[thing.Type]
+		stats.Armor += ARMOR_PICKUPS[thing.Type]
+	}
+
+	stats.Score = difficultyScore(stats)
+	return stats
+}
+
+// The score is the amount of monster health the player has to deal with per point of
+// health and armor they can get, scaled up by how far the available ammo falls short
+// of killing everything. It is only meaningful when comparing levels against each other.
+func difficultyScore(stats SkillStats) float64 {
+	if stats.MonsterHealth == 0 {
+		return 0
+	}
+
+	survivability := float64(PISTOL_START_HEALTH + stats.Health + stats.Armor)
+	pressure := float64(stats.MonsterHealth) / survivability
+
+	damage := stats.Ammo.add(Ammo{Bullets: PISTOL_START_BULLETS}).Damage()
+	scarcity := float64(stats.MonsterHealth) / float64(damage)
+
+	return pressure * (1 + scarcity)
+}
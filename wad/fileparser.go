@@ -3,10 +3,11 @@
 import (
 	"encoding/binary"
 	"io"
-	"os"
+	"slices"
 )
 
 const SIZE_HEADER int = 12
+const SIZE_DIRECTORY_ENTRY = 16
 
 type fileHeader struct {
 	Identifier      [4]byte
@@ -20,37 +21,28 @@ type fileDirectoryEntry struct {
 	LumpName   [8]byte
 }
 
-func parseHeader(f *os.File) (fileHeader, error) {
+func parseHeader(r io.ReaderAt) (fileHeader, error) {
 	header := fileHeader{}
 
-	// Position cursor at beginning of file
-	_, err := f.Seek(0, io.SeekStart)
-	if err != nil {
-		return header, err
-	}
-
 	// Read the file header
-	err = binary.Read(f, binary.LittleEndian, &header)
+	err := binary.Read(io.NewSectionReader(r, 0, int64(SIZE_HEADER)), binary.LittleEndian, &header)
 	if err != nil {
 		return header, err
 	}
 	return header, nil
 }
 
-func parseDirectory(f *os.File, offset int32, count int32) ([]fileDirectoryEntry, error) {
+func parseDirectory(r io.ReaderAt, offset int32, count int32) ([]fileDirectoryEntry, error) {
 	directory := make([]fileDirectoryEntry, 0, count)
 
-	// Position cursor at beginning of lump directory
-	_, err := f.Seek(int64(offset), io.SeekStart)
-	if err != nil {
-		return directory, err
-	}
+	// Section of the file holding the lump directory
+	section := io.NewSectionReader(r, int64(offset), int64(count)*SIZE_DIRECTORY_ENTRY)
 
 	// For each lump...
 	for i := int32(0); i < count; i++ {
 		// Read the directory entry for this lump
 		entry := fileDirectoryEntry{}
-		err = binary.Read(f, binary.LittleEndian, &entry)
+		err := binary.Read(section, binary.LittleEndian, &entry)
 		if err != nil {
 			return directory, err
 		}
@@ -61,44 +53,38 @@ func parseDirectory(f *os.File, offset int32, count int32) ([]fileDirectoryEntry
 	return directory, nil
 }
 
-func parseLumpData(f *os.File, offset int32, length int32) ([]byte, error) {
-	lumpData := make([]byte, length)
-
-	// Position cursor at beginning of lump data
-	_, err := f.Seek(int64(offset), io.SeekStart)
-	if err != nil {
-		return lumpData, err
+func parseLumpData(r io.ReaderAt, offset int32, length int32) ([]byte, error) {
+	// Markers and other empty lumps can point at the end of the file, where ReadAt returns io.EOF
+	if length == 0 {
+		return []byte{}, nil
 	}
 
+	lumpData := make([]byte, length)
+
 	// Read the lump data
-	err = binary.Read(f, binary.LittleEndian, lumpData)
+	_, err := r.ReadAt(lumpData, int64(offset))
 	if err != nil {
 		return lumpData, err
 	}
 	return lumpData, nil
 }
 
-func parseLevel(f *os.File, levelSlot string, levelDirEntries []fileDirectoryEntry) (Level, error) {
+func parseLevel(r io.ReaderAt, levelSlot string, levelDirEntries []fileDirectoryEntry) (Level, error) {
 	dataMap := map[string][]byte{}
+	extraLumps := []Lump{}
 
 	for _, dir := range levelDirEntries {
 
 		lumpName := nameToStr(dir.LumpName[:])
-		lumpData, err := parseLumpData(f, dir.DataOffset, dir.DataLength)
+		lumpData, err := parseLumpData(r, dir.DataOffset, dir.DataLength)
 		if err != nil {
-			return Level{}, err
+			return Level{}, &MapError{Slot: levelSlot, Lump: lumpName, Err: err}
 		}
 
-		dataMap[lumpName] = lumpData
-	}
-
-	levelInfo, knownLevelSlot := DEFAULT_LEVELINFOS[levelSlot]
-	if !knownLevelSlot {
-		levelInfo = LevelInfo{
-			Name:       "Unknown",
-			Label:      levelSlot,
-			Next:       levelSlot,
-			NextSecret: levelSlot,
+		if slices.Contains(MAP_LUMP_NAMES, lumpName) {
+			dataMap[lumpName] = lumpData
+		} else {
+			extraLumps = append(extraLumps, Lump{Name: lumpName, Data: lumpData})
 		}
 	}
 
@@ -107,15 +93,111 @@ func parseLevel(f *os.File, levelSlot string, levelDirEntries []fileDirectoryEnt
 		Things:     parseThings(dataMap[LUMP_THINGS]),
 		Linedefs:   parseLinedefs(dataMap[LUMP_LINEDEFS]),
 		Sidedefs:   parseSidedefs(dataMap[LUMP_SIDEDEFS]),
-		Vertexes:   dataMap[LUMP_VERTEXES],
-		Segments:   dataMap[LUMP_SEGMENTS],
-		Subsectors: dataMap[LUMP_SUBSECTORS],
-		Nodes:      dataMap[LUMP_NODES],
-		Sectors:    dataMap[LUMP_SECTORS],
+		Vertexes:   parseVertexes(dataMap[LUMP_VERTEXES]),
+		Segments:   parseSegs(dataMap[LUMP_SEGMENTS]),
+		Subsectors: parseSubsectors(dataMap[LUMP_SUBSECTORS]),
+		Nodes:      parseNodes(dataMap[LUMP_NODES]),
+		Sectors:    parseSectors(dataMap[LUMP_SECTORS]),
 		Reject:     dataMap[LUMP_REJECT],
 		Blockmap:   dataMap[LUMP_BLOCKMAP],
-		LevelInfo:  levelInfo,
+		LevelInfo:  defaultLevelInfo(levelSlot),
+		ExtraLumps: extraLumps,
+	}
+
+	// Extended nodes have their own vertexes and segs, so they can't be read as vanilla nodes
+	if isExtendedNodes(dataMap[LUMP_NODES]) {
+		level.Nodes = []Node{}
+		level.ExtendedNodes = dataMap[LUMP_NODES]
+	}
+
+	// Only Hexen-format levels have a BEHAVIOR lump, even if it's empty
+	if behavior, isHexen := dataMap[LUMP_BEHAVIOR]; isHexen {
+		level.Format = LEVEL_FORMAT_HEXEN
+		level.Things = []Thing{}
+		level.Linedefs = []Linedef{}
+		level.HexenThings = parseHexenThings(dataMap[LUMP_THINGS])
+		level.HexenLinedefs = parseHexenLinedefs(dataMap[LUMP_LINEDEFS])
+		level.Behavior = behavior
+		level.Scripts = dataMap[LUMP_SCRIPTS]
+	}
+
+	// Optional lumps the level doesn't have aren't added when it's saved, and bytes that don't
+	// make up a whole record are kept, so an unchanged level is written back as it was read
+	for _, name := range MAP_LUMP_NAMES {
+		if _, exists := dataMap[name]; !exists && name != LUMP_BEHAVIOR && name != LUMP_SCRIPTS {
+			level.missingLumps = append(level.missingLumps, name)
+		}
+	}
+
+	recordSizes := map[string]int{
+		LUMP_THINGS:     SIZE_THING,
+		LUMP_LINEDEFS:   SIZE_LINEDEF,
+		LUMP_SIDEDEFS:   SIZE_SIDEDEF,
+		LUMP_VERTEXES:   SIZE_VERTEX,
+		LUMP_SEGMENTS:   SIZE_SEG,
+		LUMP_SUBSECTORS: SIZE_SUBSECTOR,
+		LUMP_SECTORS:    SIZE_SECTOR,
+	}
+	if level.ExtendedNodes == nil {
+		recordSizes[LUMP_NODES] = SIZE_NODE
+	}
+	if level.Format == LEVEL_FORMAT_HEXEN {
+		recordSizes[LUMP_THINGS] = SIZE_HEXEN_THING
+		recordSizes[LUMP_LINEDEFS] = SIZE_HEXEN_LINEDEF
+	}
+	for name, size := range recordSizes {
+		data := dataMap[name]
+		if partial := len(data) % size; partial > 0 {
+			if level.partialRecords == nil {
+				level.partialRecords = map[string][]byte{}
+			}
+			level.partialRecords[name] = data[len(data)-partial:]
+		}
+	}
+
+	return level, nil
+}
+
+// UDMF levels are a TEXTMAP lump followed by any number of other lumps up to the ENDMAP lump,
+// which isn't included in levelDirEntries
+func parseUDMFLevel(r io.ReaderAt, levelSlot string, levelDirEntries []fileDirectoryEntry) (Level, error) {
+	level := Level{
+		Slot:       levelSlot,
+		Format:     LEVEL_FORMAT_UDMF,
+		ExtraLumps: []Lump{},
+		LevelInfo:  defaultLevelInfo(levelSlot),
+	}
+
+	for _, dir := range levelDirEntries {
+		lumpName := nameToStr(dir.LumpName[:])
+		lumpData, err := parseLumpData(r, dir.DataOffset, dir.DataLength)
+		if err != nil {
+			return Level{}, &MapError{Slot: levelSlot, Lump: lumpName, Err: err}
+		}
+
+		if lumpName == LUMP_TEXTMAP {
+			level.TextMap, err = ParseTextMap(lumpData)
+			if err != nil {
+				return Level{}, &MapError{Slot: levelSlot, Lump: lumpName, Err: err}
+			}
+		} else {
+			level.ExtraLumps = append(level.ExtraLumps, Lump{Name: lumpName, Data: lumpData})
+		}
 	}
 
 	return level, nil
 }
+
+func defaultLevelInfo(levelSlot string) LevelInfo {
+	levelInfo, knownLevelSlot := DEFAULT_LEVELINFOS[levelSlot]
+	if !knownLevelSlot {
+		levelInfo = LevelInfo{
+			Name:       "Unknown",
+			Label:      levelSlot,
+			Next:       levelSlot,
+			NextSecret: levelSlot,
+		}
+	}
+
+	return levelInfo
+}
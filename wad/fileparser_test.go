@@ -0,0 +1,38 @@
+package wad
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestParseLumpData(t *testing.T) {
+	data := []byte("PWAD lump data")
+
+	tests := []struct {
+		name    string
+		offset  int32
+		length  int32
+		want    []byte
+		wantErr error
+	}{
+		{name: "lump", offset: 5, length: 4, want: []byte("lump")},
+		{name: "empty lump", offset: 5, length: 0, want: []byte{}},
+		{name: "empty lump at end of file", offset: int32(len(data)), length: 0, want: []byte{}},
+		{name: "lump past end of file", offset: 10, length: 8, wantErr: io.EOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lumpData, err := parseLumpData(bytes.NewReader(data), test.offset, test.length)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("parseLumpData() error = %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr == nil && !slices.Equal(lumpData, test.want) {
+				t.Errorf("parseLumpData() = %q, want %q", lumpData, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const SIZE_HEXEN_LINEDEF int = 16
+
+const (
+	HEXEN_LINEDEF_FLAG_REPEAT_SPECIAL int16 = 0x0200
+	HEXEN_LINEDEF_ACTIVATION_MASK     int16 = 0x1c00
+	HEXEN_LINEDEF_ACTIVATION_SHIFT          = 10
+	HEXEN_LINEDEF_FLAG_MONSTERS_USE   int16 = 0x2000
+	HEXEN_LINEDEF_FLAG_BLOCK_PLAYERS  int16 = 0x4000
+	HEXEN_LINEDEF_FLAG_BLOCK_ALL      int16 = -0x8000
+)
+
+// Exit_Secret in ZDoom's Hexen-format action specials
+const HEXEN_SECRET_EXIT_SPECIAL uint8 = 244
+
+type HexenLinedefs []HexenLinedef
+type HexenLinedef struct {
+	Start   int16
+	End     int16
+	Flags   int16
+	Special uint8
+	Args    [5]uint8
+	Front   int16
+	Back    int16
+}
+
+func (l *HexenLinedef) fromBytes(data []byte) {
+	l.Start = int16(binary.LittleEndian.Uint16(data[0:2]))
+	l.End = int16(binary.LittleEndian.Uint16(data[2:4]))
+	l.Flags = int16(binary.LittleEndian.Uint16(data[4:6]))
+	l.Special = data[6]
+	copy(l.Args[:], data[7:12])
+	l.Front = int16(binary.LittleEndian.Uint16(data[12:14]))
+	l.Back = int16(binary.LittleEndian.Uint16(data[14:16]))
+}
+
+func (l HexenLinedef) toBytes() []byte {
+	lbytes := [SIZE_HEXEN_LINEDEF]byte{}
+	binary.LittleEndian.PutUint16(lbytes[0:2], uint16(l.Start))
+	binary.LittleEndian.PutUint16(lbytes[2:4], uint16(l.End))
+	binary.LittleEndian.PutUint16(lbytes[4:6], uint16(l.Flags))
+	lbytes[6] = l.Special
+	copy(lbytes[7:12], l.Args[:])
+	binary.LittleEndian.PutUint16(lbytes[12:14], uint16(l.Front))
+	binary.LittleEndian.PutUint16(lbytes[14:16], uint16(l.Back))
+
+	return lbytes[:]
+}
+
+// Only the geometry and the flags shared with Doom carry over. Hexen specials have
+// different meanings, so the special number is kept only to mark the line as special.
+func (l HexenLinedef) toLinedef() Linedef {
+	return Linedef{
+		Start:       l.Start,
+		End:         l.End,
+		Flags:       l.Flags & 0x01ff,
+		SpecialType: int16(l.Special),
+		Front:       l.Front,
+		Back:        l.Back,
+	}
+}
+
+func parseHexenLinedefs(data []byte) []HexenLinedef {
+	numLinedefs := len(data) / SIZE_HEXEN_LINEDEF
+	linedefs := make([]HexenLinedef, numLinedefs)
+
+	buf := bytes.NewBuffer(data)
+	for i, l := range linedefs {
+		lbytes := buf.Next(SIZE_HEXEN_LINEDEF)
+		l.fromBytes(lbytes)
+		linedefs[i] = l
+	}
+
+	return linedefs
+}
+
+func (linedefs HexenLinedefs) toLump() Lump {
+	buf := make([]byte, 0, len(linedefs)*SIZE_HEXEN_LINEDEF)
+	for _, l := range linedefs {
+		lbytes := l.toBytes()
+		buf = append(buf, lbytes...)
+	}
+
+	return Lump{
+		Name: LUMP_LINEDEFS,
+		Data: buf,
+	}
+}
@@ -0,0 +1,102 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const SIZE_HEXEN_THING int = 20
+
+const (
+	HEXEN_THING_FLAG_DORMANT    int16 = 0x0010
+	HEXEN_THING_FLAG_FIGHTER    int16 = 0x0020
+	HEXEN_THING_FLAG_CLERIC     int16 = 0x0040
+	HEXEN_THING_FLAG_MAGE       int16 = 0x0080
+	HEXEN_THING_FLAG_SINGLE     int16 = 0x0100
+	HEXEN_THING_FLAG_COOP       int16 = 0x0200
+	HEXEN_THING_FLAG_DEATHMATCH int16 = 0x0400
+)
+
+type HexenThings []HexenThing
+type HexenThing struct {
+	TID     int16
+	X       int16
+	Y       int16
+	Z       int16
+	Angle   int16
+	Type    int16
+	Flags   int16
+	Special uint8
+	Args    [5]uint8
+}
+
+func (t *HexenThing) fromBytes(data []byte) {
+	t.TID = int16(binary.LittleEndian.Uint16(data[0:2]))
+	t.X = int16(binary.LittleEndian.Uint16(data[2:4]))
+	t.Y = int16(binary.LittleEndian.Uint16(data[4:6]))
+	t.Z = int16(binary.LittleEndian.Uint16(data[6:8]))
+	t.Angle = int16(binary.LittleEndian.Uint16(data[8:10]))
+	t.Type = int16(binary.LittleEndian.Uint16(data[10:12]))
+	t.Flags = int16(binary.LittleEndian.Uint16(data[12:14]))
+	t.Special = data[14]
+	copy(t.Args[:], data[15:20])
+}
+
+func (t HexenThing) toBytes() []byte {
+	tbytes := [SIZE_HEXEN_THING]byte{}
+	binary.LittleEndian.PutUint16(tbytes[0:2], uint16(t.TID))
+	binary.LittleEndian.PutUint16(tbytes[2:4], uint16(t.X))
+	binary.LittleEndian.PutUint16(tbytes[4:6], uint16(t.Y))
+	binary.LittleEndian.PutUint16(tbytes[6:8], uint16(t.Z))
+	binary.LittleEndian.PutUint16(tbytes[8:10], uint16(t.Angle))
+	binary.LittleEndian.PutUint16(tbytes[10:12], uint16(t.Type))
+	binary.LittleEndian.PutUint16(tbytes[12:14], uint16(t.Flags))
+	tbytes[14] = t.Special
+	copy(tbytes[15:20], t.Args[:])
+
+	return tbytes[:]
+}
+
+// Skill and ambush flags match Doom's, but Hexen marks the game modes a thing appears in
+// rather than marking it as multiplayer-only
+func (t HexenThing) toThing() Thing {
+	flags := t.Flags & (THING_FLAG_EASY | THING_FLAG_MEDIUM | THING_FLAG_HARD | THING_FLAG_AMBUSH)
+	if t.Flags&HEXEN_THING_FLAG_SINGLE == 0 {
+		flags |= THING_FLAG_MULTIPLAYER
+	}
+
+	return Thing{
+		X:     t.X,
+		Y:     t.Y,
+		Angle: t.Angle,
+		Type:  t.Type,
+		Flags: flags,
+	}
+}
+
+func parseHexenThings(data []byte) []HexenThing {
+	numThings := len(data) / SIZE_HEXEN_THING
+	things := make([]HexenThing, numThings)
+
+	buf := bytes.NewBuffer(data)
+	for i, t := range things {
+		tbytes := buf.Next(SIZE_HEXEN_THING)
+		t.fromBytes(tbytes)
+		things[i] = t
+	}
+
+	return things
+}
+
+func (things HexenThings) toLump() Lump {
+	buf := make([]byte, 0, len(things)*SIZE_HEXEN_THING)
+	for _, t := range things {
+		tbytes := t.toBytes()
+		buf = append(buf, tbytes...)
+	}
+
+	return Lump{
+		Name: LUMP_THINGS,
+		Data: buf,
+	}
+}
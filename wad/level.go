@@ -1,29 +1,163 @@
 package wad
 
-import "slices"
+import (
+	"io"
+	"slices"
+)
+
+type LevelFormat int
+
+const (
+	LEVEL_FORMAT_DOOM LevelFormat = iota
+	LEVEL_FORMAT_UDMF
+	LEVEL_FORMAT_HEXEN
+)
+
+func (f LevelFormat) String() string {
+	switch f {
+	case LEVEL_FORMAT_DOOM:
+		return "doom"
+	case LEVEL_FORMAT_UDMF:
+		return "udmf"
+	case LEVEL_FORMAT_HEXEN:
+		return "hexen"
+	}
+
+	return "unknown"
+}
 
 type Level struct {
 	Slot       string
+	Format     LevelFormat
 	Things     []Thing
 	Linedefs   []Linedef
 	Sidedefs   []Sidedef
-	Vertexes   []byte
-	Segments   []byte
-	Subsectors []byte
-	Nodes      []byte
-	Sectors    []byte
+	Vertexes   []Vertex
+	Segments   []Seg
+	Subsectors []Subsector
+	Nodes      []Node
+	Sectors    []Sector
 	Reject     []byte
 	Blockmap   []byte
 	LevelInfo  LevelInfo
+
+	// Hexen-format levels keep their things and linedefs here rather than in Things and Linedefs.
+	// Scripts is nil when the level has no SCRIPTS lump.
+	HexenThings   []HexenThing
+	HexenLinedefs []HexenLinedef
+	Behavior      []byte
+	Scripts       []byte
+
+	// UDMF levels keep their geometry here rather than in the binary lumps above
+	TextMap *TextMap
+
+	// NODES in one of ZDoom's extended formats, which is kept as it is rather than parsed into
+	// Nodes. Nil when the level has vanilla nodes.
+	ExtendedNodes []byte
+
+	// Lumps belonging to the level that wado doesn't parse, such as ZNODES
+	ExtraLumps []Lump
+
+	// Optional lumps the level was read without, which aren't written until they're built
+	missingLumps []string
+
+	// Bytes at the end of a lump that don't make up a whole record, which are written back after
+	// the records so the lump is saved as it was read
+	partialRecords map[string][]byte
+
+	// Where the level is parsed from when the file was opened lazily and it isn't loaded yet
+	source  io.ReaderAt
+	entries []fileDirectoryEntry
+
+	// Position of the level's marker in the file it was read from, plus one. Zero for new levels.
+	order int
+
+	// Number of directory entries the level takes up in the file it was read from, including
+	// its marker and any ENDMAP
+	directoryCount int
+}
+
+func newLazyLevel(source io.ReaderAt, levelSlot string, mapLumps mapLumps, order int) Level {
+	level := Level{
+		Slot:      levelSlot,
+		Format:    mapLumps.Format,
+		LevelInfo: defaultLevelInfo(levelSlot),
+		source:    source,
+		entries:   mapLumps.Entries,
+		order:     order,
+
+		directoryCount: mapLumps.Consumed + 1,
+	}
+
+	hasBehavior := slices.ContainsFunc(mapLumps.Entries, func(entry fileDirectoryEntry) bool {
+		return nameToStr(entry.LumpName[:]) == LUMP_BEHAVIOR
+	})
+	if level.Format == LEVEL_FORMAT_DOOM && hasBehavior {
+		level.Format = LEVEL_FORMAT_HEXEN
+	}
+
+	return level
+}
+
+func (l Level) IsLoaded() bool {
+	return l.source == nil
+}
+
+// Parses the level's lumps. Its slot and LevelInfo are kept, since they may have changed since
+// the file was opened.
+func (l *Level) Load() error {
+	if l.IsLoaded() {
+		return nil
+	}
+
+	var level Level
+	var err error
+	if l.Format == LEVEL_FORMAT_UDMF {
+		level, err = parseUDMFLevel(l.source, l.Slot, l.entries)
+	} else {
+		level, err = parseLevel(l.source, l.Slot, l.entries)
+	}
+	if err != nil {
+		return err
+	}
+
+	level.LevelInfo = l.LevelInfo
+	level.order = l.order
+	level.directoryCount = l.directoryCount
+	*l = level
+	return nil
 }
 
 func (l Level) IsLevelFromGame(game Game) bool {
 	return isLevelFromGame(l.Slot, game)
 }
 
+func IsLevelSlotFromGame(slot string, game Game) bool {
+	return isLevelFromGame(slot, game)
+}
+
+// Levels that aren't loaded only have their LINEDEFS or TEXTMAP lump read, and are treated as
+// having no secret exit if it can't be. Loading the level reports the error.
 func (l Level) HasSecretExit() bool {
-	for _, linedef := range l.Linedefs {
-		if slices.Contains(SECRET_EXIT_LINETYPES, linedef.SpecialType) {
+	if !l.IsLoaded() {
+		return l.lazyHasSecretExit()
+	}
+
+	if l.Format == LEVEL_FORMAT_HEXEN {
+		for _, linedef := range l.HexenLinedefs {
+			if linedef.Special == HEXEN_SECRET_EXIT_SPECIAL {
+				return true
+			}
+		}
+		return false
+	}
+
+	hexenSpecials := l.Format == LEVEL_FORMAT_UDMF && l.TextMap != nil && l.TextMap.hasHexenSpecials()
+	for _, linedef := range l.LinedefsAsDoom() {
+		if hexenSpecials && linedef.SpecialType == int16(HEXEN_SECRET_EXIT_SPECIAL) {
+			return true
+		}
+		if !hexenSpecials && slices.Contains(SECRET_EXIT_LINETYPES, linedef.SpecialType) {
 			return true
 		}
 	}
@@ -31,28 +165,129 @@ func (l Level) HasSecretExit() bool {
 	return false
 }
 
+// The As* methods give the level's elements in Doom format whatever format it's in. Hexen
+// things and linedefs are converted, and UDMF levels are read from their TEXTMAP with
+// coordinates rounded to whole map units. Linedef specials keep the numbering of the level's
+// format or UDMF namespace.
+
+func (l Level) ThingsAsDoom() []Thing {
+	switch l.Format {
+	case LEVEL_FORMAT_HEXEN:
+		things := make([]Thing, len(l.HexenThings))
+		for i, thing := range l.HexenThings {
+			things[i] = thing.toThing()
+		}
+		return things
+	case LEVEL_FORMAT_UDMF:
+		return udmfElements(l.TextMap, UDMF_THING, udmfThing)
+	}
+	return l.Things
+}
+
+func (l Level) LinedefsAsDoom() []Linedef {
+	switch l.Format {
+	case LEVEL_FORMAT_HEXEN:
+		linedefs := make([]Linedef, len(l.HexenLinedefs))
+		for i, linedef := range l.HexenLinedefs {
+			linedefs[i] = linedef.toLinedef()
+		}
+		return linedefs
+	case LEVEL_FORMAT_UDMF:
+		return udmfElements(l.TextMap, UDMF_LINEDEF, udmfLinedef)
+	}
+	return l.Linedefs
+}
+
+func (l Level) SidedefsAsDoom() []Sidedef {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		return udmfElements(l.TextMap, UDMF_SIDEDEF, udmfSidedef)
+	}
+	return l.Sidedefs
+}
+
+func (l Level) VertexesAsDoom() []Vertex {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		return udmfElements(l.TextMap, UDMF_VERTEX, udmfVertex)
+	}
+	return l.Vertexes
+}
+
+func (l Level) SectorsAsDoom() []Sector {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		return udmfElements(l.TextMap, UDMF_SECTOR, udmfSector)
+	}
+	return l.Sectors
+}
+
 func (l Level) toLumps() []Lump {
 	levelHeader := Lump{
 		Name: l.Slot,
 		Data: []byte{},
 	}
 
-	lumps := make([]Lump, 0, 11)
+	if l.Format == LEVEL_FORMAT_UDMF {
+		lumps := make([]Lump, 0, len(l.ExtraLumps)+3)
+		lumps = append(lumps, levelHeader)
+		lumps = append(lumps, Lump{Name: LUMP_TEXTMAP, Data: l.TextMap.toBytes()})
+		lumps = append(lumps, l.ExtraLumps...)
+		lumps = append(lumps, Lump{Name: LUMP_ENDMAP, Data: []byte{}})
+		return lumps
+	}
+
+	lumps := make([]Lump, 0, 13+len(l.ExtraLumps))
 	lumps = append(lumps, levelHeader)
-	lumps = append(lumps, Things(l.Things).toLump())
-	lumps = append(lumps, Linedefs(l.Linedefs).toLump())
-	lumps = append(lumps, Sidedefs(l.Sidedefs).toLump())
-	lumps = append(lumps, Lump{Name: LUMP_VERTEXES, Data: l.Vertexes})
-	lumps = append(lumps, Lump{Name: LUMP_SEGMENTS, Data: l.Segments})
-	lumps = append(lumps, Lump{Name: LUMP_SUBSECTORS, Data: l.Subsectors})
-	lumps = append(lumps, Lump{Name: LUMP_NODES, Data: l.Nodes})
-	lumps = append(lumps, Lump{Name: LUMP_SECTORS, Data: l.Sectors})
-	lumps = append(lumps, Lump{Name: LUMP_REJECT, Data: l.Reject})
-	lumps = append(lumps, Lump{Name: LUMP_BLOCKMAP, Data: l.Blockmap})
+	if l.Format == LEVEL_FORMAT_HEXEN {
+		lumps = l.appendLump(lumps, HexenThings(l.HexenThings).toLump())
+		lumps = l.appendLump(lumps, HexenLinedefs(l.HexenLinedefs).toLump())
+	} else {
+		lumps = l.appendLump(lumps, Things(l.Things).toLump())
+		lumps = l.appendLump(lumps, Linedefs(l.Linedefs).toLump())
+	}
+	lumps = l.appendLump(lumps, Sidedefs(l.Sidedefs).toLump())
+	lumps = l.appendLump(lumps, Vertexes(l.Vertexes).toLump())
+	lumps = l.appendLump(lumps, Segs(l.Segments).toLump())
+	lumps = l.appendLump(lumps, Subsectors(l.Subsectors).toLump())
+	if l.ExtendedNodes != nil {
+		lumps = l.appendLump(lumps, Lump{Name: LUMP_NODES, Data: l.ExtendedNodes})
+	} else {
+		lumps = l.appendLump(lumps, Nodes(l.Nodes).toLump())
+	}
+	lumps = l.appendLump(lumps, Sectors(l.Sectors).toLump())
+	lumps = l.appendLump(lumps, Lump{Name: LUMP_REJECT, Data: l.Reject})
+	lumps = l.appendLump(lumps, Lump{Name: LUMP_BLOCKMAP, Data: l.Blockmap})
+	if l.Format == LEVEL_FORMAT_HEXEN {
+		lumps = append(lumps, Lump{Name: LUMP_BEHAVIOR, Data: l.Behavior})
+		if l.Scripts != nil {
+			lumps = append(lumps, Lump{Name: LUMP_SCRIPTS, Data: l.Scripts})
+		}
+	}
+	lumps = append(lumps, l.ExtraLumps...)
 
 	return lumps
 }
 
+// Adds the lump unless the level was read without it, followed by any partial record it had
+func (l Level) appendLump(lumps []Lump, lump Lump) []Lump {
+	if slices.Contains(l.missingLumps, lump.Name) {
+		return lumps
+	}
+	if partial, hasPartial := l.partialRecords[lump.Name]; hasPartial {
+		lump.Data = slices.Concat(lump.Data, partial)
+	}
+	return append(lumps, lump)
+}
+
+// Marks lumps as generated again, so they're written even if the level was read without them,
+// and without the partial records that belonged to the old ones
+func (l *Level) rebuilt(lumpNames ...string) {
+	l.missingLumps = slices.DeleteFunc(l.missingLumps, func(name string) bool {
+		return slices.Contains(lumpNames, name)
+	})
+	for _, name := range lumpNames {
+		delete(l.partialRecords, name)
+	}
+}
+
 func (l Level) FindAllThings(thingTypes ...int16) []*Thing {
 	found := make([]*Thing, 0, 10) // Arbitrarily start with 10 capacity since we don't know how many things we'll find
 	for i, thing := range l.Things {
@@ -63,3 +298,35 @@ func (l Level) FindAllThings(thingTypes ...int16) []*Thing {
 
 	return found
 }
+
+func (l Level) lazyHasSecretExit() bool {
+	lumpName := LUMP_LINEDEFS
+	if l.Format == LEVEL_FORMAT_UDMF {
+		lumpName = LUMP_TEXTMAP
+	}
+
+	index := slices.IndexFunc(l.entries, func(entry fileDirectoryEntry) bool {
+		return nameToStr(entry.LumpName[:]) == lumpName
+	})
+	if index < 0 {
+		return false
+	}
+	lumpData, err := parseLumpData(l.source, l.entries[index].DataOffset, l.entries[index].DataLength)
+	if err != nil {
+		return false
+	}
+
+	linedefsOnly := Level{Format: l.Format}
+	switch l.Format {
+	case LEVEL_FORMAT_UDMF:
+		linedefsOnly.TextMap, err = ParseTextMap(lumpData)
+		if err != nil {
+			return false
+		}
+	case LEVEL_FORMAT_HEXEN:
+		linedefsOnly.HexenLinedefs = parseHexenLinedefs(lumpData)
+	default:
+		linedefsOnly.Linedefs = parseLinedefs(lumpData)
+	}
+	return linedefsOnly.HasSecretExit()
+}
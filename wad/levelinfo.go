@@ -3,12 +3,37 @@
 import "fmt"
 
 type LevelInfo struct {
-	Name        string
-	Label       string
-	Next        string
-	NextSecret  string
-	EndGame     bool
-	BossActions []BossAction
+	Name            string
+	Label           string
+	Author          string
+	LevelPic        string
+	Next            string
+	NextSecret      string
+	SkyTexture      string
+	Music           string
+	ExitPic         string
+	EnterPic        string
+	ExitAnim        string
+	EnterAnim       string
+	ParTime         int
+	EndGame         bool
+	EndPic          string
+	EndBunny        bool
+	EndCast         bool
+	NoIntermission  bool
+	InterText       []string
+	InterTextSecret []string
+	InterBackdrop   string
+	InterMusic      string
+	Episode         *Episode
+	BossActions     []BossAction
+}
+
+// Entry added to the episode menu when starting from this level
+type Episode struct {
+	Patch string
+	Name  string
+	Key   string
 }
 
 type BossAction struct {
@@ -31,6 +56,83 @@ func (ba BossAction) String() string {
 	BOSS_ARACHNOTRON Boss = "Arachnotron"
 )
 
+// Text shown over the backdrop flat when each episode ends, before its picture
+var (
+	E1_END_TEXT = []string{
+		"Once you beat the big badasses and",
+		"clean out the moon base you're supposed",
+		"to win, aren't you? Aren't you? Where's",
+		"your fat reward and ticket home? What",
+		"the hell is this? It's not supposed to",
+		"end this way!",
+		"",
+		"It stinks like rotten meat, but looks",
+		"like the lost Deimos base.  Looks like",
+		"you're stuck on The Shores of Hell.",
+		"The only way out is through.",
+		"",
+		"To continue the DOOM experience, play",
+		"The Shores of Hell and its amazing",
+		"sequel, Inferno!",
+	}
+	E2_END_TEXT = []string{
+		"You've done it! The hideous cyber-",
+		"demon lord that ruled the lost Deimos",
+		"moon base has been slain and you",
+		"are triumphant! But ... where are",
+		"you? You clamber to the edge of the",
+		"moon and look down to see the awful",
+		"truth.",
+		"",
+		"Deimos floats above Hell itself!",
+		"You've never heard of anyone escaping",
+		"from Hell, but you'll make the bastards",
+		"sorry they ever heard of you! Quickly,",
+		"you rappel down to  the surface of",
+		"Hell.",
+		"",
+		"Now, it's on to the final chapter of",
+		"DOOM! -- Inferno.",
+	}
+	E3_END_TEXT = []string{
+		"The loathsome spiderdemon that",
+		"masterminded the invasion of the moon",
+		"bases and caused so much death has had",
+		"its ass kicked for all time.",
+		"",
+		"A hidden doorway opens and you enter.",
+		"You've proven too tough for Hell to",
+		"contain, and now Hell at last plays",
+		"fair -- for you emerge from the door",
+		"to see the green fields of Earth!",
+		"Home at last.",
+		"",
+		"You wonder what's been happening on",
+		"Earth while you were battling evil",
+		"unleashed. It's good that no Hell-",
+		"spawn could have come through that",
+		"door with you ...",
+	}
+	E4_END_TEXT = []string{
+		"the spider mastermind must have sent forth",
+		"its legions of hellspawn before your",
+		"final confrontation with that terrible",
+		"beast from hell.  but you stepped forward",
+		"and brought forth eternal damnation and",
+		"suffering upon the horde as a true hero",
+		"would in the face of something so evil.",
+		"",
+		"besides, someone was gonna pay for what",
+		"happened to daisy, your pet rabbit.",
+		"",
+		"but now, you see spread before you more",
+		"potential pain and gibbitude as a nation",
+		"of demons run amok among our cities.",
+		"",
+		"next stop, hell on earth!",
+	}
+)
+
 var DEFAULT_LEVELINFOS = map[string]LevelInfo{
 	"E1M1": {
 		Name:       "Hangar",
@@ -75,12 +177,16 @@ func (ba BossAction) String() string {
 		NextSecret: "E1M7",
 	},
 	"E1M8": {
-		Name:        "Phobos Anomaly",
-		Label:       "E1M8",
-		Next:        "E1M9",
-		NextSecret:  "E1M8",
-		EndGame:     true,
-		BossActions: []BossAction{{Boss: BOSS_BARON, SpecialType: 23, Tag: 666}}, // S1 Floor Lower to Lowest Floor
+		Name:           "Phobos Anomaly",
+		Label:          "E1M8",
+		Next:           "E1M9",
+		NextSecret:     "E1M8",
+		EndGame:        true,
+		EndPic:         "CREDIT",
+		NoIntermission: true,
+		InterText:      E1_END_TEXT,
+		InterBackdrop:  "FLOOR4_8",
+		BossActions:    []BossAction{{Boss: BOSS_BARON, SpecialType: 23, Tag: 666}}, // S1 Floor Lower to Lowest Floor
 	},
 	"E1M9": {
 		Name:       "Military Base",
@@ -131,12 +237,16 @@ func (ba BossAction) String() string {
 		NextSecret: "E2M7",
 	},
 	"E2M8": {
-		Name:        "Tower of Babel",
-		Label:       "E2M8",
-		Next:        "E2M9",
-		NextSecret:  "E2M8",
-		EndGame:     true,
-		BossActions: []BossAction{{Boss: BOSS_CYBERDEMON, SpecialType: 11, Tag: 0}}, // S1 Exit Level
+		Name:           "Tower of Babel",
+		Label:          "E2M8",
+		Next:           "E2M9",
+		NextSecret:     "E2M8",
+		EndGame:        true,
+		EndPic:         "VICTORY2",
+		NoIntermission: true,
+		InterText:      E2_END_TEXT,
+		InterBackdrop:  "SFLR6_1",
+		BossActions:    []BossAction{{Boss: BOSS_CYBERDEMON, SpecialType: 11, Tag: 0}}, // S1 Exit Level
 	},
 	"E2M9": {
 		Name:       "Fortress of Mystery",
@@ -187,12 +297,16 @@ func (ba BossAction) String() string {
 		NextSecret: "E3M7",
 	},
 	"E3M8": {
-		Name:        "Dis",
-		Label:       "E3M8",
-		Next:        "E3M9",
-		NextSecret:  "E3M8",
-		EndGame:     true,
-		BossActions: []BossAction{{Boss: BOSS_SPIDERDEMON, SpecialType: 11, Tag: 0}}, // S1 Exit Level
+		Name:           "Dis",
+		Label:          "E3M8",
+		Next:           "E3M9",
+		NextSecret:     "E3M8",
+		EndGame:        true,
+		EndBunny:       true,
+		NoIntermission: true,
+		InterText:      E3_END_TEXT,
+		InterBackdrop:  "MFLR8_4",
+		BossActions:    []BossAction{{Boss: BOSS_SPIDERDEMON, SpecialType: 11, Tag: 0}}, // S1 Exit Level
 	},
 	"E3M9": {
 		Name:       "Warrens",
@@ -244,12 +358,16 @@ func (ba BossAction) String() string {
 		NextSecret: "E4M7",
 	},
 	"E4M8": {
-		Name:        "Unto the Cruel",
-		Label:       "E4M8",
-		Next:        "E4M9",
-		NextSecret:  "E4M8",
-		EndGame:     true,
-		BossActions: []BossAction{{Boss: BOSS_SPIDERDEMON, SpecialType: 23, Tag: 666}}, // S1 Floor Lower to Lowest Floor
+		Name:           "Unto the Cruel",
+		Label:          "E4M8",
+		Next:           "E4M9",
+		NextSecret:     "E4M8",
+		EndGame:        true,
+		EndPic:         "ENDPIC",
+		NoIntermission: true,
+		InterText:      E4_END_TEXT,
+		InterBackdrop:  "MFLR8_3",
+		BossActions:    []BossAction{{Boss: BOSS_SPIDERDEMON, SpecialType: 23, Tag: 666}}, // S1 Floor Lower to Lowest Floor
 	},
 	"E4M9": {
 		Name:       "Fear",
@@ -436,11 +554,13 @@ func (ba BossAction) String() string {
 		NextSecret: "MAP29",
 	},
 	"MAP30": {
-		Name:       "Icon of Sin",
-		Label:      "Level 30",
-		Next:       "MAP31",
-		NextSecret: "MAP30",
-		EndGame:    true,
+		Name:           "Icon of Sin",
+		Label:          "Level 30",
+		Next:           "MAP31",
+		NextSecret:     "MAP30",
+		EndGame:        true,
+		EndCast:        true,
+		NoIntermission: true,
 	},
 	"MAP31": {
 		Name:       "Wolfenstein",
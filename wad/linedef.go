@@ -7,6 +7,21 @@
 
 const SIZE_LINEDEF int = 14
 
+const (
+	LINEDEF_FLAG_BLOCKING       int16 = 0x0001
+	LINEDEF_FLAG_BLOCK_MONSTERS int16 = 0x0002
+	LINEDEF_FLAG_TWO_SIDED      int16 = 0x0004
+	LINEDEF_FLAG_UPPER_UNPEGGED int16 = 0x0008
+	LINEDEF_FLAG_LOWER_UNPEGGED int16 = 0x0010
+	LINEDEF_FLAG_SECRET         int16 = 0x0020
+	LINEDEF_FLAG_BLOCK_SOUND    int16 = 0x0040
+	LINEDEF_FLAG_NOT_ON_MAP     int16 = 0x0080
+	LINEDEF_FLAG_ALREADY_ON_MAP int16 = 0x0100
+)
+
+// Sidedef index used by linedefs that have no back side
+const NO_SIDEDEF int16 = -1
+
 var SECRET_EXIT_LINETYPES = []int16{51, 124, 198}
 
 type Linedefs []Linedef
@@ -0,0 +1,625 @@
+package wad
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type MapInfoFormat string
+
+const (
+	MAPINFO_FORMAT_UMAPINFO MapInfoFormat = "umapinfo"
+	MAPINFO_FORMAT_ZMAPINFO MapInfoFormat = "zmapinfo"
+	MAPINFO_FORMAT_MAPINFO  MapInfoFormat = "mapinfo"
+	MAPINFO_FORMAT_EMAPINFO MapInfoFormat = "emapinfo"
+	MAPINFO_FORMAT_DEHACKED MapInfoFormat = "dehacked"
+)
+
+var MAPINFO_FORMATS = []MapInfoFormat{MAPINFO_FORMAT_UMAPINFO, MAPINFO_FORMAT_ZMAPINFO, MAPINFO_FORMAT_MAPINFO, MAPINFO_FORMAT_EMAPINFO, MAPINFO_FORMAT_DEHACKED}
+
+var DEFAULT_MAPINFO_FORMATS = []MapInfoFormat{MAPINFO_FORMAT_UMAPINFO}
+
+const (
+	LUMP_MAPINFO  = "MAPINFO"
+	LUMP_ZMAPINFO = "ZMAPINFO"
+	LUMP_EMAPINFO = "EMAPINFO"
+)
+
+// ZDoom action special equivalent to a Doom line special. Specials that act on sectors
+// take the tag as their first argument.
+type zdoomAction struct {
+	Name    string
+	UsesTag bool
+	Args    []int
+}
+
+// Doom line specials that are used as boss actions, and what ZDoom calls them
+var ZDOOM_BOSS_ACTIONS = map[int16]zdoomAction{
+	2:   {Name: "Door_Open", UsesTag: true, Args: []int{16}},
+	11:  {Name: "Exit_Normal", Args: []int{0}},
+	23:  {Name: "Floor_LowerToLowest", UsesTag: true, Args: []int{8}},
+	30:  {Name: "Floor_RaiseByTexture", UsesTag: true, Args: []int{8}},
+	38:  {Name: "Floor_LowerToLowest", UsesTag: true, Args: []int{8}},
+	51:  {Name: "Exit_Secret", Args: []int{0}},
+	52:  {Name: "Exit_Normal", Args: []int{0}},
+	60:  {Name: "Floor_LowerToLowest", UsesTag: true, Args: []int{8}},
+	61:  {Name: "Door_Open", UsesTag: true, Args: []int{16}},
+	82:  {Name: "Floor_LowerToLowest", UsesTag: true, Args: []int{8}},
+	86:  {Name: "Door_Open", UsesTag: true, Args: []int{16}},
+	96:  {Name: "Floor_RaiseByTexture", UsesTag: true, Args: []int{8}},
+	103: {Name: "Door_Open", UsesTag: true, Args: []int{16}},
+	109: {Name: "Door_Open", UsesTag: true, Args: []int{64}},
+	112: {Name: "Door_Open", UsesTag: true, Args: []int{64}},
+	114: {Name: "Door_Open", UsesTag: true, Args: []int{64}},
+	124: {Name: "Exit_Secret", Args: []int{0}},
+}
+
+// Old-style MAPINFO can only mark bosses as special and pick from a few fixed actions on tag 666
+var MAPINFO_BOSS_FLAGS = map[Boss]string{
+	BOSS_BARON:       "baronspecial",
+	BOSS_CYBERDEMON:  "cyberdemonspecial",
+	BOSS_SPIDERDEMON: "spidermastermindspecial",
+}
+
+var MAPINFO_ACTION_FLAGS = map[string]string{
+	"Exit_Normal":         "specialaction_exitlevel",
+	"Door_Open":           "specialaction_opendoor",
+	"Floor_LowerToLowest": "specialaction_lowerfloor",
+}
+
+// Eternity can only reproduce the boss actions of the original levels
+var EMAPINFO_BOSS_SPECS = map[BossAction]string{
+	{Boss: BOSS_BARON, SpecialType: 23, Tag: 666}:       "E1M8",
+	{Boss: BOSS_CYBERDEMON, SpecialType: 11, Tag: 0}:    "E2M8",
+	{Boss: BOSS_SPIDERDEMON, SpecialType: 11, Tag: 0}:   "E3M8",
+	{Boss: BOSS_CYBERDEMON, SpecialType: 112, Tag: 666}: "E4M6",
+	{Boss: BOSS_SPIDERDEMON, SpecialType: 23, Tag: 666}: "E4M8",
+	{Boss: BOSS_MANCUBUS, SpecialType: 23, Tag: 666}:    "MAP07_1",
+	{Boss: BOSS_ARACHNOTRON, SpecialType: 30, Tag: 667}: "MAP07_2",
+}
+
+func (f MapInfoFormat) LumpName() string {
+	switch f {
+	case MAPINFO_FORMAT_UMAPINFO:
+		return LUMP_UMAPINFO
+	case MAPINFO_FORMAT_ZMAPINFO:
+		return LUMP_ZMAPINFO
+	case MAPINFO_FORMAT_MAPINFO:
+		return LUMP_MAPINFO
+	case MAPINFO_FORMAT_EMAPINFO:
+		return LUMP_EMAPINFO
+	case MAPINFO_FORMAT_DEHACKED:
+		return LUMP_DEHACKED
+	}
+
+	return ""
+}
+
+func (wf WadFile) makeMapInfoLumps(format MapInfoFormat) ([]Lump, error) {
+	switch format {
+	case MAPINFO_FORMAT_UMAPINFO:
+		return []Lump{makeUMapInfoLump(wf.Levels)}, nil
+	case MAPINFO_FORMAT_ZMAPINFO:
+		lump, err := mergeMapInfoLump(LUMP_ZMAPINFO, wf.Levels, wf.Lumps, makeZMapInfoLump)
+		return []Lump{lump}, err
+	case MAPINFO_FORMAT_MAPINFO:
+		lump, err := mergeMapInfoLump(LUMP_MAPINFO, wf.Levels, wf.Lumps, makeMapInfoLump)
+		return []Lump{lump}, err
+	case MAPINFO_FORMAT_EMAPINFO:
+		return mergeEMapInfoLumps(wf.Levels, wf.Lumps), nil
+	case MAPINFO_FORMAT_DEHACKED:
+		lump, err := makeDehackedLump(wf.Levels, wf.Lumps)
+		return []Lump{lump}, err
+	}
+
+	return []Lump{}, nil
+}
+
+// Ending to put in place of the next level, since ZDoom ends the game by going to a special
+// map name. Returns the picture to show for EndPic endings.
+func zdoomEnding(levelInfo LevelInfo) (string, string) {
+	switch {
+	case levelInfo.EndCast:
+		return "EndGameC", ""
+	case levelInfo.EndBunny:
+		return "EndBunny", ""
+	case levelInfo.EndPic != "":
+		return "EndPic", levelInfo.EndPic
+	}
+	return "EndTitle", ""
+}
+
+// ZDoom shows intermission text when leaving a cluster, so each level with text gets a
+// cluster of its own and every other level shares the first one
+func zdoomClusters(levels []Level, firstCluster int) []int {
+	clusters := make([]int, len(levels))
+	next := firstCluster + 1
+	for i, level := range levels {
+		clusters[i] = firstCluster
+		if len(level.LevelInfo.InterText) > 0 || level.LevelInfo.InterBackdrop != "" {
+			clusters[i] = next
+			next++
+		}
+	}
+	return clusters
+}
+
+// Top-level definition in a MAPINFO-style lump, with the text from its first line up to the
+// next definition
+type mapInfoSection struct {
+	Keyword string
+	Name    string
+	Text    string
+}
+
+// Keywords that start a definition in MAPINFO and ZMAPINFO. In ZMAPINFO a cluster definition
+// is followed by a brace, since cluster is also a level property in old-style MAPINFO.
+var MAPINFO_SECTION_KEYWORDS = []string{
+	"map", "defaultmap", "adddefaultmap", "gamedefaults", "episode", "clearepisodes", "cluster", "clusterdef",
+	"skill", "clearskills", "include", "gameinfo", "intermission", "automap", "automap_overlay", "doomednums",
+	"spawnnums", "conversationids", "damagetype",
+}
+
+// Splits a MAPINFO or ZMAPINFO lump into its definitions. Comments and blank lines before the
+// first one are kept in a section with no keyword.
+func parseMapInfoSections(lumpName string, data []byte) ([]mapInfoSection, error) {
+	text := string(data)
+	tokens, err := tokenizeScript(lumpName, text, "{}=,")
+	if err != nil {
+		return nil, err
+	}
+
+	starts := []int{}
+	sections := []mapInfoSection{{}}
+	depth, previousLine := 0, 0
+	for i, token := range tokens {
+		firstOnLine := token.Line != previousLine
+		previousLine = token.Line
+		if token.Quoted {
+			continue
+		}
+
+		switch token.Text {
+		case "{":
+			depth++
+			continue
+		case "}":
+			depth--
+			continue
+		}
+
+		keyword := strings.ToLower(token.Text)
+		if depth != 0 || !firstOnLine || !slices.Contains(MAPINFO_SECTION_KEYWORDS, keyword) {
+			continue
+		}
+		if keyword == "cluster" && (i+2 >= len(tokens) || tokens[i+2].Text != "{") {
+			continue
+		}
+
+		section := mapInfoSection{Keyword: keyword}
+		if i+1 < len(tokens) && tokens[i+1].Line == token.Line {
+			section.Name = strings.ToUpper(tokens[i+1].Text)
+		}
+		sections = append(sections, section)
+		starts = append(starts, token.Line)
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	starts = append([]int{1}, starts...)
+	for i := range sections {
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1] - 1
+		}
+		sections[i].Text = strings.Join(lines[starts[i]-1:end], "")
+	}
+
+	return sections, nil
+}
+
+// Splits an EMAPINFO lump into its [slot] definitions, which run up to the next one. Comments and
+// blank lines before the first one are kept in a section with no keyword.
+func parseEMapInfoSections(data []byte) []mapInfoSection {
+	text := string(data)
+	sections := []mapInfoSection{{}}
+	starts := []int{0}
+	for _, match := range eMapInfoMapRegexp.FindAllStringSubmatchIndex(text, -1) {
+		// The match can start with the blank lines before the header, which stay with the previous section
+		starts = append(starts, match[0]+strings.LastIndex(text[match[0]:match[2]], "\n")+1)
+		sections = append(sections, mapInfoSection{Keyword: "map", Name: strings.ToUpper(text[match[2]:match[3]])})
+	}
+
+	for i := range sections {
+		end := len(text)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		sections[i].Text = text[starts[i]:end]
+	}
+	return sections
+}
+
+// Exits in a MAPINFO-style map definition, in any of the formats
+var mapInfoExitRegexp = regexp.MustCompile(`(?im)^([ \t]*(?:next|secretnext|nextlevel|nextsecret)\b[ \t=]*"?)([^\s",]+)`)
+
+// Moves the definitions of levels that have changed slot, along with the exits that lead to
+// them, so a lump from a WAD whose levels were renumbered still describes the same levels
+func renameMapInfoSlots(lumpName string, data []byte, slotMap map[string]string) ([]byte, error) {
+	var sections []mapInfoSection
+	if lumpName == LUMP_EMAPINFO {
+		sections = parseEMapInfoSections(data)
+	} else {
+		var err error
+		sections, err = parseMapInfoSections(lumpName, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	builder := strings.Builder{}
+	for _, section := range sections {
+		text := section.Text
+		if section.Keyword == "map" || section.Keyword == "episode" {
+			if to, moved := slotMap[section.Name]; moved && to != section.Name {
+				header, body, hasBody := strings.Cut(text, "\n")
+				start := strings.Index(strings.ToUpper(header), section.Name)
+				text = header[:start] + to + header[start+len(section.Name):]
+				if hasBody {
+					text += "\n" + body
+				}
+			}
+		}
+		if section.Keyword == "map" {
+			text = mapInfoExitRegexp.ReplaceAllStringFunc(text, func(exit string) string {
+				parts := mapInfoExitRegexp.FindStringSubmatch(exit)
+				if to, moved := slotMap[strings.ToUpper(parts[2])]; moved {
+					return parts[1] + to
+				}
+				return exit
+			})
+		}
+		builder.WriteString(text)
+	}
+	return []byte(builder.String()), nil
+}
+
+// Generates a MAPINFO-style lump, merging it into the one the WAD already has like DEHACKED.
+// Everything in the existing lump is kept except the definitions of the levels being written
+// and the episodes they start, which are generated again after it with clusters numbered
+// after the existing ones.
+func mergeMapInfoLump(lumpName string, levels []Level, lumps []Lump, generate func(levels []Level, firstCluster int) string) (Lump, error) {
+	hasEpisodes := slices.ContainsFunc(levels, func(level Level) bool { return level.LevelInfo.Episode != nil })
+	index := slices.IndexFunc(lumps, func(lump Lump) bool {
+		return lump.Name == lumpName
+	})
+	if index < 0 {
+		text := generate(levels, 1)
+		if hasEpisodes {
+			text = "clearepisodes\n\n" + text
+		}
+		return Lump{Name: lumpName, Data: []byte(text)}, nil
+	}
+
+	sections, err := parseMapInfoSections(lumpName, lumps[index].Data)
+	if err != nil {
+		return Lump{}, err
+	}
+
+	slots := map[string]bool{}
+	episodeSlots := map[string]bool{}
+	for _, level := range levels {
+		slots[level.Slot] = true
+		if level.LevelInfo.Episode != nil {
+			episodeSlots[level.Slot] = true
+		}
+	}
+
+	builder := strings.Builder{}
+	clearsEpisodes := slices.ContainsFunc(sections, func(section mapInfoSection) bool {
+		return section.Keyword == "clearepisodes"
+	})
+	if hasEpisodes && !clearsEpisodes {
+		builder.WriteString("clearepisodes\n\n")
+	}
+
+	lastCluster := 0
+	for _, section := range sections {
+		switch section.Keyword {
+		case "map":
+			if slots[section.Name] {
+				continue
+			}
+		case "episode":
+			if episodeSlots[section.Name] {
+				continue
+			}
+		case "cluster", "clusterdef":
+			if cluster, err := strconv.Atoi(section.Name); err == nil {
+				lastCluster = max(lastCluster, cluster)
+			}
+		}
+		builder.WriteString(section.Text)
+	}
+
+	if builder.Len() > 0 && !strings.HasSuffix(builder.String(), "\n\n") {
+		builder.WriteString("\n")
+	}
+	builder.WriteString(generate(levels, lastCluster+1))
+
+	return Lump{Name: lumpName, Data: []byte(builder.String())}, nil
+}
+
+func makeZMapInfoLump(levels []Level, firstCluster int) string {
+	builder := strings.Builder{}
+	clusters := zdoomClusters(levels, firstCluster)
+
+	for i, level := range levels {
+		levelInfo := level.LevelInfo
+		if levelInfo.Episode != nil {
+			builder.WriteString(fmt.Sprintf("episode %s\n{\n", level.Slot))
+			builder.WriteString(fmt.Sprintf("    name = %s\n", umapInfoQuote(levelInfo.Episode.Name)))
+			builder.WriteString(fmt.Sprintf("    picname = %s\n", umapInfoQuote(levelInfo.Episode.Patch)))
+			builder.WriteString(fmt.Sprintf("    key = %s\n", umapInfoQuote(levelInfo.Episode.Key)))
+			builder.WriteString("}\n\n")
+		}
+
+		builder.WriteString(fmt.Sprintf("map %s %s\n{\n", level.Slot, umapInfoQuote(levelInfo.Name)))
+		if levelInfo.EndGame {
+			ending, pic := zdoomEnding(levelInfo)
+			if pic != "" {
+				builder.WriteString(fmt.Sprintf("    next = %s, %s\n", ending, umapInfoQuote(pic)))
+			} else {
+				builder.WriteString(fmt.Sprintf("    next = %s\n", ending))
+			}
+		} else {
+			builder.WriteString(fmt.Sprintf("    next = %s\n", umapInfoQuote(levelInfo.Next)))
+			builder.WriteString(fmt.Sprintf("    secretnext = %s\n", umapInfoQuote(levelInfo.NextSecret)))
+		}
+		writeOptionalZMapInfoKey(&builder, "author", levelInfo.Author)
+		writeOptionalZMapInfoKey(&builder, "titlepatch", levelInfo.LevelPic)
+		writeOptionalZMapInfoKey(&builder, "sky1", levelInfo.SkyTexture)
+		writeOptionalZMapInfoKey(&builder, "music", levelInfo.Music)
+		writeOptionalZMapInfoKey(&builder, "exitpic", levelInfo.ExitPic)
+		writeOptionalZMapInfoKey(&builder, "enterpic", levelInfo.EnterPic)
+		writeOptionalZMapInfoKey(&builder, "intermusic", levelInfo.InterMusic)
+		if levelInfo.ParTime > 0 {
+			builder.WriteString(fmt.Sprintf("    par = %d\n", levelInfo.ParTime))
+		}
+		builder.WriteString(fmt.Sprintf("    cluster = %d\n", clusters[i]))
+		if levelInfo.NoIntermission {
+			builder.WriteString("    nointermission\n")
+		}
+		for _, bossAction := range levelInfo.BossActions {
+			action, known := ZDOOM_BOSS_ACTIONS[bossAction.SpecialType]
+			if !known {
+				continue
+			}
+			args := []string{umapInfoQuote(string(bossAction.Boss)), umapInfoQuote(action.Name)}
+			if action.UsesTag {
+				args = append(args, fmt.Sprint(bossAction.Tag))
+			}
+			for _, arg := range action.Args {
+				args = append(args, fmt.Sprint(arg))
+			}
+			builder.WriteString(fmt.Sprintf("    specialaction = %s\n", strings.Join(args, ", ")))
+		}
+		builder.WriteString("}\n\n")
+	}
+
+	builder.WriteString(fmt.Sprintf("cluster %d\n{\n}\n", firstCluster))
+	for i, level := range levels {
+		if clusters[i] == firstCluster {
+			continue
+		}
+
+		builder.WriteString(fmt.Sprintf("\ncluster %d\n{\n", clusters[i]))
+		if len(level.LevelInfo.InterText) > 0 {
+			builder.WriteString(fmt.Sprintf("    exittext = %s\n", umapInfoQuoteList(level.LevelInfo.InterText)))
+		}
+		writeOptionalZMapInfoKey(&builder, "flat", level.LevelInfo.InterBackdrop)
+		builder.WriteString("}\n")
+	}
+
+	return builder.String()
+}
+
+func writeOptionalZMapInfoKey(builder *strings.Builder, key string, value string) {
+	if value != "" {
+		builder.WriteString(fmt.Sprintf("    %s = %s\n", key, umapInfoQuote(value)))
+	}
+}
+
+// Old-style MAPINFO has one property per line with no braces or equals signs
+func makeMapInfoLump(levels []Level, firstCluster int) string {
+	builder := strings.Builder{}
+	clusters := zdoomClusters(levels, firstCluster)
+
+	for i, level := range levels {
+		levelInfo := level.LevelInfo
+		builder.WriteString(fmt.Sprintf("map %s %s\n", level.Slot, umapInfoQuote(levelInfo.Name)))
+		if levelInfo.EndGame {
+			ending, pic := zdoomEnding(levelInfo)
+			builder.WriteString(strings.TrimSpace(fmt.Sprintf("next %s %s", ending, pic)) + "\n")
+		} else {
+			builder.WriteString(fmt.Sprintf("next %s\n", levelInfo.Next))
+			builder.WriteString(fmt.Sprintf("secretnext %s\n", levelInfo.NextSecret))
+		}
+		writeOptionalMapInfoKey(&builder, "titlepatch", levelInfo.LevelPic)
+		if levelInfo.SkyTexture != "" {
+			builder.WriteString(fmt.Sprintf("sky1 %s 0\n", levelInfo.SkyTexture))
+		}
+		writeOptionalMapInfoKey(&builder, "music", levelInfo.Music)
+		writeOptionalMapInfoKey(&builder, "exitpic", levelInfo.ExitPic)
+		writeOptionalMapInfoKey(&builder, "enterpic", levelInfo.EnterPic)
+		if levelInfo.ParTime > 0 {
+			builder.WriteString(fmt.Sprintf("par %d\n", levelInfo.ParTime))
+		}
+		builder.WriteString(fmt.Sprintf("cluster %d\n", clusters[i]))
+		if levelInfo.NoIntermission {
+			builder.WriteString("nointermission\n")
+		}
+
+		flags := []string{}
+		for _, bossAction := range levelInfo.BossActions {
+			bossFlag, knownBoss := MAPINFO_BOSS_FLAGS[bossAction.Boss]
+			action, knownAction := ZDOOM_BOSS_ACTIONS[bossAction.SpecialType]
+			actionFlag, fixedAction := MAPINFO_ACTION_FLAGS[action.Name]
+			if !knownBoss || !knownAction || !fixedAction || (action.UsesTag && bossAction.Tag != 666) {
+				continue
+			}
+			flags = append(flags, bossFlag, actionFlag)
+		}
+		slices.Sort(flags)
+		for _, flag := range slices.Compact(flags) {
+			builder.WriteString(flag + "\n")
+		}
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString(fmt.Sprintf("clusterdef %d\n", firstCluster))
+	for i, level := range levels {
+		if clusters[i] == firstCluster {
+			continue
+		}
+
+		builder.WriteString(fmt.Sprintf("\nclusterdef %d\n", clusters[i]))
+		if len(level.LevelInfo.InterText) > 0 {
+			builder.WriteString(fmt.Sprintf("exittext %s\n", mapInfoText(level.LevelInfo.InterText)))
+		}
+		writeOptionalMapInfoKey(&builder, "flat", level.LevelInfo.InterBackdrop)
+	}
+
+	return builder.String()
+}
+
+func writeOptionalMapInfoKey(builder *strings.Builder, key string, value string) {
+	if value != "" {
+		builder.WriteString(fmt.Sprintf("%s %s\n", key, value))
+	}
+}
+
+// Old-style MAPINFO text is a single string with escaped line breaks
+func mapInfoText(lines []string) string {
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(line)
+	}
+	return `"` + strings.Join(escaped, `\n`) + `"`
+}
+
+// Intermission text lumps named in an EMAPINFO definition
+var eMapInfoTextRegexp = regexp.MustCompile(`(?im)^[ \t]*intertext(?:-secret)?[ \t]*=[ \t]*"?([^\s"]+)`)
+
+// Generates EMAPINFO, merging it into the one the WAD already has like mergeMapInfoLump. The
+// definitions of the levels being written are generated again after the rest of the existing
+// lump, and their text lumps are named so they don't replace ones the kept definitions use.
+func mergeEMapInfoLumps(levels []Level, lumps []Lump) []Lump {
+	index := slices.IndexFunc(lumps, func(lump Lump) bool {
+		return lump.Name == LUMP_EMAPINFO
+	})
+	if index < 0 {
+		return makeEMapInfoLumps(levels, map[string]bool{})
+	}
+
+	slots := map[string]bool{}
+	for _, level := range levels {
+		slots[level.Slot] = true
+	}
+
+	builder := strings.Builder{}
+	usedTextLumps := map[string]bool{}
+	for _, section := range parseEMapInfoSections(lumps[index].Data) {
+		if section.Keyword == "map" && slots[section.Name] {
+			continue
+		}
+		builder.WriteString(section.Text)
+		for _, match := range eMapInfoTextRegexp.FindAllStringSubmatch(section.Text, -1) {
+			usedTextLumps[strings.ToUpper(match[1])] = true
+		}
+	}
+
+	if builder.Len() > 0 && !strings.HasSuffix(builder.String(), "\n\n") {
+		builder.WriteString("\n")
+	}
+	generated := makeEMapInfoLumps(levels, usedTextLumps)
+	builder.Write(generated[0].Data)
+	generated[0].Data = []byte(builder.String())
+	return generated
+}
+
+// Eternity reads intermission text from separate lumps, which are returned after EMAPINFO.
+// Text lumps aren't given any of the used names.
+func makeEMapInfoLumps(levels []Level, usedTextLumps map[string]bool) []Lump {
+	builder := strings.Builder{}
+	textLumps := []Lump{}
+	textLumpName := func(prefix string, number int) string {
+		name := fmt.Sprintf("%s%03d", prefix, number)
+		for usedTextLumps[name] {
+			number++
+			name = fmt.Sprintf("%s%03d", prefix, number)
+		}
+		usedTextLumps[name] = true
+		return name
+	}
+
+	for i, level := range levels {
+		levelInfo := level.LevelInfo
+		builder.WriteString(fmt.Sprintf("[%s]\n", level.Slot))
+		builder.WriteString(fmt.Sprintf("levelname = %s\n", umapInfoQuote(levelInfo.Name)))
+		if levelInfo.EndGame {
+			builder.WriteString("endofgame = true\n")
+			if levelInfo.EndBunny {
+				builder.WriteString("finaletype = doom_bunny\n")
+			}
+		} else {
+			builder.WriteString(fmt.Sprintf("nextlevel = %s\n", levelInfo.Next))
+			builder.WriteString(fmt.Sprintf("nextsecret = %s\n", levelInfo.NextSecret))
+		}
+		if levelInfo.Author != "" {
+			builder.WriteString(fmt.Sprintf("creator = %s\n", umapInfoQuote(levelInfo.Author)))
+		}
+		writeOptionalEMapInfoKey(&builder, "levelpic", levelInfo.LevelPic)
+		writeOptionalEMapInfoKey(&builder, "sky", levelInfo.SkyTexture)
+		writeOptionalEMapInfoKey(&builder, "music", levelInfo.Music)
+		writeOptionalEMapInfoKey(&builder, "interpic", levelInfo.ExitPic)
+		writeOptionalEMapInfoKey(&builder, "interbackdrop", levelInfo.InterBackdrop)
+		writeOptionalEMapInfoKey(&builder, "intermusic", levelInfo.InterMusic)
+		if levelInfo.ParTime > 0 {
+			builder.WriteString(fmt.Sprintf("partime = %d\n", levelInfo.ParTime))
+		}
+
+		if len(levelInfo.InterText) > 0 {
+			lumpName := textLumpName("ITXT", i+1)
+			textLumps = append(textLumps, Lump{Name: lumpName, Data: []byte(strings.Join(levelInfo.InterText, "\n"))})
+			builder.WriteString(fmt.Sprintf("intertext = %s\n", lumpName))
+		}
+		if len(levelInfo.InterTextSecret) > 0 {
+			lumpName := textLumpName("ISEC", i+1)
+			textLumps = append(textLumps, Lump{Name: lumpName, Data: []byte(strings.Join(levelInfo.InterTextSecret, "\n"))})
+			builder.WriteString(fmt.Sprintf("intertext-secret = %s\n", lumpName))
+		}
+
+		bossSpecs := []string{}
+		for _, bossAction := range levelInfo.BossActions {
+			if bossSpec, known := EMAPINFO_BOSS_SPECS[bossAction]; known {
+				bossSpecs = append(bossSpecs, bossSpec)
+			}
+		}
+		if len(bossSpecs) > 0 {
+			builder.WriteString(fmt.Sprintf("boss-specials = %s\n", strings.Join(bossSpecs, " | ")))
+		}
+		builder.WriteString("\n")
+	}
+
+	lumps := []Lump{{Name: LUMP_EMAPINFO, Data: []byte(builder.String())}}
+	return append(lumps, textLumps...)
+}
+
+func writeOptionalEMapInfoKey(builder *strings.Builder, key string, value string) {
+	if value != "" {
+		builder.WriteString(fmt.Sprintf("%s = %s\n", key, value))
+	}
+}
@@ -0,0 +1,192 @@
+package wad
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMergeMapInfoLump(t *testing.T) {
+	levels := []Level{
+		{Slot: "MAP01", LevelInfo: LevelInfo{Name: "New Entryway", Next: "MAP02", NextSecret: "MAP01"}},
+		{Slot: "MAP02", LevelInfo: LevelInfo{Name: "New Hangar", Next: "MAP03", NextSecret: "MAP02", InterText: []string{"Text"}}},
+	}
+
+	tests := []struct {
+		name     string
+		lumpName string
+		existing string
+		generate func(levels []Level, firstCluster int) string
+
+		// Substrings of the merged lump that must and mustn't be in it
+		want    []string
+		notWant []string
+	}{
+		{
+			name:     "no existing lump",
+			lumpName: LUMP_ZMAPINFO,
+			generate: makeZMapInfoLump,
+			want:     []string{`map MAP01 "New Entryway"`, "cluster = 1\n", "cluster 1\n{\n}", "cluster 2\n{\n    exittext"},
+		},
+		{
+			name:     "zmapinfo",
+			lumpName: LUMP_ZMAPINFO,
+			existing: `// Header comment
+include "MAPINFO/COMMON"
+
+gameinfo
+{
+    titlepage = "TITLE2"
+}
+
+episode MAP01
+{
+    name = "Old Episode"
+}
+
+map MAP01 "Old Entryway"
+{
+    next = "MAP02"
+    cluster = 5
+}
+
+map MAP03 "Kept Level"
+{
+    next = "MAP04"
+    cluster = 5
+}
+
+cluster 5
+{
+    exittext = "Map names like map MAP01 in strings are ignored"
+}
+`,
+			generate: makeZMapInfoLump,
+			want: []string{
+				"// Header comment\ninclude \"MAPINFO/COMMON\"\n", "titlepage = \"TITLE2\"", "Old Episode",
+				`map MAP03 "Kept Level"`, "cluster 5\n{\n    exittext", `map MAP01 "New Entryway"`,
+				"cluster = 6\n", "cluster 6\n{\n}", "cluster 7\n{\n    exittext = \"Text\"",
+			},
+			notWant: []string{"Old Entryway", "clearepisodes"},
+		},
+		{
+			name:     "old-style mapinfo",
+			lumpName: LUMP_MAPINFO,
+			existing: `map MAP01 "Old Entryway"
+next MAP02
+cluster 3
+sky1 RSKY1 0
+
+map MAP05 "Kept Level"
+next MAP06
+cluster 3
+
+clusterdef 3
+exittext "Kept text"
+
+skill baby
+{
+    name = "Baby"
+}
+`,
+			generate: makeMapInfoLump,
+			want: []string{
+				"map MAP05 \"Kept Level\"\nnext MAP06\ncluster 3\n", "clusterdef 3\nexittext \"Kept text\"", "skill baby",
+				"map MAP01 \"New Entryway\"\n", "cluster 4\n", "clusterdef 4\n", "clusterdef 5\nexittext \"Text\"",
+			},
+			notWant: []string{"Old Entryway", "RSKY1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lumps := []Lump{}
+			if test.existing != "" {
+				lumps = append(lumps, Lump{Name: test.lumpName, Data: []byte(test.existing)})
+			}
+
+			lump, err := mergeMapInfoLump(test.lumpName, levels, lumps, test.generate)
+			if err != nil {
+				t.Fatalf("mergeMapInfoLump() error = %v", err)
+			}
+
+			merged := string(lump.Data)
+			for _, want := range test.want {
+				if !strings.Contains(merged, want) {
+					t.Errorf("mergeMapInfoLump() is missing %q:\n%s", want, merged)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(merged, notWant) {
+					t.Errorf("mergeMapInfoLump() still has %q:\n%s", notWant, merged)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeEMapInfoLumps(t *testing.T) {
+	levels := []Level{
+		{Slot: "MAP01", LevelInfo: LevelInfo{Name: "New Entryway", Next: "MAP02", NextSecret: "MAP01", InterText: []string{"Text"}}},
+	}
+	existing := `// Header comment
+
+[MAP01]
+levelname = "Old Entryway"
+intertext = ITXT002
+
+[MAP03]
+levelname = "Kept Level"
+intertext = ITXT001
+`
+
+	lumps := mergeEMapInfoLumps(levels, []Lump{{Name: LUMP_EMAPINFO, Data: []byte(existing)}})
+	merged := string(lumps[0].Data)
+	for _, want := range []string{"// Header comment\n", "[MAP03]\nlevelname = \"Kept Level\"\nintertext = ITXT001\n", "[MAP01]\nlevelname = \"New Entryway\""} {
+		if !strings.Contains(merged, want) {
+			t.Errorf("mergeEMapInfoLumps() is missing %q:\n%s", want, merged)
+		}
+	}
+	if strings.Contains(merged, "Old Entryway") {
+		t.Errorf("mergeEMapInfoLumps() kept the old definition:\n%s", merged)
+	}
+
+	// The kept level's text lump isn't replaced
+	names := []string{}
+	for _, lump := range lumps {
+		names = append(names, lump.Name)
+	}
+	if want := []string{LUMP_EMAPINFO, "ITXT002"}; !slices.Equal(names, want) {
+		t.Errorf("mergeEMapInfoLumps() lumps = %v, want %v", names, want)
+	}
+}
+
+func TestParseMapInfoSections(t *testing.T) {
+	data := `// Comment
+map MAP01 "One" { next = "MAP02" }
+cluster 1 {
+    flat = "FLOOR4_8"
+}
+clearepisodes
+episode MAP01 { name = "Episode" }
+`
+	sections, err := parseMapInfoSections(LUMP_ZMAPINFO, []byte(data))
+	if err != nil {
+		t.Fatalf("parseMapInfoSections() error = %v", err)
+	}
+
+	keywords := []string{}
+	text := ""
+	for _, section := range sections {
+		keywords = append(keywords, section.Keyword+" "+section.Name)
+		text += section.Text
+	}
+
+	wantKeywords := []string{" ", "map MAP01", "cluster 1", "clearepisodes ", "episode MAP01"}
+	if !slices.Equal(keywords, wantKeywords) {
+		t.Errorf("parseMapInfoSections() keywords = %q, want %q", keywords, wantKeywords)
+	}
+	if text != data {
+		t.Errorf("parseMapInfoSections() text = %q, want %q", text, data)
+	}
+}
@@ -0,0 +1,164 @@
+package wad
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Lumps wado parses that can follow a binary map marker, in any order
+var MAP_LUMP_NAMES = []string{
+	LUMP_THINGS, LUMP_LINEDEFS, LUMP_SIDEDEFS, LUMP_VERTEXES, LUMP_SEGMENTS, LUMP_SUBSECTORS,
+	LUMP_NODES, LUMP_SECTORS, LUMP_REJECT, LUMP_BLOCKMAP, LUMP_BEHAVIOR, LUMP_SCRIPTS,
+}
+
+// Binary maps can't be used without these. The rest can be rebuilt or are format-specific.
+var REQUIRED_MAP_LUMP_NAMES = []string{LUMP_THINGS, LUMP_LINEDEFS, LUMP_SIDEDEFS, LUMP_VERTEXES, LUMP_SECTORS}
+
+// Lumps wado doesn't parse that are kept with the map they follow
+var EXTRA_MAP_LUMP_NAMES = []string{
+	"GL_VERT", "GL_SEGS", "GL_SSECT", "GL_NODES", "GL_PVS", "ZNODES", "LEAFS", "LIGHTS", "MACROS", "DIALOGUE",
+}
+
+// Lumps that declare map names for source ports
+var MAPINFO_LUMP_NAMES = []string{"MAPINFO", "ZMAPINFO", "UMAPINFO", "EMAPINFO"}
+
+var (
+	ErrNoMapLumps       = errors.New("map marker isn't followed by any map lumps")
+	ErrMissingMapLump   = errors.New("map is missing a required lump")
+	ErrDuplicateMapLump = errors.New("map has more than one of the same lump")
+	ErrMissingEndMap    = errors.New("UDMF map is missing its ENDMAP lump")
+)
+
+type MapError struct {
+	Slot string
+	Lump string
+	Err  error
+}
+
+func (e *MapError) Error() string {
+	if e.Lump == "" {
+		return fmt.Sprintf("%s: %s", e.Slot, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Slot, e.Lump, e.Err)
+}
+
+func (e *MapError) Unwrap() error {
+	return e.Err
+}
+
+type mapLumps struct {
+	Format  LevelFormat
+	Entries []fileDirectoryEntry
+
+	// Number of directory entries after the marker that belong to the map, including ENDMAP
+	Consumed int
+
+	// Set when the lump looks like a map marker but isn't one, or the map is broken, so the
+	// marker and the lumps after it are kept as ordinary lumps
+	Warning error
+}
+
+// Finds the lumps belonging to the map whose marker is at index. A lump is a map marker if
+// it's followed by THINGS or TEXTMAP, or if it has a map's name and is followed by some other
+// map lump. Returns no entries if the lump isn't a map marker or the map can't be read.
+func findMapLumps(directory []fileDirectoryEntry, index int, mapNames map[string]bool) mapLumps {
+	slot := nameToStr(directory[index].LumpName[:])
+	next := ""
+	if index+1 < len(directory) {
+		next = nameToStr(directory[index+1].LumpName[:])
+	}
+
+	if next == LUMP_TEXTMAP {
+		end := findLump(directory, LUMP_ENDMAP, index+1)
+		if end < 0 {
+			return mapLumps{Warning: &MapError{Slot: slot, Err: ErrMissingEndMap}}
+		}
+		return mapLumps{Format: LEVEL_FORMAT_UDMF, Entries: directory[index+1 : end], Consumed: end - index}
+	}
+
+	// A map lump left over from a broken map isn't a marker, even when the next one is THINGS
+	if isMapLump(slot, slot) {
+		return mapLumps{}
+	}
+
+	isMapName := isLevelFromGame(slot, GAME_DOOM) || isLevelFromGame(slot, GAME_DOOM2) || mapNames[slot]
+	if next != LUMP_THINGS && !(isMapName && isMapLump(slot, next)) {
+		// Markers are empty, so a named lump with data is just a lump that happens to share a map's name
+		if isMapName && directory[index].DataLength == 0 {
+			return mapLumps{Warning: &MapError{Slot: slot, Err: ErrNoMapLumps}}
+		}
+		return mapLumps{}
+	}
+
+	end := index + 1
+	seen := map[string]bool{}
+	for ; end < len(directory); end++ {
+		name := nameToStr(directory[end].LumpName[:])
+		if !isMapLump(slot, name) {
+			break
+		}
+		if seen[name] {
+			return mapLumps{Warning: &MapError{Slot: slot, Lump: name, Err: ErrDuplicateMapLump}}
+		}
+		seen[name] = true
+	}
+
+	for _, name := range REQUIRED_MAP_LUMP_NAMES {
+		if !seen[name] {
+			return mapLumps{Warning: &MapError{Slot: slot, Lump: name, Err: ErrMissingMapLump}}
+		}
+	}
+
+	return mapLumps{Format: LEVEL_FORMAT_DOOM, Entries: directory[index+1 : end], Consumed: end - index - 1}
+}
+
+func isMapLump(slot string, name string) bool {
+	return slices.Contains(MAP_LUMP_NAMES, name) || slices.Contains(EXTRA_MAP_LUMP_NAMES, name) || isGLMarker(slot, name)
+}
+
+// glBSP marks its nodes with GL_ and the map name, or GL_LEVEL when that wouldn't fit in 8 characters
+func isGLMarker(slot string, name string) bool {
+	if len(slot) > 5 {
+		return name == "GL_LEVEL"
+	}
+	return name == "GL_"+slot
+}
+
+// Extra lumps that describe the old nodes once a map's nodes have been rebuilt. The GL marker
+// may not match the slot anymore if the level has been moved.
+func isNodeLump(name string) bool {
+	return strings.HasPrefix(name, "GL_") || name == "ZNODES"
+}
+
+var mapInfoMapRegexp = regexp.MustCompile(`(?im)^\s*map\s+"?([^\s"{]+)`)
+var eMapInfoMapRegexp = regexp.MustCompile(`(?m)^\s*\[([^\]\s]+)\]`)
+
+// Collects the map names declared in any MAPINFO-style lumps, so maps with custom names can be found
+func declaredMapNames(r io.ReaderAt, directory []fileDirectoryEntry) (map[string]bool, error) {
+	names := map[string]bool{}
+	for _, dir := range directory {
+		lumpName := nameToStr(dir.LumpName[:])
+		if !slices.Contains(MAPINFO_LUMP_NAMES, lumpName) {
+			continue
+		}
+
+		lumpData, err := parseLumpData(r, dir.DataOffset, dir.DataLength)
+		if err != nil {
+			return names, err
+		}
+
+		mapRegexp := mapInfoMapRegexp
+		if lumpName == "EMAPINFO" {
+			mapRegexp = eMapInfoMapRegexp
+		}
+		for _, match := range mapRegexp.FindAllStringSubmatch(string(lumpData), -1) {
+			names[strings.ToUpper(match[1])] = true
+		}
+	}
+
+	return names, nil
+}
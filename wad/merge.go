@@ -0,0 +1,303 @@
+package wad
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Marker ranges whose lumps are looked up by the engine as a group. The first start and end
+// markers are the ones written, the rest are other names ports accept for them.
+type Namespace struct {
+	Name   string
+	Starts []string
+	Ends   []string
+}
+
+var NAMESPACES = []Namespace{
+	{Name: "sprites", Starts: []string{"S_START", "SS_START"}, Ends: []string{"S_END", "SS_END"}},
+	{Name: "flats", Starts: []string{"F_START", "FF_START"}, Ends: []string{"F_END", "FF_END"}},
+	{Name: "patches", Starts: []string{"P_START", "PP_START"}, Ends: []string{"P_END", "PP_END"}},
+}
+
+// Markers nested inside a namespace, such as P1_START, which mean nothing once namespaces are merged
+var subNamespaceMarkerRegexp = regexp.MustCompile(`^[SFP]\d_(START|END)$`)
+
+var ErrSlotCollision = errors.New("level slot is used by more than one WAD")
+
+type MergeOptions struct {
+	// Slot changes for each file being merged, by index, applied before looking for collisions
+	SlotMaps []map[string]string
+
+	// Move levels whose slot is taken to the next free slot instead of failing
+	Renumber bool
+}
+
+type MergeReport struct {
+	Renumbered []SlotChange
+	Conflicts  []DehackedConflict
+}
+
+type SlotChange struct {
+	File int
+	From string
+	To   string
+}
+
+// Combines the lumps and levels of several WADs into one, in the order given, as if they were
+// loaded together. Namespaced lumps, textures and DEHACKED patches are merged, with later files
+// replacing what earlier ones define. Other lumps are all kept, since some ports read every
+// lump of a name.
+func Merge(out *WadFile, files []*WadFile, options MergeOptions) (MergeReport, error) {
+	report := MergeReport{
+		Renumbered: []SlotChange{},
+		Conflicts:  []DehackedConflict{},
+	}
+
+	for _, wf := range files {
+		err := wf.Load()
+		if err != nil {
+			return report, err
+		}
+	}
+
+	levels, slotMaps, err := mergeLevels(files, options, &report)
+	if err != nil {
+		return report, err
+	}
+
+	lumps := []Lump{}
+	namespaces := make([][]Lump, len(NAMESPACES))
+	patchNames := PatchNames{}
+	textures := map[string]*Textures{}
+	var patch *Dehacked
+	for i, wf := range files {
+		filePatchNames := PatchNames{}
+		for _, lump := range wf.Lumps {
+			if lump.Name == LUMP_PNAMES {
+				filePatchNames, err = ParsePatchNames(lump.Data)
+				if err != nil {
+					return report, fmt.Errorf("%s: %w", LUMP_PNAMES, err)
+				}
+				patchNames.add(filePatchNames...)
+			}
+		}
+
+		namespace := -1
+		for _, lump := range wf.Lumps {
+			if start := namespaceStart(lump.Name); start >= 0 {
+				namespace = start
+				continue
+			}
+			if namespace >= 0 && slices.Contains(NAMESPACES[namespace].Ends, lump.Name) {
+				namespace = -1
+				continue
+			}
+			if namespace >= 0 {
+				if !subNamespaceMarkerRegexp.MatchString(lump.Name) {
+					namespaces[namespace] = replaceLump(namespaces[namespace], lump)
+				}
+				continue
+			}
+
+			switch lump.Name {
+			case LUMP_PNAMES:
+				lumps = keepFirstLump(lumps, lump)
+			case LUMP_TEXTURE1, LUMP_TEXTURE2:
+				fileTextures, err := ParseTextures(lump.Data, filePatchNames)
+				if err != nil {
+					return report, fmt.Errorf("%s: %w", lump.Name, err)
+				}
+				if textures[lump.Name] == nil {
+					textures[lump.Name] = &Textures{}
+				}
+				textures[lump.Name].merge(fileTextures)
+				lumps = keepFirstLump(lumps, lump)
+			case LUMP_DEHACKED:
+				parsed, err := ParseDehacked(lump.Data)
+				if err != nil {
+					return report, fmt.Errorf("%s: %w", lump.Name, err)
+				}
+				filePatch := parsed.WithSlots(slotMaps[i])
+				if patch == nil {
+					patch = &filePatch
+				} else {
+					report.Conflicts = append(report.Conflicts, patch.Conflicts(filePatch)...)
+					patch.Merge(filePatch)
+				}
+				lumps = keepFirstLump(lumps, lump)
+			case LUMP_MAPINFO, LUMP_ZMAPINFO, LUMP_EMAPINFO:
+				data, err := renameMapInfoSlots(lump.Name, lump.Data, slotMaps[i])
+				if err != nil {
+					return report, fmt.Errorf("%s: %w", lump.Name, err)
+				}
+				lumps = appendToLump(lumps, Lump{Name: lump.Name, Data: data})
+			default:
+				lumps = append(lumps, lump)
+			}
+		}
+	}
+
+	// Merged lumps take the place of the first lump of their name
+	for i, lump := range lumps {
+		switch {
+		case lump.Name == LUMP_PNAMES:
+			lumps[i] = patchNames.ToLump()
+		case textures[lump.Name] != nil:
+			lumps[i] = textures[lump.Name].ToLump(lump.Name, patchNames)
+		case lump.Name == LUMP_DEHACKED:
+			lumps[i] = Lump{Name: LUMP_DEHACKED, Data: patch.Bytes()}
+		}
+	}
+
+	for i, namespaceLumps := range namespaces {
+		if len(namespaceLumps) == 0 {
+			continue
+		}
+		lumps = append(lumps, Lump{Name: NAMESPACES[i].Starts[0], Data: []byte{}})
+		lumps = append(lumps, namespaceLumps...)
+		lumps = append(lumps, Lump{Name: NAMESPACES[i].Ends[0], Data: []byte{}})
+	}
+
+	// Positions in the original files mean nothing in the merged one
+	for i := range lumps {
+		lumps[i].order = 0
+	}
+	for i := range levels {
+		levels[i].order = 0
+	}
+
+	out.Lumps = append(out.Lumps, lumps...)
+	out.Levels = append(out.Levels, levels...)
+	return report, nil
+}
+
+// Returns the merged levels, and for each file the slot each of its levels ended up in
+func mergeLevels(files []*WadFile, options MergeOptions, report *MergeReport) ([]Level, []map[string]string, error) {
+	levels := []Level{}
+	slotMaps := make([]map[string]string, len(files))
+	used := map[string]bool{}
+	for i, wf := range files {
+		slotMap := map[string]string{}
+		if i < len(options.SlotMaps) && options.SlotMaps[i] != nil {
+			for from, to := range options.SlotMaps[i] {
+				slotMap[strings.ToUpper(from)] = strings.ToUpper(to)
+			}
+		}
+
+		fileLevels := slices.Clone(wf.Levels)
+		for j := range fileLevels {
+			slot := fileLevels[j].Slot
+			if mapped, exists := slotMap[slot]; exists {
+				slot = mapped
+			}
+
+			if used[slot] {
+				if !options.Renumber {
+					return nil, nil, &MapError{Slot: slot, Err: ErrSlotCollision}
+				}
+
+				free, found := nextFreeSlot(slot, used)
+				if !found {
+					return nil, nil, &MapError{Slot: slot, Err: fmt.Errorf("no free slot to renumber to: %w", ErrSlotCollision)}
+				}
+				report.Renumbered = append(report.Renumbered, SlotChange{File: i, From: fileLevels[j].Slot, To: free})
+				slot = free
+			}
+
+			slotMap[fileLevels[j].Slot] = slot
+			fileLevels[j].Slot = slot
+			used[slot] = true
+		}
+
+		// Exits still lead to the same levels after they've moved
+		for j := range fileLevels {
+			levelInfo := &fileLevels[j].LevelInfo
+			if next, moved := slotMap[levelInfo.Next]; moved {
+				levelInfo.Next = next
+			}
+			if nextSecret, moved := slotMap[levelInfo.NextSecret]; moved {
+				levelInfo.NextSecret = nextSecret
+			}
+		}
+
+		levels = append(levels, fileLevels...)
+		slotMaps[i] = slotMap
+	}
+
+	return levels, slotMaps, nil
+}
+
+// The next unused slot after this one in the same game's naming
+func nextFreeSlot(slot string, used map[string]bool) (string, bool) {
+	if parts := doom1SlotRegexp.FindStringSubmatch(slot); parts != nil {
+		episode, _ := strconv.Atoi(parts[1])
+		mission, _ := strconv.Atoi(parts[2])
+		for ; episode <= 9; episode, mission = episode+1, 0 {
+			for mission++; mission <= 9; mission++ {
+				candidate := fmt.Sprintf("E%dM%d", episode, mission)
+				if !used[candidate] {
+					return candidate, true
+				}
+			}
+		}
+		return "", false
+	}
+
+	if parts := doom2SlotRegexp.FindStringSubmatch(slot); parts != nil {
+		number, _ := strconv.Atoi(parts[1])
+		for number++; number <= 99; number++ {
+			candidate := fmt.Sprintf("MAP%02d", number)
+			if !used[candidate] {
+				return candidate, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func namespaceStart(name string) int {
+	return slices.IndexFunc(NAMESPACES, func(namespace Namespace) bool {
+		return slices.Contains(namespace.Starts, name)
+	})
+}
+
+// Engines use the last lump of a name in a namespace, so only that one is kept
+func replaceLump(lumps []Lump, lump Lump) []Lump {
+	index := slices.IndexFunc(lumps, func(existing Lump) bool {
+		return existing.Name == lump.Name
+	})
+	if index >= 0 {
+		lumps[index] = lump
+		return lumps
+	}
+	return append(lumps, lump)
+}
+
+func keepFirstLump(lumps []Lump, lump Lump) []Lump {
+	if slices.ContainsFunc(lumps, func(existing Lump) bool { return existing.Name == lump.Name }) {
+		return lumps
+	}
+	return append(lumps, lump)
+}
+
+// Text lumps whose entries can be listed one after another, such as ZMAPINFO
+func appendToLump(lumps []Lump, lump Lump) []Lump {
+	index := slices.IndexFunc(lumps, func(existing Lump) bool {
+		return existing.Name == lump.Name
+	})
+	if index < 0 {
+		return append(lumps, Lump{Name: lump.Name, Data: slices.Clone(lump.Data)})
+	}
+
+	data := slices.Clone(lumps[index].Data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	lumps[index].Data = append(data, lump.Data...)
+	return lumps
+}
@@ -0,0 +1,77 @@
+package wad
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeMovesMetadata(t *testing.T) {
+	first := NewFile("")
+	first.Levels = []Level{{Slot: "MAP01"}, {Slot: "MAP02"}}
+	first.Lumps = []Lump{
+		{Name: LUMP_ZMAPINFO, Data: []byte("map MAP01 \"First One\"\n{\n    next = \"MAP02\"\n}\n")},
+		{Name: LUMP_DEHACKED, Data: []byte("[STRINGS]\nHUSTR_1 = Level 1: First One\n")},
+	}
+
+	second := NewFile("")
+	second.Levels = []Level{{Slot: "MAP01"}, {Slot: "MAP02"}}
+	second.Lumps = []Lump{
+		{Name: LUMP_ZMAPINFO, Data: []byte("map MAP01 \"Second One\"\n{\n    next = \"MAP02\"\n    secretnext = \"MAP31\"\n}\n\nmap map02 \"Second Two\"\n{\n    next = EndGameC\n}\n")},
+		{Name: LUMP_EMAPINFO, Data: []byte("# Header\n[MAP01]\nlevelname = Second One\nnextlevel = MAP02\n\n[MAP02]\nlevelname = Second Two\n")},
+		{Name: LUMP_DEHACKED, Data: []byte("Text 17 15\nlevel 1: entrywaylevel 1: SecondText 19 10\nlevel 2: underhallsSecond Two[STRINGS]\nHUSTR_1 = Level 1: Second One\n\n[PARS]\npar 2 90\n")},
+	}
+
+	out := NewFile("")
+	report, err := Merge(out, []*WadFile{first, second}, MergeOptions{Renumber: true})
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	if len(report.Conflicts) != 0 {
+		t.Errorf("Merge() conflicts = %v, want none", report.Conflicts)
+	}
+
+	lumps := map[string]string{}
+	for _, lump := range out.Lumps {
+		lumps[lump.Name] = string(lump.Data)
+	}
+
+	tests := []struct {
+		lump    string
+		want    []string
+		notWant []string
+	}{
+		{
+			lump: LUMP_ZMAPINFO,
+			want: []string{
+				"map MAP01 \"First One\"\n{\n    next = \"MAP02\"",
+				"map MAP03 \"Second One\"\n{\n    next = \"MAP04\"\n    secretnext = \"MAP31\"",
+				"map MAP04 \"Second Two\"\n{\n    next = EndGameC",
+			},
+		},
+		{
+			lump:    LUMP_EMAPINFO,
+			want:    []string{"# Header\n[MAP03]\nlevelname = Second One\nnextlevel = MAP04\n\n[MAP04]\n"},
+			notWant: []string{"[MAP01]", "[MAP02]"},
+		},
+		{
+			lump:    LUMP_DEHACKED,
+			want:    []string{"HUSTR_1 = Level 1: First One", "HUSTR_3 = Level 3: Second One", "par 4 90", "Text 20 15\nlevel 3: the gantletLevel 3: Second", "Text 18 10\nlevel 4: the focusSecond Two"},
+			notWant: []string{"level 1: entryway", "par 2 "},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.lump, func(t *testing.T) {
+			for _, want := range test.want {
+				if !strings.Contains(lumps[test.lump], want) {
+					t.Errorf("%s is missing %q:\n%s", test.lump, want, lumps[test.lump])
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(lumps[test.lump], notWant) {
+					t.Errorf("%s still has %q:\n%s", test.lump, notWant, lumps[test.lump])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+)
+
+const SIZE_NODE int = 28
+
+// Children with this bit set refer to a subsector rather than another node
+const NODE_SUBSECTOR_FLAG uint16 = 0x8000
+
+// Signatures at the start of NODES lumps in ZDoom's extended and GL node formats
+var EXTENDED_NODES_SIGNATURES = []string{"XNOD", "ZNOD", "XGLN", "ZGLN", "XGL2", "ZGL2", "XGL3", "ZGL3"}
+
+type Nodes []Node
+type Node struct {
+	X          int16
+	Y          int16
+	DX         int16
+	DY         int16
+	RightBox   BoundingBox
+	LeftBox    BoundingBox
+	RightChild uint16
+	LeftChild  uint16
+}
+
+type BoundingBox struct {
+	Top    int16
+	Bottom int16
+	Left   int16
+	Right  int16
+}
+
+func (n *Node) fromBytes(data []byte) {
+	n.X = int16(binary.LittleEndian.Uint16(data[0:2]))
+	n.Y = int16(binary.LittleEndian.Uint16(data[2:4]))
+	n.DX = int16(binary.LittleEndian.Uint16(data[4:6]))
+	n.DY = int16(binary.LittleEndian.Uint16(data[6:8]))
+	n.RightBox.fromBytes(data[8:16])
+	n.LeftBox.fromBytes(data[16:24])
+	n.RightChild = binary.LittleEndian.Uint16(data[24:26])
+	n.LeftChild = binary.LittleEndian.Uint16(data[26:28])
+}
+
+func (n Node) toBytes() []byte {
+	nbytes := [SIZE_NODE]byte{}
+	binary.LittleEndian.PutUint16(nbytes[0:2], uint16(n.X))
+	binary.LittleEndian.PutUint16(nbytes[2:4], uint16(n.Y))
+	binary.LittleEndian.PutUint16(nbytes[4:6], uint16(n.DX))
+	binary.LittleEndian.PutUint16(nbytes[6:8], uint16(n.DY))
+	copy(nbytes[8:16], n.RightBox.toBytes())
+	copy(nbytes[16:24], n.LeftBox.toBytes())
+	binary.LittleEndian.PutUint16(nbytes[24:26], n.RightChild)
+	binary.LittleEndian.PutUint16(nbytes[26:28], n.LeftChild)
+
+	return nbytes[:]
+}
+
+func (b *BoundingBox) fromBytes(data []byte) {
+	b.Top = int16(binary.LittleEndian.Uint16(data[0:2]))
+	b.Bottom = int16(binary.LittleEndian.Uint16(data[2:4]))
+	b.Left = int16(binary.LittleEndian.Uint16(data[4:6]))
+	b.Right = int16(binary.LittleEndian.Uint16(data[6:8]))
+}
+
+func (b BoundingBox) toBytes() []byte {
+	bbytes := [8]byte{}
+	binary.LittleEndian.PutUint16(bbytes[0:2], uint16(b.Top))
+	binary.LittleEndian.PutUint16(bbytes[2:4], uint16(b.Bottom))
+	binary.LittleEndian.PutUint16(bbytes[4:6], uint16(b.Left))
+	binary.LittleEndian.PutUint16(bbytes[6:8], uint16(b.Right))
+
+	return bbytes[:]
+}
+
+func parseNodes(data []byte) []Node {
+	numNodes := len(data) / SIZE_NODE
+	nodes := make([]Node, numNodes)
+
+	buf := bytes.NewBuffer(data)
+	for i, n := range nodes {
+		nbytes := buf.Next(SIZE_NODE)
+		n.fromBytes(nbytes)
+		nodes[i] = n
+	}
+
+	return nodes
+}
+
+func isExtendedNodes(data []byte) bool {
+	return len(data) >= 4 && slices.Contains(EXTENDED_NODES_SIGNATURES, string(data[0:4]))
+}
+
+func (nodes Nodes) toLump() Lump {
+	buf := make([]byte, 0, len(nodes)*SIZE_NODE)
+	for _, n := range nodes {
+		nbytes := n.toBytes()
+		buf = append(buf, nbytes...)
+	}
+
+	return Lump{
+		Name: LUMP_NODES,
+		Data: buf,
+	}
+}
@@ -0,0 +1,415 @@
+package wad
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+var ErrUDMFNodes = errors.New("UDMF levels keep their nodes in ZNODES, which wado can't build")
+
+// Large seg sets only try this many partition lines to keep building fast
+const NODEBUILDER_MAX_CANDIDATES = 128
+
+// Cost of splitting a seg, relative to an imbalance of one seg between the two sides of a partition
+const NODEBUILDER_SPLIT_COST = 8
+
+// Points closer than this many map units to a partition line are considered to be on the line.
+// Split vertexes are rounded to whole map units, which can move them up to ~0.71 units off the line.
+const NODEBUILDER_EPSILON = 0.75
+
+// Vanilla stores vertex, seg, subsector and node references as signed 16-bit values
+const NODEBUILDER_MAX_INDEX = math.MaxInt16
+
+type side int
+
+const (
+	SIDE_FRONT side = iota
+	SIDE_BACK
+	SIDE_SPLIT
+)
+
+type buildSeg struct {
+	Start     int
+	End       int
+	Linedef   int
+	Direction int16
+	Offset    float64
+
+	// The line this seg lies on, pointing the same way as the seg. Taken from the
+	// linedef rather than the seg's own vertexes so split segs stay exactly colinear.
+	X  float64
+	Y  float64
+	DX float64
+	DY float64
+}
+
+type nodeBuilder struct {
+	level        *Level
+	linedefs     []Linedef
+	vertexes     []Vertex
+	vertexLookup map[Vertex]int
+	segs         []Seg
+	subsectors   []Subsector
+	nodes        []Node
+}
+
+// Builds vanilla NODES, SEGS and SSECTORS for a Doom or Hexen-format level. UDMF levels
+// return ErrUDMFNodes and are left as they are.
+func (l *Level) BuildNodes() error {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		return &MapError{Slot: l.Slot, Err: ErrUDMFNodes}
+	}
+
+	linedefs := l.LinedefsAsDoom()
+	builder := nodeBuilder{
+		level:        l,
+		linedefs:     linedefs,
+		vertexes:     trimUnusedVertexes(l.Vertexes, linedefs),
+		vertexLookup: map[Vertex]int{},
+	}
+	for i, v := range builder.vertexes {
+		if _, exists := builder.vertexLookup[v]; !exists {
+			builder.vertexLookup[v] = i
+		}
+	}
+
+	segs := builder.makeSegs()
+	if len(segs) > 0 {
+		_, _, err := builder.build(segs)
+		if err != nil {
+			return fmt.Errorf("building nodes for %s: %w", l.Slot, err)
+		}
+	}
+
+	l.Vertexes = builder.vertexes
+	l.Segments = builder.segs
+	l.Subsectors = builder.subsectors
+	l.Nodes = builder.nodes
+	l.ExtendedNodes = nil
+	l.rebuilt(LUMP_VERTEXES, LUMP_SEGMENTS, LUMP_SUBSECTORS, LUMP_NODES)
+
+	// Any other node formats kept with the level no longer match its geometry
+	l.ExtraLumps = slices.DeleteFunc(l.ExtraLumps, func(lump Lump) bool {
+		return isNodeLump(lump.Name)
+	})
+	return nil
+}
+
+// Drop vertexes left behind by a previous node build, which only segs refer to
+func trimUnusedVertexes(vertexes []Vertex, linedefs []Linedef) []Vertex {
+	used := 0
+	for _, linedef := range linedefs {
+		used = max(used, int(linedef.Start)+1, int(linedef.End)+1)
+	}
+	used = min(used, len(vertexes))
+
+	trimmed := make([]Vertex, used)
+	copy(trimmed, vertexes)
+	return trimmed
+}
+
+func (b *nodeBuilder) makeSegs() []buildSeg {
+	segs := make([]buildSeg, 0, len(b.linedefs)*2)
+
+	for i, linedef := range b.linedefs {
+		start, end := int(linedef.Start), int(linedef.End)
+		if start < 0 || start >= len(b.vertexes) || end < 0 || end >= len(b.vertexes) {
+			continue
+		}
+
+		v1, v2 := b.vertexes[start], b.vertexes[end]
+		if v1 == v2 {
+			continue
+		}
+
+		x1, y1, x2, y2 := float64(v1.X), float64(v1.Y), float64(v2.X), float64(v2.Y)
+		if b.validSidedef(linedef.Front) {
+			segs = append(segs, buildSeg{Start: start, End: end, Linedef: i, Direction: 0, X: x1, Y: y1, DX: x2 - x1, DY: y2 - y1})
+		}
+		if b.validSidedef(linedef.Back) {
+			segs = append(segs, buildSeg{Start: end, End: start, Linedef: i, Direction: 1, X: x2, Y: y2, DX: x1 - x2, DY: y1 - y2})
+		}
+	}
+
+	return segs
+}
+
+func (b *nodeBuilder) validSidedef(index int16) bool {
+	return index >= 0 && int(index) < len(b.level.Sidedefs)
+}
+
+// Returns the child reference and bounding box of the subtree built from these segs
+func (b *nodeBuilder) build(segs []buildSeg) (uint16, BoundingBox, error) {
+	bbox := b.boundingBox(segs)
+
+	partition, found := b.pickPartition(segs)
+	if !found {
+		ref, err := b.makeSubsector(segs)
+		return ref, bbox, err
+	}
+
+	front, back, err := b.splitSegs(segs, partition)
+	if err != nil {
+		return 0, bbox, err
+	}
+
+	rightChild, rightBox, err := b.build(front)
+	if err != nil {
+		return 0, bbox, err
+	}
+	leftChild, leftBox, err := b.build(back)
+	if err != nil {
+		return 0, bbox, err
+	}
+
+	if len(b.nodes) >= NODEBUILDER_MAX_INDEX {
+		return 0, bbox, fmt.Errorf("too many nodes")
+	}
+
+	b.nodes = append(b.nodes, Node{
+		X:          int16(partition.X),
+		Y:          int16(partition.Y),
+		DX:         int16(partition.DX),
+		DY:         int16(partition.DY),
+		RightBox:   rightBox,
+		LeftBox:    leftBox,
+		RightChild: rightChild,
+		LeftChild:  leftChild,
+	})
+	return uint16(len(b.nodes) - 1), bbox, nil
+}
+
+func (b *nodeBuilder) makeSubsector(segs []buildSeg) (uint16, error) {
+	if len(b.subsectors) >= NODEBUILDER_MAX_INDEX || len(b.segs)+len(segs) > NODEBUILDER_MAX_INDEX {
+		return 0, fmt.Errorf("too many subsectors or segs")
+	}
+
+	b.subsectors = append(b.subsectors, Subsector{
+		SegCount: int16(len(segs)),
+		FirstSeg: int16(len(b.segs)),
+	})
+
+	for _, seg := range segs {
+		b.segs = append(b.segs, Seg{
+			Start:     int16(seg.Start),
+			End:       int16(seg.End),
+			Angle:     int16(bam(seg.DX, seg.DY)),
+			Linedef:   int16(seg.Linedef),
+			Direction: seg.Direction,
+			Offset:    int16(math.Round(seg.Offset)),
+		})
+	}
+
+	return uint16(len(b.subsectors)-1) | NODE_SUBSECTOR_FLAG, nil
+}
+
+// A set of segs is convex, and so can become a subsector, when no seg's line has
+// another seg behind it. In that case no partition line is found.
+func (b *nodeBuilder) pickPartition(segs []buildSeg) (buildSeg, bool) {
+	candidates := uniqueLines(segs)
+	stride := max(len(candidates)/NODEBUILDER_MAX_CANDIDATES, 1)
+
+	best, found := b.bestPartition(segs, candidates, stride)
+	if !found && stride > 1 {
+		best, found = b.bestPartition(segs, candidates, 1)
+	}
+
+	return best, found
+}
+
+func (b *nodeBuilder) bestPartition(segs []buildSeg, candidates []buildSeg, stride int) (buildSeg, bool) {
+	var best buildSeg
+	bestCost := math.MaxInt
+	found := false
+
+	for i := 0; i < len(candidates); i += stride {
+		candidate := candidates[i]
+		frontCount, backCount, splitCount := 0, 0, 0
+
+		for _, seg := range segs {
+			switch s, _, _ := b.classify(seg, candidate); s {
+			case SIDE_FRONT:
+				frontCount++
+			case SIDE_BACK:
+				backCount++
+			case SIDE_SPLIT:
+				frontCount++
+				backCount++
+				splitCount++
+			}
+
+			if splitCount*NODEBUILDER_SPLIT_COST >= bestCost {
+				break
+			}
+		}
+
+		if frontCount == 0 || backCount == 0 {
+			continue
+		}
+
+		imbalance := frontCount - backCount
+		if imbalance < 0 {
+			imbalance = -imbalance
+		}
+
+		cost := splitCount*NODEBUILDER_SPLIT_COST + imbalance
+		if cost < bestCost {
+			best, bestCost, found = candidate, cost, true
+		}
+	}
+
+	return best, found
+}
+
+// Segs from the same linedef always share a line, so only one of them needs to be tried
+func uniqueLines(segs []buildSeg) []buildSeg {
+	seen := map[int]bool{}
+	lines := make([]buildSeg, 0, len(segs))
+	for _, seg := range segs {
+		if !seen[seg.Linedef] {
+			seen[seg.Linedef] = true
+			lines = append(lines, seg)
+		}
+	}
+	return lines
+}
+
+func (b *nodeBuilder) splitSegs(segs []buildSeg, partition buildSeg) ([]buildSeg, []buildSeg, error) {
+	front := make([]buildSeg, 0, len(segs))
+	back := make([]buildSeg, 0, len(segs))
+
+	for _, seg := range segs {
+		s, split, startSide := b.classify(seg, partition)
+		switch s {
+		case SIDE_FRONT:
+			front = append(front, seg)
+		case SIDE_BACK:
+			back = append(back, seg)
+		case SIDE_SPLIT:
+			splitIndex, err := b.addVertex(split)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			first, second := seg, seg
+			first.End = splitIndex
+			second.Start = splitIndex
+			second.Offset = seg.Offset + b.distance(seg.Start, splitIndex)
+
+			if startSide == SIDE_FRONT {
+				front = append(front, first)
+				back = append(back, second)
+			} else {
+				back = append(back, first)
+				front = append(front, second)
+			}
+		}
+	}
+
+	return front, back, nil
+}
+
+// Work out which side of the partition a seg is on. Split segs also return where the
+// split vertex goes and which side the start of the seg is on.
+func (b *nodeBuilder) classify(seg buildSeg, partition buildSeg) (side, Vertex, side) {
+	if seg.Linedef == partition.Linedef {
+		return colinearSide(seg, partition), Vertex{}, SIDE_FRONT
+	}
+
+	start, end := b.vertexes[seg.Start], b.vertexes[seg.End]
+	d1 := signedDistance(partition, start)
+	d2 := signedDistance(partition, end)
+
+	switch {
+	case d1 == 0 && d2 == 0:
+		return colinearSide(seg, partition), Vertex{}, SIDE_FRONT
+	case d1 <= 0 && d2 <= 0:
+		return SIDE_FRONT, Vertex{}, SIDE_FRONT
+	case d1 >= 0 && d2 >= 0:
+		return SIDE_BACK, Vertex{}, SIDE_FRONT
+	}
+
+	t := d1 / (d1 - d2)
+	split := Vertex{
+		X: int16(math.Round(float64(start.X) + t*(float64(end.X)-float64(start.X)))),
+		Y: int16(math.Round(float64(start.Y) + t*(float64(end.Y)-float64(start.Y)))),
+	}
+
+	// The split vertex rounded onto one of the ends, so put the whole seg on the side of the other end
+	if split == start || split == end {
+		if math.Abs(d1) > math.Abs(d2) {
+			return sideOf(d1), Vertex{}, SIDE_FRONT
+		}
+		return sideOf(d2), Vertex{}, SIDE_FRONT
+	}
+
+	return SIDE_SPLIT, split, sideOf(d1)
+}
+
+// Colinear segs facing the same way as the partition belong to its front, ones facing away belong to its back
+func colinearSide(seg buildSeg, partition buildSeg) side {
+	if seg.DX*partition.DX+seg.DY*partition.DY > 0 {
+		return SIDE_FRONT
+	}
+	return SIDE_BACK
+}
+
+func sideOf(distance float64) side {
+	if distance < 0 {
+		return SIDE_FRONT
+	}
+	return SIDE_BACK
+}
+
+// Negative distances are on the right of the partition, which the engine treats as the front
+func signedDistance(partition buildSeg, v Vertex) float64 {
+	cross := partition.DX*(float64(v.Y)-partition.Y) - partition.DY*(float64(v.X)-partition.X)
+	distance := cross / math.Hypot(partition.DX, partition.DY)
+	if math.Abs(distance) < NODEBUILDER_EPSILON {
+		return 0
+	}
+	return distance
+}
+
+func (b *nodeBuilder) addVertex(v Vertex) (int, error) {
+	if index, exists := b.vertexLookup[v]; exists {
+		return index, nil
+	}
+
+	if len(b.vertexes) >= NODEBUILDER_MAX_INDEX {
+		return 0, fmt.Errorf("too many vertexes")
+	}
+
+	b.vertexes = append(b.vertexes, v)
+	b.vertexLookup[v] = len(b.vertexes) - 1
+	return len(b.vertexes) - 1, nil
+}
+
+func (b *nodeBuilder) distance(v1 int, v2 int) float64 {
+	a, c := b.vertexes[v1], b.vertexes[v2]
+	return math.Hypot(float64(c.X)-float64(a.X), float64(c.Y)-float64(a.Y))
+}
+
+func (b *nodeBuilder) boundingBox(segs []buildSeg) BoundingBox {
+	bbox := BoundingBox{Top: math.MinInt16, Bottom: math.MaxInt16, Left: math.MaxInt16, Right: math.MinInt16}
+	for _, seg := range segs {
+		for _, v := range []Vertex{b.vertexes[seg.Start], b.vertexes[seg.End]} {
+			bbox.Top = max(bbox.Top, v.Y)
+			bbox.Bottom = min(bbox.Bottom, v.Y)
+			bbox.Left = min(bbox.Left, v.X)
+			bbox.Right = max(bbox.Right, v.X)
+		}
+	}
+	return bbox
+}
+
+// Convert a direction to a binary angle measurement, where a full turn is 65536
+func bam(dx float64, dy float64) uint16 {
+	angle := math.Atan2(dy, dx)
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	return uint16(int(math.Round(angle/(2*math.Pi)*65536)) & 0xffff)
+}
@@ -0,0 +1,222 @@
+package wad
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+type testLine struct {
+	Start       int16
+	End         int16
+	FrontSector int16
+	BackSector  int16
+}
+
+// Builds a level from lines whose front side faces FrontSector, and whose back side faces
+// BackSector unless it's -1
+func newTestLevel(vertexes []Vertex, lines []testLine, numSectors int) Level {
+	level := Level{
+		Slot:     "MAP01",
+		Vertexes: vertexes,
+		Sectors:  make([]Sector, numSectors),
+	}
+
+	for _, line := range lines {
+		linedef := Linedef{Start: line.Start, End: line.End, Front: int16(len(level.Sidedefs)), Back: NO_SIDEDEF}
+		level.Sidedefs = append(level.Sidedefs, Sidedef{MiddleTex: "STARTAN2", FacingSector: line.FrontSector})
+		if line.BackSector >= 0 {
+			linedef.Flags = LINEDEF_FLAG_TWO_SIDED
+			linedef.Back = int16(len(level.Sidedefs))
+			level.Sidedefs = append(level.Sidedefs, Sidedef{MiddleTex: "-", FacingSector: line.BackSector})
+		}
+		level.Linedefs = append(level.Linedefs, linedef)
+	}
+
+	return level
+}
+
+// A square room of the given size
+func testSquareLevel(size int16) Level {
+	return newTestLevel(
+		[]Vertex{{0, 0}, {0, size}, {size, size}, {size, 0}},
+		[]testLine{{0, 1, 0, -1}, {1, 2, 0, -1}, {2, 3, 0, -1}, {3, 0, 0, -1}},
+		1,
+	)
+}
+
+// Two 128x128 rooms side by side, joined by a two-sided line
+func testTwoRoomLevel() Level {
+	return newTestLevel(
+		[]Vertex{{0, 0}, {0, 128}, {128, 128}, {256, 128}, {256, 0}, {128, 0}},
+		[]testLine{{0, 1, 0, -1}, {1, 2, 0, -1}, {2, 3, 1, -1}, {3, 4, 1, -1}, {4, 5, 1, -1}, {5, 0, 0, -1}, {5, 2, 1, 0}},
+		2,
+	)
+}
+
+// An L-shaped room, which isn't convex so it needs at least one partition
+func testLShapedLevel() Level {
+	return newTestLevel(
+		[]Vertex{{0, 0}, {0, 256}, {128, 256}, {128, 128}, {256, 128}, {256, 0}},
+		[]testLine{{0, 1, 0, -1}, {1, 2, 0, -1}, {2, 3, 0, -1}, {3, 4, 0, -1}, {4, 5, 0, -1}, {5, 0, 0, -1}},
+		1,
+	)
+}
+
+func TestBuildNodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		level         Level
+		minSubsectors int
+
+		// Exact counts, or -1 where the builder may choose between several partitions
+		subsectors int
+		nodes      int
+		segs       int
+	}{
+		{name: "convex room", level: testSquareLevel(256), minSubsectors: 1, subsectors: 1, nodes: 0, segs: 4},
+		{name: "two rooms", level: testTwoRoomLevel(), minSubsectors: 2, subsectors: 2, nodes: 1, segs: 8},
+		{name: "L-shaped room", level: testLShapedLevel(), minSubsectors: 2, subsectors: -1, nodes: -1, segs: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			level := test.level
+			err := level.BuildNodes()
+			if err != nil {
+				t.Fatalf("BuildNodes() error = %v", err)
+			}
+
+			if len(level.Subsectors) < test.minSubsectors {
+				t.Errorf("got %d subsectors, want at least %d", len(level.Subsectors), test.minSubsectors)
+			}
+			if test.subsectors >= 0 && len(level.Subsectors) != test.subsectors {
+				t.Errorf("got %d subsectors, want %d", len(level.Subsectors), test.subsectors)
+			}
+			if test.nodes >= 0 && len(level.Nodes) != test.nodes {
+				t.Errorf("got %d nodes, want %d", len(level.Nodes), test.nodes)
+			}
+			if test.segs >= 0 && len(level.Segments) != test.segs {
+				t.Errorf("got %d segs, want %d", len(level.Segments), test.segs)
+			}
+			if len(level.Nodes) > 0 && len(level.Nodes) != len(level.Subsectors)-1 {
+				t.Errorf("got %d nodes for %d subsectors, want one less", len(level.Nodes), len(level.Subsectors))
+			}
+
+			checkSubsectors(t, level)
+			checkSegLengths(t, level)
+			checkNodeChildren(t, level)
+		})
+	}
+}
+
+// Every seg of a subsector faces the same sector, and every seg is in exactly one subsector
+func checkSubsectors(t *testing.T, level Level) {
+	t.Helper()
+
+	next := 0
+	for i, subsector := range level.Subsectors {
+		if int(subsector.FirstSeg) != next {
+			t.Errorf("subsector %d starts at seg %d, want %d", i, subsector.FirstSeg, next)
+		}
+		next = int(subsector.FirstSeg) + int(subsector.SegCount)
+
+		sectors := []int16{}
+		for _, seg := range level.Segments[subsector.FirstSeg:next] {
+			linedef := level.Linedefs[seg.Linedef]
+			sidedef := linedef.Front
+			if seg.Direction == 1 {
+				sidedef = linedef.Back
+			}
+			sectors = append(sectors, level.Sidedefs[sidedef].FacingSector)
+		}
+		if len(slices.Compact(sectors)) != 1 {
+			t.Errorf("subsector %d faces sectors %v, want one", i, sectors)
+		}
+	}
+
+	if next != len(level.Segments) {
+		t.Errorf("subsectors cover %d segs, want %d", next, len(level.Segments))
+	}
+}
+
+// The segs of each side of a linedef add up to the whole linedef, give or take rounding
+func checkSegLengths(t *testing.T, level Level) {
+	t.Helper()
+
+	lengths := map[[2]int]float64{}
+	for _, seg := range level.Segments {
+		v1, v2 := level.Vertexes[seg.Start], level.Vertexes[seg.End]
+		lengths[[2]int{int(seg.Linedef), int(seg.Direction)}] += math.Hypot(float64(v2.X-v1.X), float64(v2.Y-v1.Y))
+	}
+
+	for i, linedef := range level.Linedefs {
+		v1, v2 := level.Vertexes[linedef.Start], level.Vertexes[linedef.End]
+		want := math.Hypot(float64(v2.X-v1.X), float64(v2.Y-v1.Y))
+		directions := []int{0}
+		if linedef.Back != NO_SIDEDEF {
+			directions = append(directions, 1)
+		}
+
+		for _, direction := range directions {
+			got := lengths[[2]int{i, direction}]
+			if math.Abs(got-want) > 2 {
+				t.Errorf("linedef %d side %d has %.1f units of segs, want %.1f", i, direction, got, want)
+			}
+		}
+	}
+}
+
+func checkNodeChildren(t *testing.T, level Level) {
+	t.Helper()
+
+	for i, node := range level.Nodes {
+		for _, child := range []uint16{node.RightChild, node.LeftChild} {
+			if child&NODE_SUBSECTOR_FLAG != 0 {
+				if int(child&^NODE_SUBSECTOR_FLAG) >= len(level.Subsectors) {
+					t.Errorf("node %d refers to subsector %d, which doesn't exist", i, child&^NODE_SUBSECTOR_FLAG)
+				}
+			} else if int(child) >= i {
+				t.Errorf("node %d refers to node %d, which isn't built before it", i, child)
+			}
+		}
+	}
+}
+
+func TestBuildUDMFLevel(t *testing.T) {
+	znodes := Lump{Name: "ZNODES", Data: []byte{1, 2, 3}}
+	level := Level{Slot: "MAP01", Format: LEVEL_FORMAT_UDMF, ExtraLumps: []Lump{znodes}}
+
+	err := level.BuildNodes()
+	if !errors.Is(err, ErrUDMFNodes) {
+		t.Errorf("BuildNodes() error = %v, want %v", err, ErrUDMFNodes)
+	}
+	err = level.BuildBlockmap(true)
+	if !errors.Is(err, ErrUDMFNodes) {
+		t.Errorf("BuildBlockmap() error = %v, want %v", err, ErrUDMFNodes)
+	}
+	level.BuildReject(false)
+
+	if len(level.ExtraLumps) != 1 || level.Blockmap != nil || level.Reject != nil {
+		t.Errorf("building a UDMF level changed it to %+v", level)
+	}
+}
+
+func TestNodeLumpsRoundTrip(t *testing.T) {
+	level := testLShapedLevel()
+	err := level.BuildNodes()
+	if err != nil {
+		t.Fatalf("BuildNodes() error = %v", err)
+	}
+
+	if segs := parseSegs(Segs(level.Segments).toLump().Data); !slices.Equal(segs, level.Segments) {
+		t.Errorf("SEGS round trip = %v, want %v", segs, level.Segments)
+	}
+	if subsectors := parseSubsectors(Subsectors(level.Subsectors).toLump().Data); !slices.Equal(subsectors, level.Subsectors) {
+		t.Errorf("SSECTORS round trip = %v, want %v", subsectors, level.Subsectors)
+	}
+	if nodes := parseNodes(Nodes(level.Nodes).toLump().Data); !slices.Equal(nodes, level.Nodes) {
+		t.Errorf("NODES round trip = %v, want %v", nodes, level.Nodes)
+	}
+}
@@ -0,0 +1,69 @@
+package wad
+
+// Builds the REJECT table, where a set bit means monsters in one sector can never see
+// the player in the other. A zero-filled table rejects nothing and is always safe. Otherwise
+// sectors that aren't joined to each other through any chain of two-sided linedefs are
+// rejected, since there is no opening for a line of sight to pass through. UDMF levels have no
+// REJECT and are left as they are.
+func (l *Level) BuildReject(zeroFill bool) {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		return
+	}
+
+	numSectors := len(l.Sectors)
+	reject := make([]byte, (numSectors*numSectors+7)/8)
+
+	if !zeroFill {
+		groups := l.sectorGroups()
+		for s1 := 0; s1 < numSectors; s1++ {
+			for s2 := 0; s2 < numSectors; s2++ {
+				if groups[s1] != groups[s2] {
+					bit := s1*numSectors + s2
+					reject[bit/8] |= 1 << (bit % 8)
+				}
+			}
+		}
+	}
+
+	l.Reject = reject
+	l.rebuilt(LUMP_REJECT)
+}
+
+// Label every sector with the group of sectors it's connected to through two-sided linedefs
+func (l Level) sectorGroups() []int {
+	parents := make([]int, len(l.Sectors))
+	for i := range parents {
+		parents[i] = i
+	}
+
+	var find func(int) int
+	find = func(s int) int {
+		if parents[s] != s {
+			parents[s] = find(parents[s])
+		}
+		return parents[s]
+	}
+
+	for _, linedef := range l.LinedefsAsDoom() {
+		front, frontOk := l.sidedefSector(linedef.Front)
+		back, backOk := l.sidedefSector(linedef.Back)
+		if frontOk && backOk {
+			parents[find(front)] = find(back)
+		}
+	}
+
+	groups := make([]int, len(l.Sectors))
+	for i := range groups {
+		groups[i] = find(i)
+	}
+	return groups
+}
+
+func (l Level) sidedefSector(sidedef int16) (int, bool) {
+	if sidedef < 0 || int(sidedef) >= len(l.Sidedefs) {
+		return 0, false
+	}
+
+	sector := int(l.Sidedefs[sidedef].FacingSector)
+	return sector, sector >= 0 && sector < len(l.Sectors)
+}
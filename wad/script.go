@@ -0,0 +1,76 @@
+package wad
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Token from a text lump such as TEXTMAP or UMAPINFO
+type scriptToken struct {
+	Text   string
+	Quoted bool
+	Line   int
+}
+
+// Splits text into quoted strings, single-character symbols and runs of anything else,
+// skipping whitespace and C-style comments
+func tokenizeScript(lumpName string, text string, symbols string) ([]scriptToken, error) {
+	tokens := []scriptToken{}
+	line := 1
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(text[i:], "//"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("%s line %d: unterminated comment", lumpName, line)
+			}
+			line += strings.Count(text[i:i+2+end], "\n")
+			i += end + 4
+		case strings.ContainsRune(symbols, rune(c)):
+			tokens = append(tokens, scriptToken{Text: string(c), Line: line})
+			i++
+		case c == '"':
+			builder := strings.Builder{}
+			i++
+			for ; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				if text[i] == '\n' {
+					line++
+				}
+				builder.WriteByte(text[i])
+			}
+			if i >= len(text) {
+				return nil, fmt.Errorf("%s line %d: unterminated string", lumpName, line)
+			}
+			tokens = append(tokens, scriptToken{Text: builder.String(), Quoted: true, Line: line})
+			i++
+		default:
+			start := i
+			for i < len(text) && !unicode.IsSpace(rune(text[i])) && !strings.ContainsRune(symbols+"\"", rune(text[i])) &&
+				!strings.HasPrefix(text[i:], "//") && !strings.HasPrefix(text[i:], "/*") {
+				i++
+			}
+			tokens = append(tokens, scriptToken{Text: text[start:i], Line: line})
+		}
+	}
+
+	return tokens, nil
+}
+
+func scriptError(lumpName string, token scriptToken, message string) error {
+	return fmt.Errorf("%s line %d: %s near %q", lumpName, token.Line, message, token.Text)
+}
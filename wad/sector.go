@@ -0,0 +1,69 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const SIZE_SECTOR int = 26
+
+type Sectors []Sector
+type Sector struct {
+	FloorHeight   int16
+	CeilingHeight int16
+	FloorFlat     string
+	CeilingFlat   string
+	LightLevel    int16
+	SpecialType   int16
+	Tag           int16
+}
+
+func (s *Sector) fromBytes(data []byte) {
+	s.FloorHeight = int16(binary.LittleEndian.Uint16(data[0:2]))
+	s.CeilingHeight = int16(binary.LittleEndian.Uint16(data[2:4]))
+	s.FloorFlat = nameToStr(data[4:12])
+	s.CeilingFlat = nameToStr(data[12:20])
+	s.LightLevel = int16(binary.LittleEndian.Uint16(data[20:22]))
+	s.SpecialType = int16(binary.LittleEndian.Uint16(data[22:24]))
+	s.Tag = int16(binary.LittleEndian.Uint16(data[24:26]))
+}
+
+func (s Sector) toBytes() []byte {
+	sbytes := [SIZE_SECTOR]byte{}
+	binary.LittleEndian.PutUint16(sbytes[0:2], uint16(s.FloorHeight))
+	binary.LittleEndian.PutUint16(sbytes[2:4], uint16(s.CeilingHeight))
+	copy(sbytes[4:12], strToName(s.FloorFlat))
+	copy(sbytes[12:20], strToName(s.CeilingFlat))
+	binary.LittleEndian.PutUint16(sbytes[20:22], uint16(s.LightLevel))
+	binary.LittleEndian.PutUint16(sbytes[22:24], uint16(s.SpecialType))
+	binary.LittleEndian.PutUint16(sbytes[24:26], uint16(s.Tag))
+
+	return sbytes[:]
+}
+
+func parseSectors(data []byte) []Sector {
+	numSectors := len(data) / SIZE_SECTOR
+	sectors := make([]Sector, numSectors)
+
+	buf := bytes.NewBuffer(data)
+	for i, s := range sectors {
+		sbytes := buf.Next(SIZE_SECTOR)
+		s.fromBytes(sbytes)
+		sectors[i] = s
+	}
+
+	return sectors
+}
+
+func (sectors Sectors) toLump() Lump {
+	buf := make([]byte, 0, len(sectors)*SIZE_SECTOR)
+	for _, s := range sectors {
+		sbytes := s.toBytes()
+		buf = append(buf, sbytes...)
+	}
+
+	return Lump{
+		Name: LUMP_SECTORS,
+		Data: buf,
+	}
+}
@@ -0,0 +1,66 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const SIZE_SEG int = 12
+
+type Segs []Seg
+type Seg struct {
+	Start     int16
+	End       int16
+	Angle     int16
+	Linedef   int16
+	Direction int16
+	Offset    int16
+}
+
+func (s *Seg) fromBytes(data []byte) {
+	s.Start = int16(binary.LittleEndian.Uint16(data[0:2]))
+	s.End = int16(binary.LittleEndian.Uint16(data[2:4]))
+	s.Angle = int16(binary.LittleEndian.Uint16(data[4:6]))
+	s.Linedef = int16(binary.LittleEndian.Uint16(data[6:8]))
+	s.Direction = int16(binary.LittleEndian.Uint16(data[8:10]))
+	s.Offset = int16(binary.LittleEndian.Uint16(data[10:12]))
+}
+
+func (s Seg) toBytes() []byte {
+	sbytes := [SIZE_SEG]byte{}
+	binary.LittleEndian.PutUint16(sbytes[0:2], uint16(s.Start))
+	binary.LittleEndian.PutUint16(sbytes[2:4], uint16(s.End))
+	binary.LittleEndian.PutUint16(sbytes[4:6], uint16(s.Angle))
+	binary.LittleEndian.PutUint16(sbytes[6:8], uint16(s.Linedef))
+	binary.LittleEndian.PutUint16(sbytes[8:10], uint16(s.Direction))
+	binary.LittleEndian.PutUint16(sbytes[10:12], uint16(s.Offset))
+
+	return sbytes[:]
+}
+
+func parseSegs(data []byte) []Seg {
+	numSegs := len(data) / SIZE_SEG
+	segs := make([]Seg, numSegs)
+
+	buf := bytes.NewBuffer(data)
+	for i, s := range segs {
+		sbytes := buf.Next(SIZE_SEG)
+		s.fromBytes(sbytes)
+		segs[i] = s
+	}
+
+	return segs
+}
+
+func (segs Segs) toLump() Lump {
+	buf := make([]byte, 0, len(segs)*SIZE_SEG)
+	for _, s := range segs {
+		sbytes := s.toBytes()
+		buf = append(buf, sbytes...)
+	}
+
+	return Lump{
+		Name: LUMP_SEGMENTS,
+		Data: buf,
+	}
+}
@@ -0,0 +1,54 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const SIZE_SUBSECTOR int = 4
+
+type Subsectors []Subsector
+type Subsector struct {
+	SegCount int16
+	FirstSeg int16
+}
+
+func (s *Subsector) fromBytes(data []byte) {
+	s.SegCount = int16(binary.LittleEndian.Uint16(data[0:2]))
+	s.FirstSeg = int16(binary.LittleEndian.Uint16(data[2:4]))
+}
+
+func (s Subsector) toBytes() []byte {
+	sbytes := [SIZE_SUBSECTOR]byte{}
+	binary.LittleEndian.PutUint16(sbytes[0:2], uint16(s.SegCount))
+	binary.LittleEndian.PutUint16(sbytes[2:4], uint16(s.FirstSeg))
+
+	return sbytes[:]
+}
+
+func parseSubsectors(data []byte) []Subsector {
+	numSubsectors := len(data) / SIZE_SUBSECTOR
+	subsectors := make([]Subsector, numSubsectors)
+
+	buf := bytes.NewBuffer(data)
+	for i, s := range subsectors {
+		sbytes := buf.Next(SIZE_SUBSECTOR)
+		s.fromBytes(sbytes)
+		subsectors[i] = s
+	}
+
+	return subsectors
+}
+
+func (subsectors Subsectors) toLump() Lump {
+	buf := make([]byte, 0, len(subsectors)*SIZE_SUBSECTOR)
+	for _, s := range subsectors {
+		sbytes := s.toBytes()
+		buf = append(buf, sbytes...)
+	}
+
+	return Lump{
+		Name: LUMP_SUBSECTORS,
+		Data: buf,
+	}
+}
@@ -0,0 +1,549 @@
+package wad
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	LUMP_TEXTURE1 = "TEXTURE1"
+	LUMP_TEXTURE2 = "TEXTURE2"
+	LUMP_PNAMES   = "PNAMES"
+)
+
+const (
+	SIZE_TEXTURE_HEADER int = 22
+	SIZE_TEXTURE_PATCH  int = 10
+	SIZE_PATCH_NAME     int = 8
+)
+
+var ErrTruncatedTextures = errors.New("texture lump is shorter than its contents")
+
+// Wall texture made from patches. Patches are kept by name rather than by their index in
+// PNAMES, so textures can move between WADs.
+type Textures []Texture
+type Texture struct {
+	Name    string
+	Flags   int32
+	Width   int16
+	Height  int16
+	Patches []TexturePatch
+}
+
+type TexturePatch struct {
+	OriginX  int16
+	OriginY  int16
+	Patch    string
+	StepDir  int16
+	Colormap int16
+}
+
+type PatchNames []string
+
+// Texture or flat names, kept in upper case since the engine looks them up ignoring case
+type TextureSet map[string]bool
+
+// Sidedefs of a level that use a texture that doesn't exist
+type MissingTexture struct {
+	Name     string
+	Sidedefs []int
+}
+
+// Sectors of a level that use a flat that doesn't exist
+type MissingFlat struct {
+	Name    string
+	Sectors []int
+}
+
+func (t *Texture) fromBytes(data []byte, patchNames PatchNames) error {
+	if len(data) < SIZE_TEXTURE_HEADER {
+		return ErrTruncatedTextures
+	}
+
+	t.Name = nameToStr(data[0:8])
+	t.Flags = int32(binary.LittleEndian.Uint32(data[8:12]))
+	t.Width = int16(binary.LittleEndian.Uint16(data[12:14]))
+	t.Height = int16(binary.LittleEndian.Uint16(data[14:16]))
+	// data[16:20] is the column directory, which is never used
+	patchCount := int(binary.LittleEndian.Uint16(data[20:22]))
+
+	if len(data) < SIZE_TEXTURE_HEADER+patchCount*SIZE_TEXTURE_PATCH {
+		return ErrTruncatedTextures
+	}
+
+	t.Patches = make([]TexturePatch, patchCount)
+	for i := range t.Patches {
+		pbytes := data[SIZE_TEXTURE_HEADER+i*SIZE_TEXTURE_PATCH:]
+		patchIndex := int(int16(binary.LittleEndian.Uint16(pbytes[4:6])))
+		if patchIndex < 0 || patchIndex >= len(patchNames) {
+			return fmt.Errorf("%s: patch %d isn't in PNAMES", t.Name, patchIndex)
+		}
+
+		t.Patches[i] = TexturePatch{
+			OriginX:  int16(binary.LittleEndian.Uint16(pbytes[0:2])),
+			OriginY:  int16(binary.LittleEndian.Uint16(pbytes[2:4])),
+			Patch:    patchNames[patchIndex],
+			StepDir:  int16(binary.LittleEndian.Uint16(pbytes[6:8])),
+			Colormap: int16(binary.LittleEndian.Uint16(pbytes[8:10])),
+		}
+	}
+
+	return nil
+}
+
+func (t Texture) toBytes(patchNames PatchNames) []byte {
+	tbytes := make([]byte, SIZE_TEXTURE_HEADER+len(t.Patches)*SIZE_TEXTURE_PATCH)
+	copy(tbytes[0:8], strToName(t.Name))
+	binary.LittleEndian.PutUint32(tbytes[8:12], uint32(t.Flags))
+	binary.LittleEndian.PutUint16(tbytes[12:14], uint16(t.Width))
+	binary.LittleEndian.PutUint16(tbytes[14:16], uint16(t.Height))
+	binary.LittleEndian.PutUint16(tbytes[20:22], uint16(len(t.Patches)))
+
+	for i, patch := range t.Patches {
+		pbytes := tbytes[SIZE_TEXTURE_HEADER+i*SIZE_TEXTURE_PATCH:]
+		binary.LittleEndian.PutUint16(pbytes[0:2], uint16(patch.OriginX))
+		binary.LittleEndian.PutUint16(pbytes[2:4], uint16(patch.OriginY))
+		binary.LittleEndian.PutUint16(pbytes[4:6], uint16(patchNames.index(patch.Patch)))
+		binary.LittleEndian.PutUint16(pbytes[6:8], uint16(patch.StepDir))
+		binary.LittleEndian.PutUint16(pbytes[8:10], uint16(patch.Colormap))
+	}
+
+	return tbytes
+}
+
+// A TEXTURE1 or TEXTURE2 lump is a count, an offset to each texture, then the textures
+func ParseTextures(data []byte, patchNames PatchNames) (Textures, error) {
+	if len(data) < 4 {
+		return nil, ErrTruncatedTextures
+	}
+
+	numTextures := int(binary.LittleEndian.Uint32(data[0:4]))
+	if numTextures < 0 || len(data) < 4+numTextures*4 {
+		return nil, ErrTruncatedTextures
+	}
+
+	textures := make([]Texture, numTextures)
+	for i := range textures {
+		offset := int(binary.LittleEndian.Uint32(data[4+i*4:]))
+		if offset < 0 || offset > len(data) {
+			return nil, ErrTruncatedTextures
+		}
+
+		err := textures[i].fromBytes(data[offset:], patchNames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return textures, nil
+}
+
+// Patch names have to be in PNAMES already
+func (textures Textures) ToLump(name string, patchNames PatchNames) Lump {
+	offset := 4 + len(textures)*4
+	buf := make([]byte, offset)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(textures)))
+
+	for i, t := range textures {
+		binary.LittleEndian.PutUint32(buf[4+i*4:], uint32(len(buf)))
+		buf = append(buf, t.toBytes(patchNames)...)
+	}
+
+	return Lump{
+		Name: name,
+		Data: buf,
+	}
+}
+
+func ParsePatchNames(data []byte) (PatchNames, error) {
+	if len(data) < 4 {
+		return nil, ErrTruncatedTextures
+	}
+
+	numPatches := int(binary.LittleEndian.Uint32(data[0:4]))
+	if numPatches < 0 || len(data) < 4+numPatches*SIZE_PATCH_NAME {
+		return nil, ErrTruncatedTextures
+	}
+
+	patchNames := make(PatchNames, numPatches)
+	for i := range patchNames {
+		offset := 4 + i*SIZE_PATCH_NAME
+		patchNames[i] = strings.ToUpper(nameToStr(data[offset : offset+SIZE_PATCH_NAME]))
+	}
+
+	return patchNames, nil
+}
+
+func (patchNames PatchNames) ToLump() Lump {
+	buf := make([]byte, 4, 4+len(patchNames)*SIZE_PATCH_NAME)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(patchNames)))
+	for _, name := range patchNames {
+		buf = append(buf, strToName(name)...)
+	}
+
+	return Lump{
+		Name: LUMP_PNAMES,
+		Data: buf,
+	}
+}
+
+func (patchNames PatchNames) index(name string) int {
+	for i, patchName := range patchNames {
+		if strings.EqualFold(patchName, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Adds the names that aren't in the list yet, keeping the indexes of the ones that are
+func (patchNames *PatchNames) add(names ...string) {
+	for _, name := range names {
+		if patchNames.index(name) < 0 {
+			*patchNames = append(*patchNames, strings.ToUpper(name))
+		}
+	}
+}
+
+// Adds the other textures, replacing any of the same name in place
+func (textures *Textures) merge(other Textures) {
+	for _, t := range other {
+		replaced := false
+		for i := range *textures {
+			if strings.EqualFold((*textures)[i].Name, t.Name) {
+				(*textures)[i] = t
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			*textures = append(*textures, t)
+		}
+	}
+}
+
+// Floor and ceiling flat of each sector
+func (l Level) sectorFlats() [][]string {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		blocks := l.TextMap.BlocksOfType(UDMF_SECTOR)
+		flats := make([][]string, len(blocks))
+		for i, block := range blocks {
+			flats[i] = []string{block.String("texturefloor", "-"), block.String("textureceiling", "-")}
+		}
+		return flats
+	}
+
+	flats := make([][]string, len(l.Sectors))
+	for i, sector := range l.Sectors {
+		flats[i] = []string{sector.FloorFlat, sector.CeilingFlat}
+	}
+	return flats
+}
+
+// The last PNAMES in the WAD, or nil if it doesn't have one. The lump is loaded if the file was
+// opened lazily, so an IWAD's textures can be read without parsing its levels.
+func (wf *WadFile) PatchNames() (PatchNames, error) {
+	i := lastLumpIndex(wf.Lumps, LUMP_PNAMES)
+	if i < 0 {
+		return nil, nil
+	}
+
+	err := wf.Lumps[i].Load()
+	if err != nil {
+		return nil, err
+	}
+	return ParsePatchNames(wf.Lumps[i].Data)
+}
+
+// Textures defined by every TEXTURE1 and TEXTURE2 in the WAD, with later ones replacing earlier
+// ones of the same name. A PWAD with textures but no PNAMES uses the PNAMES of the IWAD it's
+// played with, which is given as basePatchNames.
+func (wf *WadFile) Textures(basePatchNames PatchNames) (Textures, error) {
+	patchNames, err := wf.PatchNames()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", LUMP_PNAMES, err)
+	}
+	if patchNames == nil {
+		patchNames = basePatchNames
+	}
+
+	textures := Textures{}
+	for i, lump := range wf.Lumps {
+		if lump.Name != LUMP_TEXTURE1 && lump.Name != LUMP_TEXTURE2 {
+			continue
+		}
+
+		err = wf.Lumps[i].Load()
+		if err != nil {
+			return nil, err
+		}
+		lumpTextures, err := ParseTextures(wf.Lumps[i].Data, patchNames)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", lump.Name, err)
+		}
+		textures.merge(lumpTextures)
+	}
+
+	return textures, nil
+}
+
+func NewTextureSet(textures ...Textures) TextureSet {
+	set := TextureSet{}
+	for _, list := range textures {
+		for _, t := range list {
+			set[strings.ToUpper(t.Name)] = true
+		}
+	}
+	return set
+}
+
+// "-" means a sidedef has no texture there, so it's always available
+func (set TextureSet) Contains(name string) bool {
+	return name == "" || name == "-" || set[strings.ToUpper(name)]
+}
+
+// Textures used by the level's sidedefs that aren't in the set, sorted by name. The level has
+// to be loaded.
+func (l Level) MissingTextures(available TextureSet) []MissingTexture {
+	missing := []MissingTexture{}
+	for name, sidedefs := range missingNames(l.sidedefTextures(), available) {
+		missing = append(missing, MissingTexture{Name: name, Sidedefs: sidedefs})
+	}
+	slices.SortFunc(missing, func(a MissingTexture, b MissingTexture) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return missing
+}
+
+// Flats used by the level's sectors that aren't in the set, sorted by name. The level has to
+// be loaded.
+func (l Level) MissingFlats(available TextureSet) []MissingFlat {
+	missing := []MissingFlat{}
+	for name, sectors := range missingNames(l.sectorFlats(), available) {
+		missing = append(missing, MissingFlat{Name: name, Sectors: sectors})
+	}
+	slices.SortFunc(missing, func(a MissingFlat, b MissingFlat) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return missing
+}
+
+// Indexes of the elements using each name that isn't in the set
+func missingNames(elements [][]string, available TextureSet) map[string][]int {
+	missing := map[string][]int{}
+	for i, names := range elements {
+		for _, name := range names {
+			if available.Contains(name) {
+				continue
+			}
+
+			name = strings.ToUpper(name)
+			if !slices.Contains(missing[name], i) {
+				missing[name] = append(missing[name], i)
+			}
+		}
+	}
+	return missing
+}
+
+// Upper, lower and middle texture of each sidedef
+func (l Level) sidedefTextures() [][]string {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		blocks := l.TextMap.BlocksOfType(UDMF_SIDEDEF)
+		textures := make([][]string, len(blocks))
+		for i, block := range blocks {
+			textures[i] = []string{block.String("texturetop", "-"), block.String("texturebottom", "-"), block.String("texturemiddle", "-")}
+		}
+		return textures
+	}
+
+	textures := make([][]string, len(l.Sidedefs))
+	for i, sidedef := range l.Sidedefs {
+		textures[i] = []string{sidedef.UpperTex, sidedef.LowerTex, sidedef.MiddleTex}
+	}
+	return textures
+}
+
+// Copies the named textures from another WAD, such as the Doom IWAD, along with the patch lumps
+// they're made of, and returns the ones it found. The textures go in the WAD's TEXTURE2, since a
+// PWAD's TEXTURE1 replaces the one in the IWAD it's played with. Its PNAMES replaces the IWAD's
+// too, so a WAD without one starts from the IWAD's. Patch lumps the IWAD already has aren't
+// copied.
+func (wf *WadFile) CopyTextures(names []string, source *WadFile, iwad *WadFile) (Textures, error) {
+	sourcePatchNames, err := source.PatchNames()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", LUMP_PNAMES, err)
+	}
+	sourceTextures, err := source.Textures(sourcePatchNames)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := Textures{}
+	for _, t := range sourceTextures {
+		if slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, t.Name) }) {
+			copied = append(copied, t)
+		}
+	}
+	if len(copied) == 0 {
+		return copied, nil
+	}
+
+	patchNames, err := wf.PatchNames()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", LUMP_PNAMES, err)
+	}
+	if patchNames == nil {
+		patchNames, err = iwad.PatchNames()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", LUMP_PNAMES, err)
+		}
+	}
+
+	textures := Textures{}
+	textureIndex := lastLumpIndex(wf.Lumps, LUMP_TEXTURE2)
+	if textureIndex >= 0 {
+		err = wf.Lumps[textureIndex].Load()
+		if err != nil {
+			return nil, err
+		}
+		textures, err = ParseTextures(wf.Lumps[textureIndex].Data, patchNames)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", LUMP_TEXTURE2, err)
+		}
+	}
+	textures.merge(copied)
+
+	patchLumps := []Lump{}
+	for _, t := range copied {
+		for _, patch := range t.Patches {
+			patchNames.add(patch.Patch)
+			if hasLump(patchLumps, patch.Patch) || hasLump(iwad.Lumps, patch.Patch) || hasLump(wf.Lumps, patch.Patch) {
+				continue
+			}
+
+			patchLump, err := findPatchLump(source, patch.Patch)
+			if err != nil {
+				return nil, err
+			}
+			patchLumps = append(patchLumps, patchLump)
+		}
+	}
+
+	wf.Lumps = setLump(wf.Lumps, patchNames.ToLump())
+	wf.Lumps = setLump(wf.Lumps, textures.ToLump(LUMP_TEXTURE2, patchNames))
+	if len(patchLumps) > 0 {
+		patches := NAMESPACES[namespaceStart("P_START")]
+		wf.Lumps = append(wf.Lumps, Lump{Name: patches.Starts[0], Data: []byte{}})
+		wf.Lumps = append(wf.Lumps, patchLumps...)
+		wf.Lumps = append(wf.Lumps, Lump{Name: patches.Ends[0], Data: []byte{}})
+	}
+
+	return copied, nil
+}
+
+func hasLump(lumps []Lump, name string) bool {
+	return slices.ContainsFunc(lumps, func(lump Lump) bool { return strings.EqualFold(lump.Name, name) })
+}
+
+// The engine uses the last lump of a name, so that's the one copied
+func findPatchLump(wf *WadFile, name string) (Lump, error) {
+	for i := len(wf.Lumps) - 1; i >= 0; i-- {
+		if !strings.EqualFold(wf.Lumps[i].Name, name) {
+			continue
+		}
+
+		err := wf.Lumps[i].Load()
+		if err != nil {
+			return Lump{}, err
+		}
+		return Lump{Name: strings.ToUpper(name), Data: wf.Lumps[i].Data}, nil
+	}
+	return Lump{}, fmt.Errorf("patch %s isn't in the WAD", name)
+}
+
+// The engine uses the last lump of a name, so that's the one read and replaced
+func lastLumpIndex(lumps []Lump, name string) int {
+	for i := len(lumps) - 1; i >= 0; i-- {
+		if lumps[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Replaces the last lump of the same name, keeping its place, or adds the lump at the end
+func setLump(lumps []Lump, lump Lump) []Lump {
+	index := lastLumpIndex(lumps, lump.Name)
+	if index < 0 {
+		return append(lumps, lump)
+	}
+
+	lump.order = lumps[index].order
+	lumps[index] = lump
+	return lumps
+}
+
+// Names of the lumps between flat markers, which don't need loading to be listed
+func (wf WadFile) Flats() TextureSet {
+	flats := TextureSet{}
+	for _, i := range wf.flatLumps() {
+		flats[strings.ToUpper(wf.Lumps[i].Name)] = true
+	}
+	return flats
+}
+
+// Indexes of the lumps between flat markers
+func (wf WadFile) flatLumps() []int {
+	flats := []int{}
+	namespace := NAMESPACES[namespaceStart("F_START")]
+	inFlats := false
+	for i, lump := range wf.Lumps {
+		switch {
+		case slices.Contains(namespace.Starts, lump.Name):
+			inFlats = true
+		case slices.Contains(namespace.Ends, lump.Name):
+			inFlats = false
+		case inFlats && !subNamespaceMarkerRegexp.MatchString(lump.Name):
+			flats = append(flats, i)
+		}
+	}
+	return flats
+}
+
+// Copies the named flats from another WAD, such as the Doom IWAD, and returns the ones it
+// found. They go between FF_START and FF_END, which ports read flats from in PWADs.
+func (wf *WadFile) CopyFlats(names []string, source *WadFile) ([]string, error) {
+	copied := []string{}
+	flatLumps := []Lump{}
+	sourceFlats := source.flatLumps()
+	for _, name := range names {
+		// The engine uses the last flat of a name
+		for j := len(sourceFlats) - 1; j >= 0; j-- {
+			lump := &source.Lumps[sourceFlats[j]]
+			if !strings.EqualFold(lump.Name, name) || hasLump(flatLumps, name) {
+				continue
+			}
+
+			err := lump.Load()
+			if err != nil {
+				return nil, err
+			}
+			flatLumps = append(flatLumps, Lump{Name: strings.ToUpper(name), Data: lump.Data})
+			copied = append(copied, strings.ToUpper(name))
+			break
+		}
+	}
+
+	if len(flatLumps) > 0 {
+		flats := NAMESPACES[namespaceStart("F_START")]
+		wf.Lumps = append(wf.Lumps, Lump{Name: flats.Starts[1], Data: []byte{}})
+		wf.Lumps = append(wf.Lumps, flatLumps...)
+		wf.Lumps = append(wf.Lumps, Lump{Name: flats.Ends[1], Data: []byte{}})
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,209 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestTexturesRoundTrip(t *testing.T) {
+	patchNames := PatchNames{"WALL00_1", "WALL01_1", "SW1_1", "DOOR2_1"}
+
+	tests := []struct {
+		name     string
+		textures Textures
+	}{
+		{name: "no textures", textures: Textures{}},
+		{
+			name: "one patch",
+			textures: Textures{
+				{Name: "AASTINKY", Width: 24, Height: 72, Patches: []TexturePatch{{Patch: "WALL00_1", StepDir: 1}}},
+			},
+		},
+		{
+			name: "several patches",
+			textures: Textures{
+				{Name: "STARTAN3", Width: 128, Height: 128, Patches: []TexturePatch{
+					{OriginX: 0, OriginY: 0, Patch: "WALL01_1"},
+					{OriginX: 64, OriginY: -8, Patch: "SW1_1", Colormap: 2},
+				}},
+				{Name: "BIGDOOR1", Flags: 0x8000, Width: 128, Height: 96, Patches: []TexturePatch{
+					{OriginX: -4, OriginY: 0, Patch: "DOOR2_1"},
+				}},
+				{Name: "EMPTY", Width: 64, Height: 64, Patches: []TexturePatch{}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lump := test.textures.ToLump(LUMP_TEXTURE1, patchNames)
+			if lump.Name != LUMP_TEXTURE1 {
+				t.Errorf("ToLump() name = %s, want %s", lump.Name, LUMP_TEXTURE1)
+			}
+
+			textures, err := ParseTextures(lump.Data, patchNames)
+			if err != nil {
+				t.Fatalf("ParseTextures() error = %v", err)
+			}
+			if !reflect.DeepEqual(textures, test.textures) {
+				t.Errorf("ParseTextures(ToLump()) = %+v, want %+v", textures, test.textures)
+			}
+
+			// Parsing and writing again gives the same bytes
+			if again := textures.ToLump(LUMP_TEXTURE1, patchNames); !bytes.Equal(again.Data, lump.Data) {
+				t.Errorf("ToLump(ParseTextures()) = %v, want %v", again.Data, lump.Data)
+			}
+		})
+	}
+}
+
+func TestTexturesLayout(t *testing.T) {
+	textures := Textures{{Name: "STEP1", Width: 32, Height: 16, Patches: []TexturePatch{{OriginX: 1, OriginY: 2, Patch: "STEP03", StepDir: 1}}}}
+	data := textures.ToLump(LUMP_TEXTURE2, PatchNames{"STEP01", "STEP03"}).Data
+
+	// Count, one offset, then the 22 byte header and one 10 byte patch
+	want := []byte{
+		1, 0, 0, 0,
+		8, 0, 0, 0,
+		'S', 'T', 'E', 'P', '1', 0, 0, 0, 0, 0, 0, 0, 32, 0, 16, 0, 0, 0, 0, 0, 1, 0,
+		1, 0, 2, 0, 1, 0, 1, 0, 0, 0,
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("ToLump() = %v, want %v", data, want)
+	}
+}
+
+func TestParseTexturesErrors(t *testing.T) {
+	valid := Textures{{Name: "STEP1", Width: 32, Height: 16, Patches: []TexturePatch{{Patch: "STEP03"}}}}.
+		ToLump(LUMP_TEXTURE1, PatchNames{"STEP03"}).Data
+
+	tests := []struct {
+		name       string
+		data       []byte
+		patchNames PatchNames
+		wantErr    error
+	}{
+		{name: "empty", data: []byte{}, patchNames: PatchNames{"STEP03"}, wantErr: ErrTruncatedTextures},
+		{name: "missing offsets", data: []byte{2, 0, 0, 0, 8, 0, 0, 0}, patchNames: PatchNames{"STEP03"}, wantErr: ErrTruncatedTextures},
+		{name: "truncated patches", data: valid[:len(valid)-1], patchNames: PatchNames{"STEP03"}, wantErr: ErrTruncatedTextures},
+		{name: "patch not in PNAMES", data: valid, patchNames: PatchNames{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseTextures(test.data, test.patchNames)
+			if err == nil {
+				t.Fatalf("ParseTextures() error = nil, want an error")
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("ParseTextures() error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPatchNamesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want PatchNames
+	}{
+		{name: "no patches", data: []byte{0, 0, 0, 0}, want: PatchNames{}},
+		{name: "padded names", data: patchNamesData("WALL00_1", "SW1_1"), want: PatchNames{"WALL00_1", "SW1_1"}},
+		{name: "lower case names", data: patchNamesData("wall00_1", "Sw1_1"), want: PatchNames{"WALL00_1", "SW1_1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patchNames, err := ParsePatchNames(test.data)
+			if err != nil {
+				t.Fatalf("ParsePatchNames() error = %v", err)
+			}
+			if !slices.Equal(patchNames, test.want) {
+				t.Errorf("ParsePatchNames() = %v, want %v", patchNames, test.want)
+			}
+
+			reparsed, err := ParsePatchNames(patchNames.ToLump().Data)
+			if err != nil {
+				t.Fatalf("ParsePatchNames(ToLump()) error = %v", err)
+			}
+			if !slices.Equal(reparsed, patchNames) {
+				t.Errorf("ParsePatchNames(ToLump()) = %v, want %v", reparsed, patchNames)
+			}
+		})
+	}
+
+	_, err := ParsePatchNames(patchNamesData("WALL00_1")[:10])
+	if !errors.Is(err, ErrTruncatedTextures) {
+		t.Errorf("ParsePatchNames() of a truncated lump error = %v, want %v", err, ErrTruncatedTextures)
+	}
+}
+
+func TestCopyTexturesUsesLastLumps(t *testing.T) {
+	newTexture := Textures{{Name: "NEWTEX", Width: 64, Height: 64, Patches: []TexturePatch{{Patch: "SRCPATCH"}}}}
+	source := NewFile("")
+	source.Lumps = []Lump{
+		PatchNames{"SRCPATCH"}.ToLump(),
+		newTexture.ToLump(LUMP_TEXTURE1, PatchNames{"SRCPATCH"}),
+		{Name: "SRCPATCH", Data: []byte{1, 2, 3}},
+	}
+	iwad := NewFile("")
+
+	// The engine only uses the second PNAMES and TEXTURE2, so those are the ones added to
+	stalePatchNames := PatchNames{"OLD"}.ToLump()
+	staleTextures := Textures{{Name: "OLDTEX", Width: 64, Height: 64, Patches: []TexturePatch{{Patch: "OLD"}}}}.ToLump(LUMP_TEXTURE2, PatchNames{"OLD"})
+	keptTexture := Textures{{Name: "KEPTTEX", Width: 64, Height: 64, Patches: []TexturePatch{{Patch: "KEPT"}}}}
+	wf := NewFile("")
+	wf.Lumps = []Lump{
+		stalePatchNames,
+		staleTextures,
+		PatchNames{"OLD", "KEPT"}.ToLump(),
+		keptTexture.ToLump(LUMP_TEXTURE2, PatchNames{"OLD", "KEPT"}),
+	}
+
+	copied, err := wf.CopyTextures([]string{"newtex"}, source, iwad)
+	if err != nil {
+		t.Fatalf("CopyTextures() error = %v", err)
+	}
+	if !reflect.DeepEqual(copied, newTexture) {
+		t.Errorf("CopyTextures() = %+v, want %+v", copied, newTexture)
+	}
+
+	if !bytes.Equal(wf.Lumps[0].Data, stalePatchNames.Data) || !bytes.Equal(wf.Lumps[1].Data, staleTextures.Data) {
+		t.Errorf("CopyTextures() changed the first PNAMES or TEXTURE2")
+	}
+	patchNames, err := wf.PatchNames()
+	if err != nil {
+		t.Fatalf("PatchNames() error = %v", err)
+	}
+	if want := (PatchNames{"OLD", "KEPT", "SRCPATCH"}); !slices.Equal(patchNames, want) {
+		t.Errorf("PatchNames() = %v, want %v", patchNames, want)
+	}
+	textures, err := ParseTextures(wf.Lumps[3].Data, patchNames)
+	if err != nil {
+		t.Fatalf("ParseTextures() error = %v", err)
+	}
+	if want := append(slices.Clone(keptTexture), newTexture...); !reflect.DeepEqual(textures, want) {
+		t.Errorf("TEXTURE2 = %+v, want %+v", textures, want)
+	}
+
+	names := []string{}
+	for _, lump := range wf.Lumps[4:] {
+		names = append(names, lump.Name)
+	}
+	if want := []string{"P_START", "SRCPATCH", "P_END"}; !slices.Equal(names, want) {
+		t.Errorf("CopyTextures() added %v, want %v", names, want)
+	}
+}
+
+func patchNamesData(names ...string) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(names)))
+	for _, name := range names {
+		data = append(data, strToName(name)...)
+	}
+	return data
+}
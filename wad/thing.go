@@ -8,6 +8,14 @@
 
 const SIZE_THING int = 10
 
+const (
+	THING_FLAG_EASY        int16 = 0x0001
+	THING_FLAG_MEDIUM      int16 = 0x0002
+	THING_FLAG_HARD        int16 = 0x0004
+	THING_FLAG_AMBUSH      int16 = 0x0008
+	THING_FLAG_MULTIPLAYER int16 = 0x0010
+)
+
 type Things []Thing
 type Thing struct {
 	X     int16
@@ -0,0 +1,251 @@
+package wad
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	LUMP_TEXTMAP = "TEXTMAP"
+	LUMP_ENDMAP  = "ENDMAP"
+)
+
+const (
+	NAMESPACE_DOOM    = "doom"
+	NAMESPACE_HERETIC = "heretic"
+	NAMESPACE_HEXEN   = "hexen"
+	NAMESPACE_ZDOOM   = "zdoom"
+)
+
+const (
+	UDMF_THING   = "thing"
+	UDMF_VERTEX  = "vertex"
+	UDMF_LINEDEF = "linedef"
+	UDMF_SIDEDEF = "sidedef"
+	UDMF_SECTOR  = "sector"
+)
+
+// Unquoted identifiers used as values, other than true and false
+type UDMFKeyword string
+
+// Values are one of int64, float64, bool, string or UDMFKeyword
+type UDMFProperty struct {
+	Key   string
+	Value any
+}
+
+type UDMFBlock struct {
+	Type       string
+	Properties []UDMFProperty
+}
+
+type TextMap struct {
+	Namespace  string
+	Properties []UDMFProperty
+	Blocks     []UDMFBlock
+}
+
+func (b UDMFBlock) Get(key string) (any, bool) {
+	for _, property := range b.Properties {
+		if property.Key == key {
+			return property.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (b *UDMFBlock) Set(key string, value any) {
+	for i, property := range b.Properties {
+		if property.Key == key {
+			b.Properties[i].Value = value
+			return
+		}
+	}
+	b.Properties = append(b.Properties, UDMFProperty{Key: key, Value: value})
+}
+
+func (b UDMFBlock) Int(key string, fallback int64) int64 {
+	value, _ := b.Get(key)
+	switch v := value.(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return fallback
+}
+
+func (b UDMFBlock) Float(key string, fallback float64) float64 {
+	value, _ := b.Get(key)
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return fallback
+}
+
+func (b UDMFBlock) Bool(key string) bool {
+	value, _ := b.Get(key)
+	v, _ := value.(bool)
+	return v
+}
+
+func (b UDMFBlock) String(key string, fallback string) string {
+	value, _ := b.Get(key)
+	if v, ok := value.(string); ok {
+		return v
+	}
+	return fallback
+}
+
+func (tm TextMap) BlocksOfType(blockType string) []UDMFBlock {
+	blocks := make([]UDMFBlock, 0, len(tm.Blocks))
+	for _, block := range tm.Blocks {
+		if block.Type == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func ParseTextMap(data []byte) (*TextMap, error) {
+	tokens, err := tokenizeScript(LUMP_TEXTMAP, string(data), "{}=;")
+	if err != nil {
+		return nil, err
+	}
+
+	tm := &TextMap{}
+	for i := 0; i < len(tokens); {
+		if tokens[i].Quoted || !isUDMFIdentifier(tokens[i].Text) {
+			return nil, scriptError(LUMP_TEXTMAP, tokens[i], "expected identifier")
+		}
+		key := strings.ToLower(tokens[i].Text)
+
+		if i+1 >= len(tokens) {
+			return nil, scriptError(LUMP_TEXTMAP, tokens[i], "unexpected end of TEXTMAP")
+		}
+
+		switch tokens[i+1].Text {
+		case "=":
+			value, next, err := parseUDMFAssignment(tokens, i+2)
+			if err != nil {
+				return nil, err
+			}
+			if key == "namespace" {
+				tm.Namespace = strings.ToLower(fmt.Sprint(value))
+			} else {
+				tm.Properties = append(tm.Properties, UDMFProperty{Key: key, Value: value})
+			}
+			i = next
+		case "{":
+			block := UDMFBlock{Type: key}
+			i += 2
+			for i < len(tokens) && !(tokens[i].Text == "}" && !tokens[i].Quoted) {
+				if i+1 >= len(tokens) || tokens[i+1].Text != "=" {
+					return nil, scriptError(LUMP_TEXTMAP, tokens[i], "expected assignment")
+				}
+				value, next, err := parseUDMFAssignment(tokens, i+2)
+				if err != nil {
+					return nil, err
+				}
+				block.Properties = append(block.Properties, UDMFProperty{Key: strings.ToLower(tokens[i].Text), Value: value})
+				i = next
+			}
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("TEXTMAP: unterminated %s block", key)
+			}
+			tm.Blocks = append(tm.Blocks, block)
+			i++
+		default:
+			return nil, scriptError(LUMP_TEXTMAP, tokens[i+1], "expected '=' or '{'")
+		}
+	}
+
+	if tm.Namespace == "" {
+		return nil, fmt.Errorf("TEXTMAP: missing namespace")
+	}
+
+	return tm, nil
+}
+
+// Parses "value ;" starting at the value, returning the index of the token after the semicolon
+func parseUDMFAssignment(tokens []scriptToken, i int) (any, int, error) {
+	if i+1 >= len(tokens) {
+		return nil, i, fmt.Errorf("TEXTMAP: unexpected end of assignment")
+	}
+	if tokens[i+1].Text != ";" || tokens[i+1].Quoted {
+		return nil, i, scriptError(LUMP_TEXTMAP, tokens[i+1], "expected ';'")
+	}
+
+	token := tokens[i]
+	if token.Quoted {
+		return token.Text, i + 2, nil
+	}
+
+	lower := strings.ToLower(token.Text)
+	switch {
+	case lower == "true":
+		return true, i + 2, nil
+	case lower == "false":
+		return false, i + 2, nil
+	case isUDMFIdentifier(token.Text):
+		return UDMFKeyword(token.Text), i + 2, nil
+	}
+
+	if value, err := strconv.ParseInt(token.Text, 0, 64); err == nil {
+		return value, i + 2, nil
+	}
+	if value, err := strconv.ParseFloat(token.Text, 64); err == nil {
+		return value, i + 2, nil
+	}
+
+	return nil, i, scriptError(LUMP_TEXTMAP, token, "invalid value")
+}
+
+func isUDMFIdentifier(text string) bool {
+	if text == "" {
+		return false
+	}
+	for i, r := range text {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
+
+func (tm TextMap) toBytes() []byte {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("namespace = %s;\n", formatUDMFValue(tm.Namespace)))
+	for _, property := range tm.Properties {
+		builder.WriteString(fmt.Sprintf("%s = %s;\n", property.Key, formatUDMFValue(property.Value)))
+	}
+
+	for _, block := range tm.Blocks {
+		builder.WriteString(fmt.Sprintf("\n%s\n{\n", block.Type))
+		for _, property := range block.Properties {
+			builder.WriteString(fmt.Sprintf("%s = %s;\n", property.Key, formatUDMFValue(property.Value)))
+		}
+		builder.WriteString("}\n")
+	}
+
+	return []byte(builder.String())
+}
+
+func formatUDMFValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	case float64:
+		formatted := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(formatted, ".eE") {
+			formatted += ".0"
+		}
+		return formatted
+	}
+	return fmt.Sprint(value)
+}
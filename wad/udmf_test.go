@@ -0,0 +1,174 @@
+package wad
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestTextMapRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want TextMap
+	}{
+		{
+			name: "namespace only",
+			data: `namespace = "doom";`,
+			want: TextMap{Namespace: NAMESPACE_DOOM},
+		},
+		{
+			name: "value types",
+			data: `Namespace = "ZDoom";
+				// Comments and case are ignored
+				thing { x = 32.5; y = -0x10; type = 1; ambush = true; single = FALSE; comment = "say \"hi\""; renderstyle = add; }`,
+			want: TextMap{
+				Namespace: NAMESPACE_ZDOOM,
+				Blocks: []UDMFBlock{{Type: UDMF_THING, Properties: []UDMFProperty{
+					{Key: "x", Value: 32.5},
+					{Key: "y", Value: int64(-16)},
+					{Key: "type", Value: int64(1)},
+					{Key: "ambush", Value: true},
+					{Key: "single", Value: false},
+					{Key: "comment", Value: `say "hi"`},
+					{Key: "renderstyle", Value: UDMFKeyword("add")},
+				}}},
+			},
+		},
+		{
+			name: "global properties and blocks",
+			data: `namespace = "hexen"; ignored = 1.0;
+				vertex { x = 0.0; y = 0.0; }
+				vertex { x = 64.0; y = 0.0; }
+				linedef { v1 = 0; v2 = 1; sidefront = 0; special = 244; }
+				sidedef { sector = 0; texturemiddle = "STARTAN2"; }
+				sector { texturefloor = "FLOOR4_8"; textureceiling = "CEIL3_5"; }`,
+			want: TextMap{
+				Namespace:  NAMESPACE_HEXEN,
+				Properties: []UDMFProperty{{Key: "ignored", Value: 1.0}},
+				Blocks: []UDMFBlock{
+					{Type: UDMF_VERTEX, Properties: []UDMFProperty{{Key: "x", Value: 0.0}, {Key: "y", Value: 0.0}}},
+					{Type: UDMF_VERTEX, Properties: []UDMFProperty{{Key: "x", Value: 64.0}, {Key: "y", Value: 0.0}}},
+					{Type: UDMF_LINEDEF, Properties: []UDMFProperty{
+						{Key: "v1", Value: int64(0)},
+						{Key: "v2", Value: int64(1)},
+						{Key: "sidefront", Value: int64(0)},
+						{Key: "special", Value: int64(244)},
+					}},
+					{Type: UDMF_SIDEDEF, Properties: []UDMFProperty{{Key: "sector", Value: int64(0)}, {Key: "texturemiddle", Value: "STARTAN2"}}},
+					{Type: UDMF_SECTOR, Properties: []UDMFProperty{{Key: "texturefloor", Value: "FLOOR4_8"}, {Key: "textureceiling", Value: "CEIL3_5"}}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tm, err := ParseTextMap([]byte(test.data))
+			if err != nil {
+				t.Fatalf("ParseTextMap() error = %v", err)
+			}
+			if !reflect.DeepEqual(*tm, test.want) {
+				t.Errorf("ParseTextMap() = %+v, want %+v", *tm, test.want)
+			}
+
+			reparsed, err := ParseTextMap(tm.toBytes())
+			if err != nil {
+				t.Fatalf("ParseTextMap(toBytes()) error = %v\n%s", err, tm.toBytes())
+			}
+			if !reflect.DeepEqual(reparsed, tm) {
+				t.Errorf("ParseTextMap(toBytes()) = %+v, want %+v", *reparsed, *tm)
+			}
+		})
+	}
+}
+
+func TestParseTextMapErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: ""},
+		{name: "no namespace", data: `thing { x = 0.0; }`},
+		{name: "missing semicolon", data: `namespace = "doom" thing { x = 0.0; }`},
+		{name: "unterminated block", data: `namespace = "doom"; thing { x = 0.0;`},
+		{name: "invalid value", data: `namespace = "doom"; thing { x = 1.2.3; }`},
+		{name: "nested block", data: `namespace = "doom"; thing { vertex { x = 0.0; } }`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseTextMap([]byte(test.data))
+			if err == nil {
+				t.Errorf("ParseTextMap() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestUDMFLevelAsDoom(t *testing.T) {
+	textMap := func(namespace string, special int64) *TextMap {
+		return &TextMap{
+			Namespace: namespace,
+			Blocks: []UDMFBlock{
+				{Type: UDMF_THING, Properties: []UDMFProperty{
+					{Key: "x", Value: 31.6},
+					{Key: "y", Value: int64(-64)},
+					{Key: "type", Value: int64(1)},
+					{Key: "skill1", Value: true},
+					{Key: "single", Value: true},
+				}},
+				{Type: UDMF_VERTEX, Properties: []UDMFProperty{{Key: "x", Value: 0.0}, {Key: "y", Value: 0.0}}},
+				{Type: UDMF_VERTEX, Properties: []UDMFProperty{{Key: "x", Value: 64.4}, {Key: "y", Value: 0.0}}},
+				{Type: UDMF_LINEDEF, Properties: []UDMFProperty{
+					{Key: "v1", Value: int64(0)},
+					{Key: "v2", Value: int64(1)},
+					{Key: "sidefront", Value: int64(0)},
+					{Key: "special", Value: special},
+				}},
+				{Type: UDMF_SIDEDEF, Properties: []UDMFProperty{{Key: "sector", Value: int64(0)}, {Key: "texturemiddle", Value: "STARTAN2"}}},
+				{Type: UDMF_SECTOR, Properties: []UDMFProperty{{Key: "texturefloor", Value: "FLOOR4_8"}, {Key: "textureceiling", Value: "CEIL3_5"}}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		textMap    *TextMap
+		secretExit bool
+	}{
+		{name: "doom exit", textMap: textMap(NAMESPACE_DOOM, 11), secretExit: false},
+		{name: "doom secret exit", textMap: textMap(NAMESPACE_DOOM, 51), secretExit: true},
+		{name: "hexen secret exit", textMap: textMap(NAMESPACE_HEXEN, int64(HEXEN_SECRET_EXIT_SPECIAL)), secretExit: true},
+		{name: "hexen doom special", textMap: textMap(NAMESPACE_HEXEN, 51), secretExit: false},
+		{name: "zdoom secret exit", textMap: textMap(NAMESPACE_ZDOOM, int64(HEXEN_SECRET_EXIT_SPECIAL)), secretExit: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			level := Level{Slot: "MAP01", Format: LEVEL_FORMAT_UDMF, TextMap: test.textMap}
+
+			wantThings := []Thing{{X: 32, Y: -64, Type: 1, Flags: THING_FLAG_EASY}}
+			if things := level.ThingsAsDoom(); !slices.Equal(things, wantThings) {
+				t.Errorf("ThingsAsDoom() = %v, want %v", things, wantThings)
+			}
+			wantVertexes := []Vertex{{0, 0}, {64, 0}}
+			if vertexes := level.VertexesAsDoom(); !slices.Equal(vertexes, wantVertexes) {
+				t.Errorf("VertexesAsDoom() = %v, want %v", vertexes, wantVertexes)
+			}
+			if linedefs := level.LinedefsAsDoom(); len(linedefs) != 1 || linedefs[0].End != 1 || linedefs[0].Back != NO_SIDEDEF {
+				t.Errorf("LinedefsAsDoom() = %v, want one linedef from vertex 0 to 1", linedefs)
+			}
+			if sidedefs := level.SidedefsAsDoom(); len(sidedefs) != 1 || sidedefs[0].UpperTex != "-" || sidedefs[0].MiddleTex != "STARTAN2" {
+				t.Errorf("SidedefsAsDoom() = %v, want one sidedef with only a middle texture", sidedefs)
+			}
+			if sectors := level.SectorsAsDoom(); len(sectors) != 1 || sectors[0].FloorFlat != "FLOOR4_8" {
+				t.Errorf("SectorsAsDoom() = %v, want one sector with a FLOOR4_8 floor", sectors)
+			}
+
+			if secretExit := level.HasSecretExit(); secretExit != test.secretExit {
+				t.Errorf("HasSecretExit() = %t, want %t", secretExit, test.secretExit)
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package wad
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Properties binary Doom maps can store, per UDMF block type
+var DOOM_UDMF_PROPERTIES = map[string][]string{
+	UDMF_THING:   {"x", "y", "angle", "type", "skill1", "skill2", "skill3", "skill4", "skill5", "ambush", "single", "dm", "coop", "comment"},
+	UDMF_VERTEX:  {"x", "y", "comment"},
+	UDMF_LINEDEF: {"v1", "v2", "blocking", "blockmonsters", "twosided", "dontpegtop", "dontpegbottom", "secret", "blocksound", "dontdraw", "mapped", "special", "arg0", "sidefront", "sideback", "comment"},
+	UDMF_SIDEDEF: {"offsetx", "offsety", "texturetop", "texturebottom", "texturemiddle", "sector", "comment"},
+	UDMF_SECTOR:  {"heightfloor", "heightceiling", "texturefloor", "textureceiling", "lightlevel", "special", "id", "comment"},
+}
+
+var LINEDEF_UDMF_FLAGS = []struct {
+	Key  string
+	Flag int16
+}{
+	{"blocking", LINEDEF_FLAG_BLOCKING},
+	{"blockmonsters", LINEDEF_FLAG_BLOCK_MONSTERS},
+	{"twosided", LINEDEF_FLAG_TWO_SIDED},
+	{"dontpegtop", LINEDEF_FLAG_UPPER_UNPEGGED},
+	{"dontpegbottom", LINEDEF_FLAG_LOWER_UNPEGGED},
+	{"secret", LINEDEF_FLAG_SECRET},
+	{"blocksound", LINEDEF_FLAG_BLOCK_SOUND},
+	{"dontdraw", LINEDEF_FLAG_NOT_ON_MAP},
+	{"mapped", LINEDEF_FLAG_ALREADY_ON_MAP},
+}
+
+const UDMF_DEFAULT_LIGHT_LEVEL = 160
+
+func (l *Level) ConvertToUDMF() {
+	if l.Format == LEVEL_FORMAT_UDMF {
+		return
+	}
+
+	tm := &TextMap{Namespace: NAMESPACE_DOOM}
+	if l.Format == LEVEL_FORMAT_HEXEN {
+		tm.Namespace = NAMESPACE_HEXEN
+		tm.Blocks = append(tm.Blocks, hexenThingBlocks(l.HexenThings)...)
+	}
+
+	for _, thing := range l.Things {
+		block := UDMFBlock{Type: UDMF_THING}
+		block.Set("x", float64(thing.X))
+		block.Set("y", float64(thing.Y))
+		block.Set("angle", int64(thing.Angle))
+		block.Set("type", int64(thing.Type))
+		setUDMFFlag(&block, "skill1", thing.Flags&THING_FLAG_EASY != 0)
+		setUDMFFlag(&block, "skill2", thing.Flags&THING_FLAG_EASY != 0)
+		setUDMFFlag(&block, "skill3", thing.Flags&THING_FLAG_MEDIUM != 0)
+		setUDMFFlag(&block, "skill4", thing.Flags&THING_FLAG_HARD != 0)
+		setUDMFFlag(&block, "skill5", thing.Flags&THING_FLAG_HARD != 0)
+		setUDMFFlag(&block, "ambush", thing.Flags&THING_FLAG_AMBUSH != 0)
+		setUDMFFlag(&block, "single", thing.Flags&THING_FLAG_MULTIPLAYER == 0)
+		setUDMFFlag(&block, "dm", true)
+		setUDMFFlag(&block, "coop", true)
+		tm.Blocks = append(tm.Blocks, block)
+	}
+
+	for _, vertex := range trimUnusedVertexes(l.Vertexes, l.LinedefsAsDoom()) {
+		block := UDMFBlock{Type: UDMF_VERTEX}
+		block.Set("x", float64(vertex.X))
+		block.Set("y", float64(vertex.Y))
+		tm.Blocks = append(tm.Blocks, block)
+	}
+
+	for _, linedef := range l.Linedefs {
+		block := UDMFBlock{Type: UDMF_LINEDEF}
+		block.Set("v1", int64(linedef.Start))
+		block.Set("v2", int64(linedef.End))
+		block.Set("sidefront", int64(linedef.Front))
+		if linedef.Back != NO_SIDEDEF {
+			block.Set("sideback", int64(linedef.Back))
+		}
+		for _, flag := range LINEDEF_UDMF_FLAGS {
+			setUDMFFlag(&block, flag.Key, linedef.Flags&flag.Flag != 0)
+		}
+		if linedef.SpecialType != 0 {
+			block.Set("special", int64(linedef.SpecialType))
+		}
+		if linedef.Tag != 0 {
+			block.Set("arg0", int64(linedef.Tag))
+		}
+		tm.Blocks = append(tm.Blocks, block)
+	}
+	if l.Format == LEVEL_FORMAT_HEXEN {
+		blocks, needsZDoom := hexenLinedefBlocks(l.HexenLinedefs)
+		if needsZDoom {
+			tm.Namespace = NAMESPACE_ZDOOM
+		}
+		tm.Blocks = append(tm.Blocks, blocks...)
+	}
+
+	for _, sidedef := range l.Sidedefs {
+		block := UDMFBlock{Type: UDMF_SIDEDEF}
+		if sidedef.XOffset != 0 {
+			block.Set("offsetx", int64(sidedef.XOffset))
+		}
+		if sidedef.YOffset != 0 {
+			block.Set("offsety", int64(sidedef.YOffset))
+		}
+		block.Set("texturetop", sidedef.UpperTex)
+		block.Set("texturebottom", sidedef.LowerTex)
+		block.Set("texturemiddle", sidedef.MiddleTex)
+		block.Set("sector", int64(sidedef.FacingSector))
+		tm.Blocks = append(tm.Blocks, block)
+	}
+
+	for _, sector := range l.Sectors {
+		block := UDMFBlock{Type: UDMF_SECTOR}
+		block.Set("heightfloor", int64(sector.FloorHeight))
+		block.Set("heightceiling", int64(sector.CeilingHeight))
+		block.Set("texturefloor", sector.FloorFlat)
+		block.Set("textureceiling", sector.CeilingFlat)
+		block.Set("lightlevel", int64(sector.LightLevel))
+		if sector.SpecialType != 0 {
+			block.Set("special", int64(sector.SpecialType))
+		}
+		if sector.Tag != 0 {
+			block.Set("id", int64(sector.Tag))
+		}
+		tm.Blocks = append(tm.Blocks, block)
+	}
+
+	// UDMF levels keep BEHAVIOR and SCRIPTS between TEXTMAP and ENDMAP
+	extraLumps := []Lump{}
+	if l.Format == LEVEL_FORMAT_HEXEN {
+		extraLumps = append(extraLumps, Lump{Name: LUMP_BEHAVIOR, Data: l.Behavior})
+		if l.Scripts != nil {
+			extraLumps = append(extraLumps, Lump{Name: LUMP_SCRIPTS, Data: l.Scripts})
+		}
+	}
+
+	l.Format = LEVEL_FORMAT_UDMF
+	l.TextMap = tm
+	l.HexenThings = nil
+	l.HexenLinedefs = nil
+	l.Behavior = nil
+	l.Scripts = nil
+	l.Things = []Thing{}
+	l.Linedefs = []Linedef{}
+	l.Sidedefs = []Sidedef{}
+	l.Vertexes = []Vertex{}
+	l.Segments = []Seg{}
+	l.Subsectors = []Subsector{}
+	l.Nodes = []Node{}
+	l.ExtendedNodes = nil
+	l.Sectors = []Sector{}
+	l.Reject = []byte{}
+	l.Blockmap = []byte{}
+	l.ExtraLumps = extraLumps
+	l.missingLumps = nil
+	l.partialRecords = nil
+}
+
+var HEXEN_THING_UDMF_FLAGS = []struct {
+	Key  string
+	Flag int16
+}{
+	{"ambush", THING_FLAG_AMBUSH},
+	{"dormant", HEXEN_THING_FLAG_DORMANT},
+	{"class1", HEXEN_THING_FLAG_FIGHTER},
+	{"class2", HEXEN_THING_FLAG_CLERIC},
+	{"class3", HEXEN_THING_FLAG_MAGE},
+	{"single", HEXEN_THING_FLAG_SINGLE},
+	{"coop", HEXEN_THING_FLAG_COOP},
+	{"dm", HEXEN_THING_FLAG_DEATHMATCH},
+}
+
+// Activation types stored in the Hexen linedef flags, in order of their value
+var HEXEN_UDMF_ACTIVATIONS = []string{"playercross", "playeruse", "monstercross", "impact", "playerpush", "missilecross"}
+
+func hexenThingBlocks(things []HexenThing) []UDMFBlock {
+	blocks := make([]UDMFBlock, 0, len(things))
+	for _, thing := range things {
+		block := UDMFBlock{Type: UDMF_THING}
+		if thing.TID != 0 {
+			block.Set("id", int64(thing.TID))
+		}
+		block.Set("x", float64(thing.X))
+		block.Set("y", float64(thing.Y))
+		if thing.Z != 0 {
+			block.Set("height", float64(thing.Z))
+		}
+		block.Set("angle", int64(thing.Angle))
+		block.Set("type", int64(thing.Type))
+		setUDMFFlag(&block, "skill1", thing.Flags&THING_FLAG_EASY != 0)
+		setUDMFFlag(&block, "skill2", thing.Flags&THING_FLAG_EASY != 0)
+		setUDMFFlag(&block, "skill3", thing.Flags&THING_FLAG_MEDIUM != 0)
+		setUDMFFlag(&block, "skill4", thing.Flags&THING_FLAG_HARD != 0)
+		setUDMFFlag(&block, "skill5", thing.Flags&THING_FLAG_HARD != 0)
+		for _, flag := range HEXEN_THING_UDMF_FLAGS {
+			setUDMFFlag(&block, flag.Key, thing.Flags&flag.Flag != 0)
+		}
+		setUDMFSpecial(&block, thing.Special, thing.Args)
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// Returns the linedef blocks, and whether any of them use flags only the zdoom namespace has
+func hexenLinedefBlocks(linedefs []HexenLinedef) ([]UDMFBlock, bool) {
+	blocks := make([]UDMFBlock, 0, len(linedefs))
+	needsZDoom := false
+	for _, linedef := range linedefs {
+		block := UDMFBlock{Type: UDMF_LINEDEF}
+		block.Set("v1", int64(linedef.Start))
+		block.Set("v2", int64(linedef.End))
+		block.Set("sidefront", int64(linedef.Front))
+		if linedef.Back != NO_SIDEDEF {
+			block.Set("sideback", int64(linedef.Back))
+		}
+		for _, flag := range LINEDEF_UDMF_FLAGS {
+			setUDMFFlag(&block, flag.Key, linedef.Flags&flag.Flag != 0)
+		}
+		setUDMFFlag(&block, "repeatspecial", linedef.Flags&HEXEN_LINEDEF_FLAG_REPEAT_SPECIAL != 0)
+		setUDMFFlag(&block, "monsteractivate", linedef.Flags&HEXEN_LINEDEF_FLAG_MONSTERS_USE != 0)
+		setUDMFFlag(&block, "blockplayers", linedef.Flags&HEXEN_LINEDEF_FLAG_BLOCK_PLAYERS != 0)
+		setUDMFFlag(&block, "blockeverything", linedef.Flags&HEXEN_LINEDEF_FLAG_BLOCK_ALL != 0)
+		needsZDoom = needsZDoom || linedef.Flags&(HEXEN_LINEDEF_FLAG_BLOCK_PLAYERS|HEXEN_LINEDEF_FLAG_BLOCK_ALL) != 0
+
+		if linedef.Special != 0 {
+			activation := int((linedef.Flags & HEXEN_LINEDEF_ACTIVATION_MASK) >> HEXEN_LINEDEF_ACTIVATION_SHIFT)
+			if activation < len(HEXEN_UDMF_ACTIVATIONS) {
+				block.Set(HEXEN_UDMF_ACTIVATIONS[activation], true)
+			}
+		}
+		setUDMFSpecial(&block, linedef.Special, linedef.Args)
+		blocks = append(blocks, block)
+	}
+	return blocks, needsZDoom
+}
+
+func setUDMFSpecial(block *UDMFBlock, special uint8, args [5]uint8) {
+	if special != 0 {
+		block.Set("special", int64(special))
+	}
+	for i, arg := range args {
+		if arg != 0 {
+			block.Set(fmt.Sprintf("arg%d", i), int64(arg))
+		}
+	}
+}
+
+// UDMF defaults every flag to false, so only true flags need writing
+func setUDMFFlag(block *UDMFBlock, key string, value bool) {
+	if value {
+		block.Set(key, true)
+	}
+}
+
+// Only levels in the doom namespace that don't use any UDMF-only features can be
+// converted. Nodes, blockmap and reject are rebuilt since UDMF levels don't have them.
+func (l *Level) ConvertToDoom() error {
+	if l.Format == LEVEL_FORMAT_DOOM {
+		return nil
+	}
+	if l.Format != LEVEL_FORMAT_UDMF || l.TextMap == nil {
+		return fmt.Errorf("%s: only UDMF levels can be converted to Doom format", l.Slot)
+	}
+
+	tm := l.TextMap
+	if tm.Namespace != NAMESPACE_DOOM {
+		return fmt.Errorf("%s: UDMF namespace %s can't be converted to Doom format", l.Slot, tm.Namespace)
+	}
+
+	converted := Level{
+		Slot:      l.Slot,
+		Format:    LEVEL_FORMAT_DOOM,
+		LevelInfo: l.LevelInfo,
+	}
+
+	for _, block := range tm.Blocks {
+		allowed, known := DOOM_UDMF_PROPERTIES[block.Type]
+		if !known {
+			return fmt.Errorf("%s: UDMF %s blocks can't be converted to Doom format", l.Slot, block.Type)
+		}
+		for _, property := range block.Properties {
+			if !slices.Contains(allowed, property.Key) && !strings.HasPrefix(property.Key, "user_") {
+				return fmt.Errorf("%s: UDMF %s property %s can't be converted to Doom format", l.Slot, block.Type, property.Key)
+			}
+		}
+
+		var err error
+		switch block.Type {
+		case UDMF_THING:
+			err = converted.appendUDMFThing(block)
+		case UDMF_VERTEX:
+			err = converted.appendUDMFVertex(block)
+		case UDMF_LINEDEF:
+			converted.appendUDMFLinedef(block)
+		case UDMF_SIDEDEF:
+			err = converted.appendUDMFSidedef(block)
+		case UDMF_SECTOR:
+			err = converted.appendUDMFSector(block)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", l.Slot, err)
+		}
+	}
+
+	err := converted.BuildNodes()
+	if err != nil {
+		return err
+	}
+	err = converted.BuildBlockmap(true)
+	if err != nil {
+		return err
+	}
+	converted.BuildReject(false)
+
+	*l = converted
+	return nil
+}
+
+func (l *Level) appendUDMFThing(block UDMFBlock) error {
+	x, y := block.Float("x", 0), block.Float("y", 0)
+	if x != math.Trunc(x) || y != math.Trunc(y) {
+		return fmt.Errorf("thing at (%g, %g) isn't on whole map units", x, y)
+	}
+
+	l.Things = append(l.Things, udmfThing(block))
+	return nil
+}
+
+func (l *Level) appendUDMFVertex(block UDMFBlock) error {
+	x, y := block.Float("x", 0), block.Float("y", 0)
+	if x != math.Trunc(x) || y != math.Trunc(y) {
+		return fmt.Errorf("vertex at (%g, %g) isn't on whole map units", x, y)
+	}
+
+	l.Vertexes = append(l.Vertexes, udmfVertex(block))
+	return nil
+}
+
+func (l *Level) appendUDMFLinedef(block UDMFBlock) {
+	l.Linedefs = append(l.Linedefs, udmfLinedef(block))
+}
+
+func (l *Level) appendUDMFSidedef(block UDMFBlock) error {
+	sidedef := udmfSidedef(block)
+	for _, texture := range []string{sidedef.UpperTex, sidedef.LowerTex, sidedef.MiddleTex} {
+		if len(texture) > 8 {
+			return fmt.Errorf("texture name %s is longer than 8 characters", texture)
+		}
+	}
+
+	l.Sidedefs = append(l.Sidedefs, sidedef)
+	return nil
+}
+
+func (l *Level) appendUDMFSector(block UDMFBlock) error {
+	sector := udmfSector(block)
+	for _, flat := range []string{sector.FloorFlat, sector.CeilingFlat} {
+		if len(flat) > 8 {
+			return fmt.Errorf("flat name %s is longer than 8 characters", flat)
+		}
+	}
+
+	l.Sectors = append(l.Sectors, sector)
+	return nil
+}
+
+// The udmf* functions read a block as the closest Doom-format element, rounding coordinates to
+// whole map units and ignoring properties Doom format can't store
+
+func udmfThing(block UDMFBlock) Thing {
+	flags := int16(0)
+	if block.Bool("skill1") || block.Bool("skill2") {
+		flags |= THING_FLAG_EASY
+	}
+	if block.Bool("skill3") {
+		flags |= THING_FLAG_MEDIUM
+	}
+	if block.Bool("skill4") || block.Bool("skill5") {
+		flags |= THING_FLAG_HARD
+	}
+	if block.Bool("ambush") {
+		flags |= THING_FLAG_AMBUSH
+	}
+	if !block.Bool("single") {
+		flags |= THING_FLAG_MULTIPLAYER
+	}
+
+	return Thing{
+		X:     int16(math.Round(block.Float("x", 0))),
+		Y:     int16(math.Round(block.Float("y", 0))),
+		Angle: int16(block.Int("angle", 0)),
+		Type:  int16(block.Int("type", 0)),
+		Flags: flags,
+	}
+}
+
+func udmfVertex(block UDMFBlock) Vertex {
+	return Vertex{
+		X: int16(math.Round(block.Float("x", 0))),
+		Y: int16(math.Round(block.Float("y", 0))),
+	}
+}
+
+func udmfLinedef(block UDMFBlock) Linedef {
+	flags := int16(0)
+	for _, flag := range LINEDEF_UDMF_FLAGS {
+		if block.Bool(flag.Key) {
+			flags |= flag.Flag
+		}
+	}
+
+	return Linedef{
+		Start:       int16(block.Int("v1", 0)),
+		End:         int16(block.Int("v2", 0)),
+		Flags:       flags,
+		SpecialType: int16(block.Int("special", 0)),
+		Tag:         int16(block.Int("arg0", 0)),
+		Front:       int16(block.Int("sidefront", -1)),
+		Back:        int16(block.Int("sideback", -1)),
+	}
+}
+
+func udmfSidedef(block UDMFBlock) Sidedef {
+	return Sidedef{
+		XOffset:      int16(block.Int("offsetx", 0)),
+		YOffset:      int16(block.Int("offsety", 0)),
+		UpperTex:     block.String("texturetop", "-"),
+		LowerTex:     block.String("texturebottom", "-"),
+		MiddleTex:    block.String("texturemiddle", "-"),
+		FacingSector: int16(block.Int("sector", 0)),
+	}
+}
+
+func udmfSector(block UDMFBlock) Sector {
+	return Sector{
+		FloorHeight:   int16(block.Int("heightfloor", 0)),
+		CeilingHeight: int16(block.Int("heightceiling", 0)),
+		FloorFlat:     block.String("texturefloor", "-"),
+		CeilingFlat:   block.String("textureceiling", "-"),
+		LightLevel:    int16(block.Int("lightlevel", UDMF_DEFAULT_LIGHT_LEVEL)),
+		SpecialType:   int16(block.Int("special", 0)),
+		Tag:           int16(block.Int("id", 0)),
+	}
+}
+
+// Reads every block of a type with one of the udmf* functions. A level without a TEXTMAP has
+// no blocks.
+func udmfElements[T any](tm *TextMap, blockType string, read func(UDMFBlock) T) []T {
+	if tm == nil {
+		return []T{}
+	}
+
+	blocks := tm.BlocksOfType(blockType)
+	elements := make([]T, len(blocks))
+	for i, block := range blocks {
+		elements[i] = read(block)
+	}
+	return elements
+}
+
+// Namespaces whose linedef specials are numbered like Hexen's rather than Doom's
+func (tm TextMap) hasHexenSpecials() bool {
+	return tm.Namespace == NAMESPACE_HEXEN || tm.Namespace == NAMESPACE_ZDOOM
+}
@@ -0,0 +1,242 @@
+package wad
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const LUMP_UMAPINFO = "UMAPINFO"
+
+// Value that resets a UMAPINFO key to nothing instead of the game's default
+const UMAPINFO_CLEAR = "clear"
+
+// Parses a UMAPINFO lump into level infos by level slot. Each level info starts from the
+// defaults for its slot, so keys the lump doesn't set keep their usual values.
+func ParseUMapInfo(data []byte) (map[string]LevelInfo, error) {
+	tokens, err := tokenizeScript(LUMP_UMAPINFO, string(data), "{}=,")
+	if err != nil {
+		return nil, err
+	}
+
+	levelInfos := map[string]LevelInfo{}
+	for i := 0; i < len(tokens); {
+		if tokens[i].Quoted || !strings.EqualFold(tokens[i].Text, "map") {
+			return nil, scriptError(LUMP_UMAPINFO, tokens[i], "expected map")
+		}
+		if i+2 >= len(tokens) || tokens[i+2].Text != "{" {
+			return nil, scriptError(LUMP_UMAPINFO, tokens[i], "expected map name and '{'")
+		}
+
+		levelSlot := strings.ToUpper(tokens[i+1].Text)
+		levelInfo, exists := levelInfos[levelSlot]
+		if !exists {
+			levelInfo = defaultLevelInfo(levelSlot)
+		}
+
+		i += 3
+		bossActionsSet := false
+		for i < len(tokens) && !(tokens[i].Text == "}" && !tokens[i].Quoted) {
+			if i+2 >= len(tokens) || tokens[i+1].Text != "=" {
+				return nil, scriptError(LUMP_UMAPINFO, tokens[i], "expected assignment")
+			}
+
+			key := strings.ToLower(tokens[i].Text)
+			values := []scriptToken{tokens[i+2]}
+			i += 3
+			for i+1 < len(tokens) && tokens[i].Text == "," && !tokens[i].Quoted {
+				values = append(values, tokens[i+1])
+				i += 2
+			}
+
+			// The first bossaction for a level replaces the default ones rather than adding to them
+			if key == "bossaction" && !bossActionsSet {
+				levelInfo.BossActions = nil
+				bossActionsSet = true
+			}
+
+			err = levelInfo.setUMapInfoKey(key, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if i >= len(tokens) {
+			return nil, fmt.Errorf("UMAPINFO: unterminated entry for %s", levelSlot)
+		}
+		i++
+
+		levelInfos[levelSlot] = levelInfo
+	}
+
+	return levelInfos, nil
+}
+
+func (li *LevelInfo) setUMapInfoKey(key string, values []scriptToken) error {
+	var err error
+	switch key {
+	case "levelname":
+		li.Name, err = umapInfoString(values)
+	case "label":
+		li.Label, err = umapInfoClearableString(values)
+	case "author":
+		li.Author, err = umapInfoString(values)
+	case "levelpic":
+		li.LevelPic, err = umapInfoString(values)
+	case "next":
+		li.Next, err = umapInfoString(values)
+	case "nextsecret":
+		li.NextSecret, err = umapInfoString(values)
+	case "skytexture":
+		li.SkyTexture, err = umapInfoString(values)
+	case "music":
+		li.Music, err = umapInfoString(values)
+	case "exitpic":
+		li.ExitPic, err = umapInfoString(values)
+	case "enterpic":
+		li.EnterPic, err = umapInfoString(values)
+	case "exitanim":
+		li.ExitAnim, err = umapInfoString(values)
+	case "enteranim":
+		li.EnterAnim, err = umapInfoString(values)
+	case "partime":
+		li.ParTime, err = umapInfoInt(values)
+	case "endgame":
+		li.EndGame, err = umapInfoBool(values)
+		if !li.EndGame {
+			li.EndPic, li.EndBunny, li.EndCast = "", false, false
+		}
+	// A level has one ending, so setting one replaces any other, including the default
+	case "endpic":
+		li.EndPic, err = umapInfoString(values)
+		li.EndGame, li.EndBunny, li.EndCast = true, false, false
+	case "endbunny":
+		li.EndBunny, err = umapInfoBool(values)
+		if li.EndBunny {
+			li.EndGame, li.EndPic, li.EndCast = true, "", false
+		}
+	case "endcast":
+		li.EndCast, err = umapInfoBool(values)
+		if li.EndCast {
+			li.EndGame, li.EndPic, li.EndBunny = true, "", false
+		}
+	case "nointermission":
+		li.NoIntermission, err = umapInfoBool(values)
+	case "intertext":
+		li.InterText, err = umapInfoText(values)
+	case "intertextsecret":
+		li.InterTextSecret, err = umapInfoText(values)
+	case "interbackdrop":
+		li.InterBackdrop, err = umapInfoString(values)
+	case "intermusic":
+		li.InterMusic, err = umapInfoString(values)
+	case "episode":
+		li.Episode, err = umapInfoEpisode(values)
+	case "bossaction":
+		err = li.addUMapInfoBossAction(values)
+	}
+	// Other keys are extensions for specific source ports, which wado doesn't use
+
+	return err
+}
+
+func (li *LevelInfo) addUMapInfoBossAction(values []scriptToken) error {
+	if len(values) == 1 && isUMapInfoClear(values[0]) {
+		li.BossActions = nil
+		return nil
+	}
+	if len(values) != 3 || values[0].Quoted {
+		return scriptError(LUMP_UMAPINFO, values[0], "expected bossaction = thing, special, tag")
+	}
+
+	special, err := strconv.ParseInt(values[1].Text, 10, 16)
+	if err != nil {
+		return scriptError(LUMP_UMAPINFO, values[1], "invalid line special")
+	}
+	tag, err := strconv.ParseInt(values[2].Text, 10, 16)
+	if err != nil {
+		return scriptError(LUMP_UMAPINFO, values[2], "invalid sector tag")
+	}
+
+	li.BossActions = append(li.BossActions, BossAction{Boss: Boss(values[0].Text), SpecialType: int16(special), Tag: int16(tag)})
+	return nil
+}
+
+func isUMapInfoClear(token scriptToken) bool {
+	return !token.Quoted && strings.EqualFold(token.Text, UMAPINFO_CLEAR)
+}
+
+func umapInfoString(values []scriptToken) (string, error) {
+	if len(values) != 1 || !values[0].Quoted {
+		return "", scriptError(LUMP_UMAPINFO, values[0], "expected a string")
+	}
+	return values[0].Text, nil
+}
+
+// Cleared strings are empty, which is also how they're written back out
+func umapInfoClearableString(values []scriptToken) (string, error) {
+	if len(values) == 1 && isUMapInfoClear(values[0]) {
+		return "", nil
+	}
+	return umapInfoString(values)
+}
+
+func umapInfoInt(values []scriptToken) (int, error) {
+	if len(values) != 1 || values[0].Quoted {
+		return 0, scriptError(LUMP_UMAPINFO, values[0], "expected a number")
+	}
+	value, err := strconv.Atoi(values[0].Text)
+	if err != nil {
+		return 0, scriptError(LUMP_UMAPINFO, values[0], "expected a number")
+	}
+	return value, nil
+}
+
+func umapInfoBool(values []scriptToken) (bool, error) {
+	if len(values) == 1 && !values[0].Quoted {
+		switch strings.ToLower(values[0].Text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, scriptError(LUMP_UMAPINFO, values[0], "expected true or false")
+}
+
+func umapInfoText(values []scriptToken) ([]string, error) {
+	if len(values) == 1 && isUMapInfoClear(values[0]) {
+		return nil, nil
+	}
+
+	lines := make([]string, 0, len(values))
+	for _, value := range values {
+		if !value.Quoted {
+			return nil, scriptError(LUMP_UMAPINFO, value, "expected a string")
+		}
+		lines = append(lines, value.Text)
+	}
+	return lines, nil
+}
+
+func umapInfoEpisode(values []scriptToken) (*Episode, error) {
+	if len(values) == 1 && isUMapInfoClear(values[0]) {
+		return nil, nil
+	}
+	if len(values) != 3 || !values[0].Quoted || !values[1].Quoted || !values[2].Quoted {
+		return nil, scriptError(LUMP_UMAPINFO, values[0], "expected episode = patch, name, key")
+	}
+	return &Episode{Patch: values[0].Text, Name: values[1].Text, Key: values[2].Text}, nil
+}
+
+// UMAPINFO strings use C-style escapes for quotes and backslashes
+func umapInfoQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func umapInfoQuoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = umapInfoQuote(value)
+	}
+	return strings.Join(quoted, ",\n        ")
+}
@@ -0,0 +1,128 @@
+package wad
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUMapInfoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]LevelInfo
+	}{
+		{
+			name: "defaults kept",
+			data: `MAP E1M8 { }`,
+			want: map[string]LevelInfo{"E1M8": DEFAULT_LEVELINFOS["E1M8"]},
+		},
+		{
+			name: "every ending",
+			data: `map E2M8 { levelname = "Tower" }
+				MAP E3M8 { endpic = "CREDIT" }
+				MAP E4M8 { endcast = true }
+				MAP MAP30 { endgame = false }`,
+			want: map[string]LevelInfo{
+				"E2M8": withLevelInfo("E2M8", func(li *LevelInfo) { li.Name = "Tower" }),
+				"E3M8": withLevelInfo("E3M8", func(li *LevelInfo) { li.EndPic, li.EndBunny = "CREDIT", false }),
+				"E4M8": withLevelInfo("E4M8", func(li *LevelInfo) { li.EndPic, li.EndCast = "", true }),
+				"MAP30": withLevelInfo("MAP30", func(li *LevelInfo) {
+					li.EndGame, li.EndCast = false, false
+				}),
+			},
+		},
+		{
+			name: "custom level",
+			data: `MAP MAP40
+				{
+					levelname = "The \"Quoted\" Level"
+					label = clear
+					author = "Someone"
+					next = "MAP41"
+					nextsecret = "MAP42"
+					skytexture = "SKY3"
+					music = "D_RUNNIN"
+					partime = 120
+					intertext = "First line", "", "Third line"
+					interbackdrop = "FLOOR4_8"
+					episode = "M_EPI1", "Knee-Deep", "k"
+					bossaction = Fatso, 23, 666
+					bossaction = Arachnotron, 30, 667
+				}`,
+			want: map[string]LevelInfo{
+				"MAP40": {
+					Name:          `The "Quoted" Level`,
+					Author:        "Someone",
+					Next:          "MAP41",
+					NextSecret:    "MAP42",
+					SkyTexture:    "SKY3",
+					Music:         "D_RUNNIN",
+					ParTime:       120,
+					InterText:     []string{"First line", "", "Third line"},
+					InterBackdrop: "FLOOR4_8",
+					Episode:       &Episode{Patch: "M_EPI1", Name: "Knee-Deep", Key: "k"},
+					BossActions: []BossAction{
+						{Boss: BOSS_MANCUBUS, SpecialType: 23, Tag: 666},
+						{Boss: BOSS_ARACHNOTRON, SpecialType: 30, Tag: 667},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			levelInfos, err := ParseUMapInfo([]byte(test.data))
+			if err != nil {
+				t.Fatalf("ParseUMapInfo() error = %v", err)
+			}
+			if !reflect.DeepEqual(levelInfos, test.want) {
+				t.Errorf("ParseUMapInfo() = %+v, want %+v", levelInfos, test.want)
+			}
+
+			levels := []Level{}
+			for slot, levelInfo := range levelInfos {
+				levels = append(levels, Level{Slot: slot, LevelInfo: levelInfo})
+			}
+			lump := makeUMapInfoLump(levels)
+			reparsed, err := ParseUMapInfo(lump.Data)
+			if err != nil {
+				t.Fatalf("ParseUMapInfo(makeUMapInfoLump()) error = %v\n%s", err, lump.Data)
+			}
+			if !reflect.DeepEqual(reparsed, levelInfos) {
+				t.Errorf("ParseUMapInfo(makeUMapInfoLump()) = %+v, want %+v", reparsed, levelInfos)
+			}
+		})
+	}
+}
+
+func TestParseUMapInfoErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "not a map", data: `level E1M1 { }`},
+		{name: "missing brace", data: `MAP E1M1 levelname = "Hangar" }`},
+		{name: "unterminated entry", data: `MAP E1M1 { levelname = "Hangar"`},
+		{name: "unterminated string", data: `MAP E1M1 { levelname = "Hangar }`},
+		{name: "number for string", data: `MAP E1M1 { levelname = 1 }`},
+		{name: "string for number", data: `MAP E1M1 { partime = "30" }`},
+		{name: "short bossaction", data: `MAP E1M1 { bossaction = Fatso, 23 }`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseUMapInfo([]byte(test.data))
+			if err == nil {
+				t.Errorf("ParseUMapInfo() error = nil, want an error")
+			}
+		})
+	}
+}
+
+// The default level info for a slot with some changes
+func withLevelInfo(slot string, change func(li *LevelInfo)) LevelInfo {
+	levelInfo := DEFAULT_LEVELINFOS[slot]
+	change(&levelInfo)
+	return levelInfo
+}
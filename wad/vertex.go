@@ -0,0 +1,54 @@
+package wad
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const SIZE_VERTEX int = 4
+
+type Vertexes []Vertex
+type Vertex struct {
+	X int16
+	Y int16
+}
+
+func (v *Vertex) fromBytes(data []byte) {
+	v.X = int16(binary.LittleEndian.Uint16(data[0:2]))
+	v.Y = int16(binary.LittleEndian.Uint16(data[2:4]))
+}
+
+func (v Vertex) toBytes() []byte {
+	vbytes := [SIZE_VERTEX]byte{}
+	binary.LittleEndian.PutUint16(vbytes[0:2], uint16(v.X))
+	binary.LittleEndian.PutUint16(vbytes[2:4], uint16(v.Y))
+
+	return vbytes[:]
+}
+
+func parseVertexes(data []byte) []Vertex {
+	numVertexes := len(data) / SIZE_VERTEX
+	vertexes := make([]Vertex, numVertexes)
+
+	buf := bytes.NewBuffer(data)
+	for i, v := range vertexes {
+		vbytes := buf.Next(SIZE_VERTEX)
+		v.fromBytes(vbytes)
+		vertexes[i] = v
+	}
+
+	return vertexes
+}
+
+func (vertexes Vertexes) toLump() Lump {
+	buf := make([]byte, 0, len(vertexes)*SIZE_VERTEX)
+	for _, v := range vertexes {
+		vbytes := v.toBytes()
+		buf = append(buf, vbytes...)
+	}
+
+	return Lump{
+		Name: LUMP_VERTEXES,
+		Data: buf,
+	}
+}
@@ -17,6 +17,8 @@
 	LUMP_SECTORS    = "SECTORS"
 	LUMP_REJECT     = "REJECT"
 	LUMP_BLOCKMAP   = "BLOCKMAP"
+	LUMP_BEHAVIOR   = "BEHAVIOR"
+	LUMP_SCRIPTS    = "SCRIPTS"
 )
 
 const (
@@ -31,6 +33,26 @@
 	THING_HEALTH     int16 = 2014
 	THING_MEGASPHERE int16 = 83
 	THING_BERSERK    int16 = 2023
+
+	THING_CHAINSAW     int16 = 2005
+	THING_CHAINGUN     int16 = 2002
+	THING_LAUNCHER     int16 = 2003
+	THING_PLASMA       int16 = 2004
+	THING_BFG          int16 = 2006
+	THING_CLIP         int16 = 2007
+	THING_BULLETS      int16 = 2048
+	THING_SHELLS       int16 = 2008
+	THING_SHELLBOX     int16 = 2049
+	THING_ROCKET       int16 = 2010
+	THING_ROCKETBOX    int16 = 2046
+	THING_CELL         int16 = 2047
+	THING_CELLPACK     int16 = 17
+	THING_BACKPACK     int16 = 8
+	THING_SOULSPHERE   int16 = 2013
+	THING_ARMOR        int16 = 2015
+	THING_GREENARMOR   int16 = 2018
+	THING_BLUEARMOR    int16 = 2019
+	THING_PLAYER1START int16 = 1
 )
 
 const (
@@ -48,6 +70,13 @@
 	ENEMY_ARACH       int16 = 68
 	ENEMY_KNIGHT      int16 = 69
 	ENEMY_PAIN        int16 = 71
+
+	ENEMY_SPECTRE    int16 = 58
+	ENEMY_MANCUBUS   int16 = 67
+	ENEMY_CYBERDEMON int16 = 16
+	ENEMY_SPIDER     int16 = 7
+	ENEMY_SS         int16 = 84
+	ENEMY_KEEN       int16 = 72
 )
 
 func ReplaceThingsWeighted(candidates []*Thing, weights map[int16]float64, rng *rand.Rand) {
@@ -1,12 +1,18 @@
 package wad
 
 import (
+	"crypto/sha256"
 	_ "embed"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"maps"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"text/template"
 )
@@ -16,11 +22,100 @@ type WadFile struct {
 	Identifier string
 	Lumps      []Lump
 	Levels     []Level
+
+	// Lump directory of the file as it was read, including map and metadata lumps. Empty for
+	// new files and not updated by saving.
+	Directory []DirectoryEntry
+
+	// Metadata lumps generated from the levels' LevelInfo when saving
+	MapInfoFormats []MapInfoFormat
+
+	// Keep the previous contents of the file as <file>.bak when saving over it
+	Backup bool
+
+	// Write lumps and levels where they were in the file they were read from, with generated
+	// metadata lumps in place of the ones they replace. New lumps and levels go at the end.
+	PreserveOrder bool
+
+	// Store identical lump data once, with every lump that has it pointing at the same offset
+	Deduplicate bool
+
+	// Start each lump's data at a multiple of this many bytes. 0 and 1 leave lumps unaligned.
+	Alignment int
+
+	// Sizes from the last time the WAD was written
+	Stats WriteStats
+
+	// Problems found when the file was read that didn't stop it from being opened
+	Warnings []error
+
+	// Positions of lumps that were read into the levels, so what's generated from them can go back there
+	removedLumpOrder map[string]int
+
+	// Open while lumps and levels can still be loaded from the file
+	file *os.File
+
+	// What the WAD was read from, for reading lumps as they are in the file
+	source io.ReaderAt
 }
 
 type Lump struct {
 	Name string
 	Data []byte
+
+	// Where Data is read from when the file was opened lazily and the lump isn't loaded yet
+	source io.ReaderAt
+	offset int32
+	length int32
+
+	// Position in the file the lump was read from, plus one. Zero for new lumps.
+	order int
+}
+
+type DirectoryEntry struct {
+	Name   string
+	Offset int
+	Size   int
+}
+
+var (
+	ErrIndexOnly  = errors.New("file was opened index-only, so lump data can't be loaded")
+	ErrNoFilePath = errors.New("WAD wasn't opened from a file, so it can only be written with WriteTo")
+	ErrNoSource   = errors.New("WAD wasn't read from a file or reader, so it has no lumps as they are in the file")
+)
+
+// Reader for files opened index-only, which have no data to load
+type indexOnlyReader struct{}
+
+func (indexOnlyReader) ReadAt(p []byte, off int64) (int, error) {
+	return 0, ErrIndexOnly
+}
+
+func (l Lump) IsLoaded() bool {
+	return l.source == nil
+}
+
+// Size of the lump's data, whether or not it's loaded
+func (l Lump) Size() int {
+	if l.IsLoaded() {
+		return len(l.Data)
+	}
+	return int(l.length)
+}
+
+func (l *Lump) Load() error {
+	if l.IsLoaded() {
+		return nil
+	}
+
+	data, err := parseLumpData(l.source, l.offset, l.length)
+	if err != nil {
+		return fmt.Errorf("%s: %w", l.Name, err)
+	}
+
+	l.Data = data
+	l.source = nil
+	return nil
 }
 
 type Game int
@@ -46,147 +141,498 @@ func isLevelFromGame(name string, game Game) bool {
 	return false
 }
 
+// Starts an empty PWAD that will be written to the given path. Nothing is written until it's
+// saved, so a failed save doesn't leave an empty file behind.
+func NewFile(filepath string) *WadFile {
+	return &WadFile{
+		filepath:       filepath,
+		Identifier:     "PWAD",
+		Lumps:          []Lump{},
+		Levels:         []Level{},
+		Directory:      []DirectoryEntry{},
+		MapInfoFormats: DEFAULT_MAPINFO_FORMATS,
+	}
+}
+
+// Starts an empty PWAD that will be written to the given path.
+//
+// Deprecated: Use NewFile. CreateFile no longer creates the file, which is only written when the
+// WAD is saved, and never returns an error.
 func CreateFile(filepath string) (*WadFile, error) {
-	f, err := os.OpenFile(filepath, os.O_CREATE, 0666)
+	return NewFile(filepath), nil
+}
+
+// Reads a WAD of the given size and all of its lumps and levels, such as an upload held in memory.
+// The result has no file path, so it's written with WriteTo rather than Save.
+func Read(r io.ReaderAt, size int64) (*WadFile, error) {
+	wf, err := openWad(io.NewSectionReader(r, 0, size), false)
 	if err != nil {
 		return nil, err
 	}
-	err = f.Close()
+
+	err = wf.Load()
 	if err != nil {
 		return nil, err
 	}
-
-	return &WadFile{
-		filepath:   filepath,
-		Identifier: "PWAD",
-		Lumps:      []Lump{},
-		Levels:     []Level{},
-	}, nil
+	return wf, nil
 }
 
+// Opens a WAD and reads all of its lumps and levels into memory
 func OpenFile(filepath string) (*WadFile, error) {
-	f, err := os.OpenFile(filepath, os.O_RDWR, 0)
+	wf, err := OpenFileLazy(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer wf.Close()
+
+	err = wf.Load()
+	if err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+// Opens a WAD without reading lump data or parsing levels until they're loaded. UMAPINFO is
+// still read so the levels have their LevelInfo. The file stays open until Close is called.
+func OpenFileLazy(filepath string) (*WadFile, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	wf, err := openWad(f, false)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	wf.filepath = filepath
+	wf.file = f
+	return wf, nil
+}
+
+// Opens a WAD and reads only its directory, which is enough to list its lumps and levels.
+// Maps are only found by their lumps, since MAPINFO isn't read, and nothing can be loaded.
+func OpenFileIndex(filepath string) (*WadFile, error) {
+	f, err := os.Open(filepath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	header, err := parseHeader(f)
+	wf, err := openWad(f, true)
 	if err != nil {
 		return nil, err
 	}
 
-	directory, err := parseDirectory(f, header.DirectoryOffset, header.LumpCount)
+	wf.filepath = filepath
+	return wf, nil
+}
+
+func openWad(r io.ReaderAt, indexOnly bool) (*WadFile, error) {
+	header, err := parseHeader(r)
 	if err != nil {
 		return nil, err
 	}
 
+	directory, err := parseDirectory(r, header.DirectoryOffset, header.LumpCount)
+	if err != nil {
+		return nil, err
+	}
+
+	mapNames := map[string]bool{}
+	if !indexOnly {
+		mapNames, err = declaredMapNames(r, directory)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	source := r
+	if indexOnly {
+		source = indexOnlyReader{}
+	}
+
 	levels := make([]Level, 0, 9)
 	lumps := make([]Lump, 0, header.LumpCount)
+	levelInfos := map[string]LevelInfo{}
+	removedLumpOrder := map[string]int{}
+	warnings := []error{}
+	mapInfoFormats := DEFAULT_MAPINFO_FORMATS
 	for i := 0; i < len(directory); i++ {
 		dir := directory[i]
-		lumpData, err := parseLumpData(f, dir.DataOffset, dir.DataLength)
-		if err != nil {
-			return nil, err
+		lumpName := nameToStr(dir.LumpName[:])
+
+		mapLumps := findMapLumps(directory, i, mapNames)
+		if mapLumps.Warning != nil {
+			warnings = append(warnings, mapLumps.Warning)
 		}
 
-		lump := Lump{
-			Name: nameToStr(dir.LumpName[:]),
-			Data: lumpData,
+		if len(mapLumps.Entries) > 0 {
+			levels = append(levels, newLazyLevel(source, lumpName, mapLumps, i+1))
+			i += mapLumps.Consumed
+			continue
 		}
 
-		if isLevelFromGame(lump.Name, GAME_DOOM) || isLevelFromGame(lump.Name, GAME_DOOM2) {
-			level, err := parseLevel(f, lump.Name, directory[i+1:i+11])
+		// UMAPINFO is read into the levels' LevelInfo and written again from there on save.
+		// Entries for levels that aren't in this file are dropped. One that can't be parsed is
+		// kept as it is, and isn't generated again unless asked for.
+		if lumpName == LUMP_UMAPINFO && !indexOnly {
+			lumpData, err := parseLumpData(r, dir.DataOffset, dir.DataLength)
 			if err != nil {
 				return nil, err
 			}
-			levels = append(levels, level)
-			i += 10
-		} else {
-			lumps = append(lumps, lump)
+
+			parsed, err := ParseUMapInfo(lumpData)
+			if err == nil {
+				levelInfos = parsed
+				removedLumpOrder[lumpName] = i + 1
+				continue
+			}
+
+			warnings = append(warnings, fmt.Errorf("%w, so the default level info is used and the lump is kept as it is", err))
+			mapInfoFormats = slices.DeleteFunc(slices.Clone(mapInfoFormats), func(format MapInfoFormat) bool {
+				return format == MAPINFO_FORMAT_UMAPINFO
+			})
+		}
+
+		lumps = append(lumps, Lump{
+			Name:   lumpName,
+			source: source,
+			offset: dir.DataOffset,
+			length: dir.DataLength,
+			order:  i + 1,
+		})
+	}
+
+	for i, level := range levels {
+		if levelInfo, exists := levelInfos[level.Slot]; exists {
+			levels[i].LevelInfo = levelInfo
 		}
 	}
 
+	entries := make([]DirectoryEntry, len(directory))
+	for i, dir := range directory {
+		entries[i] = DirectoryEntry{Name: nameToStr(dir.LumpName[:]), Offset: int(dir.DataOffset), Size: int(dir.DataLength)}
+	}
+
 	return &WadFile{
-		filepath:   filepath,
-		Identifier: string(header.Identifier[:]),
-		Lumps:      lumps,
-		Levels:     levels,
+		Identifier:       string(header.Identifier[:]),
+		Directory:        entries,
+		Lumps:            lumps,
+		Levels:           levels,
+		MapInfoFormats:   mapInfoFormats,
+		Warnings:         warnings,
+		removedLumpOrder: removedLumpOrder,
+		source:           source,
 	}, nil
 }
 
-func (wf WadFile) Save() error {
-	f, err := os.OpenFile(wf.filepath, os.O_RDWR, 0)
+// Reads every lump and level that hasn't been loaded yet
+func (wf *WadFile) Load() error {
+	for i := range wf.Lumps {
+		err := wf.Lumps[i].Load()
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range wf.Levels {
+		err := wf.Levels[i].Load()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Closes a file opened lazily. Lumps and levels that weren't loaded can't be loaded afterwards.
+func (wf *WadFile) Close() error {
+	if wf.file == nil {
+		return nil
+	}
+
+	err := wf.file.Close()
+	wf.file = nil
+	return err
+}
+
+func findLump(directory []fileDirectoryEntry, name string, start int) int {
+	for i := start; i < len(directory); i++ {
+		if nameToStr(directory[i].LumpName[:]) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Writes the WAD to a temporary file next to it and renames that over the original, so the
+// original is left untouched if anything goes wrong
+func (wf *WadFile) Save() error {
+	if wf.filepath == "" {
+		return ErrNoFilePath
+	}
+
+	// Everything has to be read before the file is replaced, since it may be the one being read
+	err := wf.Load()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	_, err = f.Seek(0, io.SeekStart)
-	if err != nil {
+	// Keep the permissions of the file being replaced
+	mode := fs.FileMode(0644)
+	info, err := os.Stat(wf.filepath)
+	exists := err == nil
+	if exists {
+		mode = info.Mode().Perm()
+	} else if !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
 
-	err = f.Truncate(0)
+	dir := filepath.Dir(wf.filepath)
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(wf.filepath)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
 
-	lumps := make([]Lump, 0, len(wf.Lumps)+len(wf.Levels)*11)
-	levelInfos := make([]LevelInfo, 0, len(wf.Levels))
+	_, err = wf.WriteTo(temp)
+	if err != nil {
+		return err
+	}
 
-	for _, level := range wf.Levels {
-		levelLumps := level.toLumps()
-		lumps = append(lumps, levelLumps...)
-		levelInfos = append(levelInfos, level.LevelInfo)
+	err = temp.Chmod(mode)
+	if err != nil {
+		return err
 	}
 
-	lumps = append(lumps, wf.Lumps...)
-	lumps = append(lumps, makeUMapInfoLump(levelInfos))
+	err = temp.Sync()
+	if err != nil {
+		return err
+	}
 
-	header := makeHeader(wf.Identifier, lumps)
-	err = binary.Write(f, binary.LittleEndian, header)
+	err = temp.Close()
 	if err != nil {
 		return err
 	}
 
-	for _, lump := range lumps {
-		err = binary.Write(f, binary.LittleEndian, lump.Data)
+	if wf.Backup && exists {
+		err = backupFile(wf.filepath)
 		if err != nil {
 			return err
 		}
 	}
 
-	directory := makeDirectory(lumps)
-	err = binary.Write(f, binary.LittleEndian, directory)
+	err = os.Rename(temp.Name(), wf.filepath)
 	if err != nil {
 		return err
 	}
 
-	return f.Sync()
+	syncDir(dir)
+	return nil
 }
 
-func makeHeader(identifier string, lumps []Lump) fileHeader {
+// Saves the WAD to a different file, which is what later saves write to as well
+func (wf *WadFile) SaveAs(filepath string) error {
+	wf.filepath = filepath
+	return wf.Save()
+}
 
-	directoryOffset := SIZE_HEADER
-	for _, lump := range lumps {
-		directoryOffset += len(lump.Data)
+// Writes the WAD with its levels and generated metadata lumps, loading anything that hasn't been
+func (wf *WadFile) WriteTo(w io.Writer) (int64, error) {
+	err := wf.Load()
+	if err != nil {
+		return 0, err
 	}
 
-	ident := [4]byte{}
-	copy(ident[:], []byte(identifier))
+	lumps, err := wf.makeLumps()
+	if err != nil {
+		return 0, err
+	}
 
-	return fileHeader{
-		Identifier:      ident,
-		LumpCount:       int32(len(lumps)),
-		DirectoryOffset: int32(directoryOffset),
+	cw := &countingWriter{w: w}
+
+	layout := makeLayout(wf.Identifier, lumps, wf.Deduplicate, wf.Alignment)
+	err = binary.Write(cw, binary.LittleEndian, layout.Header)
+	if err != nil {
+		return cw.written, err
 	}
+
+	for _, data := range layout.Data {
+		err = binary.Write(cw, binary.LittleEndian, data)
+		if err != nil {
+			return cw.written, err
+		}
+	}
+
+	err = binary.Write(cw, binary.LittleEndian, layout.Directory)
+	if err != nil {
+		return cw.written, err
+	}
+
+	wf.Stats = layout.Stats
+	return cw.written, nil
 }
 
-func makeDirectory(lumps []Lump) []fileDirectoryEntry {
-	directory := make([]fileDirectoryEntry, 0, len(lumps))
+// Lumps that are written together, either a level's marker and map lumps or a single other lump
+type LumpGroup struct {
+	// Slot of the level the lumps belong to, empty for other lumps
+	Level string
+	Lumps []Lump
+
+	// Where the group goes when preserving order
+	order int
+}
+
+// Lumps as Save writes them, loading anything that hasn't been
+func (wf *WadFile) LumpGroups() ([]LumpGroup, error) {
+	err := wf.Load()
+	if err != nil {
+		return nil, err
+	}
+	return wf.makeLumpGroups()
+}
+
+// Lumps as they are in the file the WAD was read from, grouped like LumpGroups and in file
+// order. Nothing is parsed and written again, so writing the lumps out gives back the file as it
+// was read whatever has changed since. The file has to still be open.
+func (wf *WadFile) FileLumpGroups() ([]LumpGroup, error) {
+	if wf.source == nil {
+		return nil, ErrNoSource
+	}
+
+	levels := map[int]Level{}
+	for _, level := range wf.Levels {
+		if level.order > 0 {
+			levels[level.order-1] = level
+		}
+	}
+
+	groups := make([]LumpGroup, 0, len(wf.Directory))
+	for i := 0; i < len(wf.Directory); i++ {
+		group := LumpGroup{Lumps: []Lump{}, order: i + 1}
+		count := 1
+		if level, isLevel := levels[i]; isLevel {
+			group.Level = wf.Directory[i].Name
+			count = level.directoryCount
+		}
+
+		for _, entry := range wf.Directory[i : i+count] {
+			data, err := parseLumpData(wf.source, int32(entry.Offset), int32(entry.Size))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", entry.Name, err)
+			}
+			group.Lumps = append(group.Lumps, Lump{Name: entry.Name, Data: data, order: i + 1})
+		}
+
+		groups = append(groups, group)
+		i += count - 1
+	}
+
+	return groups, nil
+}
+
+func (wf WadFile) makeLumpGroups() ([]LumpGroup, error) {
+	groups := make([]LumpGroup, 0, len(wf.Lumps)+len(wf.Levels))
+
+	for _, level := range wf.Levels {
+		groups = append(groups, LumpGroup{Level: level.Slot, Lumps: level.toLumps(), order: level.order})
+	}
+
+	mapInfoLumps := []Lump{}
+	for _, format := range wf.MapInfoFormats {
+		formatLumps, err := wf.makeMapInfoLumps(format)
+		if err != nil {
+			return nil, err
+		}
+		mapInfoLumps = append(mapInfoLumps, formatLumps...)
+	}
+
+	// Generated metadata replaces any lumps of the same name, such as a MAPINFO from the original
+	// file, and takes the place of the first of them
+	replacedOrder := map[string]int{}
+	maps.Copy(replacedOrder, wf.removedLumpOrder)
+	for _, lump := range wf.Lumps {
+		generated := slices.ContainsFunc(mapInfoLumps, func(mapInfoLump Lump) bool {
+			return mapInfoLump.Name == lump.Name
+		})
+		if !generated {
+			groups = append(groups, LumpGroup{Lumps: []Lump{lump}, order: lump.order})
+		} else if _, replaced := replacedOrder[lump.Name]; !replaced && lump.order > 0 {
+			replacedOrder[lump.Name] = lump.order
+		}
+	}
+	for _, lump := range mapInfoLumps {
+		groups = append(groups, LumpGroup{Lumps: []Lump{lump}, order: replacedOrder[lump.Name]})
+	}
+
+	if wf.PreserveOrder {
+		slices.SortStableFunc(groups, func(a LumpGroup, b LumpGroup) int {
+			if a.order == 0 || b.order == 0 {
+				return b.order - a.order
+			}
+			return a.order - b.order
+		})
+	}
+
+	return groups, nil
+}
+
+func (wf WadFile) makeLumps() ([]Lump, error) {
+	groups, err := wf.makeLumpGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	lumps := make([]Lump, 0, len(wf.Lumps)+len(wf.Levels)*11)
+	for _, group := range groups {
+		lumps = append(lumps, group.Lumps...)
+	}
+	return lumps, nil
+}
+
+type countingWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.written += int64(n)
+	return n, err
+}
+
+// Where each lump's data goes in the file and the data to write after the header, including padding
+type fileLayout struct {
+	Header    fileHeader
+	Directory []fileDirectoryEntry
+	Data      [][]byte
+	Stats     WriteStats
+}
+
+type WriteStats struct {
+	Size int64
+
+	// Lump data that wasn't written because an identical lump already was, and zeroes added to
+	// align lumps
+	DuplicateBytes int64
+	PaddingBytes   int64
+}
+
+func (s WriteStats) BytesSaved() int64 {
+	return s.DuplicateBytes - s.PaddingBytes
+}
+
+func makeLayout(identifier string, lumps []Lump, deduplicate bool, alignment int) fileLayout {
+	layout := fileLayout{
+		Directory: make([]fileDirectoryEntry, 0, len(lumps)),
+		Data:      make([][]byte, 0, len(lumps)),
+	}
 
 	offset := SIZE_HEADER
+	offsets := map[[sha256.Size]byte]int{}
 	for _, lump := range lumps {
 		lumpName := [8]byte{}
 		copy(lumpName[:], strToName(lump.Name))
@@ -198,22 +644,66 @@ func makeDirectory(lumps []Lump) []fileDirectoryEntry {
 			LumpName:   lumpName,
 		}
 
-		directory = append(directory, dir)
+		var hash [sha256.Size]byte
+		if deduplicate && lumpSize > 0 {
+			hash = sha256.Sum256(lump.Data)
+			if dataOffset, written := offsets[hash]; written {
+				dir.DataOffset = int32(dataOffset)
+				layout.Directory = append(layout.Directory, dir)
+				layout.Stats.DuplicateBytes += int64(lumpSize)
+				continue
+			}
+		}
+
+		if lumpSize > 0 {
+			offset = layout.pad(offset, alignment)
+			dir.DataOffset = int32(offset)
+			if deduplicate {
+				offsets[hash] = offset
+			}
+		}
+
+		layout.Directory = append(layout.Directory, dir)
+		layout.Data = append(layout.Data, lump.Data)
 		offset += lumpSize
 	}
+	offset = layout.pad(offset, alignment)
+
+	ident := [4]byte{}
+	copy(ident[:], []byte(identifier))
+
+	layout.Header = fileHeader{
+		Identifier:      ident,
+		LumpCount:       int32(len(lumps)),
+		DirectoryOffset: int32(offset),
+	}
+	layout.Stats.Size = int64(offset + len(lumps)*SIZE_DIRECTORY_ENTRY)
 
-	return directory
+	return layout
 }
 
-func makeUMapInfoLump(levelInfos []LevelInfo) Lump {
-	builder := strings.Builder{}
-	for i, levelInfo := range levelInfos {
-		levelSlot := fmt.Sprintf("MAP%02d", i+1)
+// Adds zeroes up to the next multiple of alignment and returns the new offset
+func (layout *fileLayout) pad(offset int, alignment int) int {
+	if alignment <= 1 || offset%alignment == 0 {
+		return offset
+	}
+
+	padding := alignment - offset%alignment
+	layout.Data = append(layout.Data, make([]byte, padding))
+	layout.Stats.PaddingBytes += int64(padding)
+	return offset + padding
+}
 
-		temp := template.Must(template.New("levelinfo").Parse(LEVEL_INFO_TEMPLATE))
+func makeUMapInfoLump(levels []Level) Lump {
+	temp := template.Must(template.New("levelinfo").Funcs(template.FuncMap{
+		"quote":     umapInfoQuote,
+		"quoteList": umapInfoQuoteList,
+	}).Parse(LEVEL_INFO_TEMPLATE))
 
-		builder.WriteString(fmt.Sprintf("MAP %s\n", levelSlot))
-		err := temp.Execute(&builder, levelInfo)
+	builder := strings.Builder{}
+	for _, level := range levels {
+		builder.WriteString(fmt.Sprintf("MAP %s\n", level.Slot))
+		err := temp.Execute(&builder, level.LevelInfo)
 		if err != nil {
 			panic(err)
 		}
@@ -222,7 +712,7 @@ func makeUMapInfoLump(levelInfos []LevelInfo) Lump {
 
 	mapInfoStr := builder.String()
 	return Lump{
-		Name: "UMAPINFO",
+		Name: LUMP_UMAPINFO,
 		Data: []byte(mapInfoStr),
 	}
 }
@@ -237,3 +727,68 @@ func strToName(str string) []byte {
 func nameToStr(name []byte) string {
 	return strings.Trim(string(name), "\x00")
 }
+
+// Keeps the file as <file>.bak. It's hard linked, or copied where links aren't supported, to a
+// temporary name first and renamed from there, so an existing backup is only ever replaced by
+// a complete one.
+func backupFile(path string) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.bak")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+
+	err = temp.Close()
+	if err != nil {
+		return err
+	}
+
+	// The link needs the name to be free
+	err = os.Remove(tempPath)
+	if err != nil {
+		return err
+	}
+	err = os.Link(path, tempPath)
+	if err != nil {
+		err = copyFile(path, tempPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tempPath, path+".bak")
+}
+
+func copyFile(srcPath string, destPath string) error {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	_, err = io.Copy(destFile, srcFile)
+	if err != nil {
+		return err
+	}
+
+	return destFile.Sync()
+}
+
+// Makes the rename of a saved file durable. Not every platform can sync a directory, which only
+// risks the rename being lost in a crash, so that isn't treated as a failure.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+
+	d.Sync()
+}
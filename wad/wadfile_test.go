@@ -0,0 +1,460 @@
+package wad
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Writes the lumps as they are, so levels can be laid out in ways wado wouldn't write them
+func rawWad(t *testing.T, lumps ...Lump) []byte {
+	t.Helper()
+	wf := NewFile("")
+	wf.Lumps = lumps
+	wf.MapInfoFormats = nil
+
+	buf := bytes.Buffer{}
+	_, err := wf.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadWriteToRoundTrip(t *testing.T) {
+	built := testTwoRoomLevel()
+	err := built.BuildNodes()
+	if err != nil {
+		t.Fatalf("BuildNodes() error = %v", err)
+	}
+	err = built.BuildBlockmap(true)
+	if err != nil {
+		t.Fatalf("BuildBlockmap() error = %v", err)
+	}
+	built.BuildReject(false)
+
+	tests := []struct {
+		name  string
+		lumps []Lump
+	}{
+		{name: "built level", lumps: append(built.toLumps(), Lump{Name: "DEMO1", Data: []byte{1, 2, 3}})},
+		{
+			name: "partial records and no node lumps",
+			lumps: []Lump{
+				{Name: "MAP01", Data: []byte{}},
+				{Name: LUMP_THINGS, Data: []byte{0, 0, 0, 0, 0, 0, 1, 0, 7, 0, 0xff, 0xee}},
+				{Name: LUMP_LINEDEFS, Data: Linedefs(built.Linedefs).toLump().Data},
+				{Name: LUMP_SIDEDEFS, Data: Sidedefs(built.Sidedefs).toLump().Data},
+				{Name: LUMP_VERTEXES, Data: append(Vertexes(built.Vertexes).toLump().Data, 9)},
+				{Name: LUMP_SECTORS, Data: Sectors(built.Sectors).toLump().Data},
+				{Name: "MAP02", Data: []byte{}},
+				{Name: LUMP_THINGS, Data: []byte{}},
+				{Name: LUMP_LINEDEFS, Data: []byte{}},
+				{Name: LUMP_SIDEDEFS, Data: []byte{}},
+				{Name: LUMP_VERTEXES, Data: []byte{}},
+				{Name: LUMP_SECTORS, Data: []byte{}},
+				{Name: LUMP_REJECT, Data: []byte{}},
+			},
+		},
+		{
+			name: "hexen level",
+			lumps: []Lump{
+				{Name: "MAP01", Data: []byte{}},
+				{Name: LUMP_THINGS, Data: make([]byte, SIZE_HEXEN_THING+3)},
+				{Name: LUMP_LINEDEFS, Data: make([]byte, SIZE_HEXEN_LINEDEF)},
+				{Name: LUMP_SIDEDEFS, Data: []byte{}},
+				{Name: LUMP_VERTEXES, Data: []byte{}},
+				{Name: LUMP_SECTORS, Data: []byte{}},
+				{Name: LUMP_BEHAVIOR, Data: []byte("ACS\x00")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := rawWad(t, test.lumps...)
+			wf, err := Read(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if len(wf.Levels) == 0 {
+				t.Fatalf("Read() found no levels")
+			}
+			wf.MapInfoFormats = nil
+			wf.PreserveOrder = true
+
+			buf := bytes.Buffer{}
+			_, err = wf.WriteTo(&buf)
+			if err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Errorf("WriteTo(Read()) isn't the WAD that was read:\n%v\nwant\n%v", buf.Bytes(), data)
+			}
+		})
+	}
+}
+
+func TestReadBrokenMaps(t *testing.T) {
+	level := testSquareLevel(256)
+	mapLumps := func(marker string, names ...string) []Lump {
+		lumps := []Lump{{Name: marker, Data: []byte{}}}
+		data := map[string][]byte{
+			LUMP_THINGS:   {},
+			LUMP_LINEDEFS: Linedefs(level.Linedefs).toLump().Data,
+			LUMP_SIDEDEFS: Sidedefs(level.Sidedefs).toLump().Data,
+			LUMP_VERTEXES: Vertexes(level.Vertexes).toLump().Data,
+			LUMP_SECTORS:  Sectors(level.Sectors).toLump().Data,
+			LUMP_TEXTMAP:  []byte("namespace = \"doom\";\n"),
+		}
+		for _, name := range names {
+			lumps = append(lumps, Lump{Name: name, Data: data[name]})
+		}
+		return lumps
+	}
+	good := mapLumps("MAP02", LUMP_THINGS, LUMP_LINEDEFS, LUMP_SIDEDEFS, LUMP_VERTEXES, LUMP_SECTORS)
+
+	tests := []struct {
+		name   string
+		broken []Lump
+		want   error
+	}{
+		{
+			name:   "duplicate lump",
+			broken: mapLumps("MAP01", LUMP_THINGS, LUMP_THINGS, LUMP_LINEDEFS, LUMP_SIDEDEFS, LUMP_VERTEXES, LUMP_SECTORS),
+			want:   ErrDuplicateMapLump,
+		},
+		{
+			name:   "missing lump",
+			broken: mapLumps("MAP01", LUMP_THINGS, LUMP_LINEDEFS, LUMP_SIDEDEFS, LUMP_SECTORS),
+			want:   ErrMissingMapLump,
+		},
+		{
+			name:   "missing ENDMAP",
+			broken: mapLumps("MAP01", LUMP_TEXTMAP),
+			want:   ErrMissingEndMap,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lumps := append(slices.Clone(test.broken), good...)
+			data := rawWad(t, lumps...)
+			wf, err := Read(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+
+			if len(wf.Warnings) != 1 || !errors.Is(wf.Warnings[0], test.want) {
+				t.Errorf("Read() warnings = %v, want %v", wf.Warnings, test.want)
+			}
+			if len(wf.Levels) != 1 || wf.Levels[0].Slot != "MAP02" {
+				t.Errorf("Read() didn't load the map after the broken one")
+			}
+
+			// The broken map is kept as ordinary lumps
+			names := []string{}
+			for _, lump := range wf.Lumps {
+				names = append(names, lump.Name)
+			}
+			want := []string{}
+			for _, lump := range test.broken {
+				want = append(want, lump.Name)
+			}
+			if !slices.Equal(names, want) {
+				t.Errorf("Read() lumps = %v, want %v", names, want)
+			}
+		})
+	}
+}
+
+func TestRebuiltLevelGetsNodeLumps(t *testing.T) {
+	level := testSquareLevel(256)
+	data := rawWad(t,
+		Lump{Name: "MAP01", Data: []byte{}},
+		Lump{Name: LUMP_THINGS, Data: []byte{}},
+		Lump{Name: LUMP_LINEDEFS, Data: Linedefs(level.Linedefs).toLump().Data},
+		Lump{Name: LUMP_SIDEDEFS, Data: Sidedefs(level.Sidedefs).toLump().Data},
+		Lump{Name: LUMP_VERTEXES, Data: append(Vertexes(level.Vertexes).toLump().Data, 1, 2)},
+		Lump{Name: LUMP_SECTORS, Data: Sectors(level.Sectors).toLump().Data},
+	)
+	wf, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	read := &wf.Levels[0]
+	err = read.BuildNodes()
+	if err != nil {
+		t.Fatalf("BuildNodes() error = %v", err)
+	}
+	err = read.BuildBlockmap(true)
+	if err != nil {
+		t.Fatalf("BuildBlockmap() error = %v", err)
+	}
+	read.BuildReject(false)
+
+	names := []string{}
+	for _, lump := range read.toLumps() {
+		names = append(names, lump.Name)
+		if lump.Name == LUMP_VERTEXES && len(lump.Data)%SIZE_VERTEX != 0 {
+			t.Errorf("VERTEXES kept its partial record after the nodes were rebuilt")
+		}
+	}
+	want := []string{"MAP01", LUMP_THINGS, LUMP_LINEDEFS, LUMP_SIDEDEFS, LUMP_VERTEXES, LUMP_SEGMENTS, LUMP_SUBSECTORS, LUMP_NODES, LUMP_SECTORS, LUMP_REJECT, LUMP_BLOCKMAP}
+	if !slices.Equal(names, want) {
+		t.Errorf("toLumps() = %v, want %v", names, want)
+	}
+}
+
+func TestFileLumpGroups(t *testing.T) {
+	data := rawWad(t,
+		Lump{Name: "MAP01", Data: []byte{}},
+		Lump{Name: LUMP_TEXTMAP, Data: []byte("// Comments aren't kept when the TEXTMAP is parsed\nnamespace = \"doom\";\n")},
+		Lump{Name: "ZNODES", Data: []byte{1, 2}},
+		Lump{Name: LUMP_ENDMAP, Data: []byte{}},
+		Lump{Name: LUMP_UMAPINFO, Data: []byte("MAP MAP01 { levelname = \"One\" }")},
+		Lump{Name: "DEMO1", Data: []byte{3}},
+	)
+	wf, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	wf.Levels[0].Slot = "MAP02"
+
+	groups, err := wf.FileLumpGroups()
+	if err != nil {
+		t.Fatalf("FileLumpGroups() error = %v", err)
+	}
+
+	levels, lumps := []string{}, []Lump{}
+	for _, group := range groups {
+		levels = append(levels, group.Level)
+		lumps = append(lumps, group.Lumps...)
+	}
+	if want := []string{"MAP01", "", ""}; !slices.Equal(levels, want) {
+		t.Errorf("FileLumpGroups() levels = %q, want %q", levels, want)
+	}
+	if written := rawWad(t, lumps...); !bytes.Equal(written, data) {
+		t.Errorf("FileLumpGroups() lumps aren't the ones in the file:\n%v\nwant\n%v", written, data)
+	}
+
+	if _, err = NewFile("").FileLumpGroups(); !errors.Is(err, ErrNoSource) {
+		t.Errorf("FileLumpGroups() of a new file error = %v, want %v", err, ErrNoSource)
+	}
+}
+
+func TestMakeLayout(t *testing.T) {
+	lumps := []Lump{
+		{Name: "LUMPA", Data: []byte("hello")},
+		{Name: "LUMPB", Data: []byte("abc")},
+		{Name: "LUMPC", Data: []byte("hello")},
+		{Name: "EMPTY", Data: []byte{}},
+		{Name: "LUMPE", Data: []byte("abc")},
+	}
+
+	tests := []struct {
+		name        string
+		deduplicate bool
+		alignment   int
+		offsets     []int32
+		stats       WriteStats
+		saved       int64
+	}{
+		{
+			name:    "as they are",
+			offsets: []int32{12, 17, 20, 25, 25},
+			stats:   WriteStats{Size: 28 + 5*SIZE_DIRECTORY_ENTRY},
+		},
+		{
+			name:        "deduplicated",
+			deduplicate: true,
+			offsets:     []int32{12, 17, 12, 20, 17},
+			stats:       WriteStats{Size: 20 + 5*SIZE_DIRECTORY_ENTRY, DuplicateBytes: 8},
+			saved:       8,
+		},
+		{
+			name:        "deduplicated and aligned",
+			deduplicate: true,
+			alignment:   4,
+			offsets:     []int32{12, 20, 12, 23, 20},
+			stats:       WriteStats{Size: 24 + 5*SIZE_DIRECTORY_ENTRY, DuplicateBytes: 8, PaddingBytes: 4},
+			saved:       4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout := makeLayout("PWAD", lumps, test.deduplicate, test.alignment)
+			offsets := []int32{}
+			for _, dir := range layout.Directory {
+				offsets = append(offsets, dir.DataOffset)
+			}
+			if !slices.Equal(offsets, test.offsets) {
+				t.Errorf("makeLayout() offsets = %v, want %v", offsets, test.offsets)
+			}
+			if layout.Stats != test.stats {
+				t.Errorf("makeLayout() stats = %+v, want %+v", layout.Stats, test.stats)
+			}
+
+			wf := NewFile("")
+			wf.Lumps = lumps
+			wf.MapInfoFormats = nil
+			wf.Deduplicate = test.deduplicate
+			wf.Alignment = test.alignment
+			buf := bytes.Buffer{}
+			written, err := wf.WriteTo(&buf)
+			if err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if written != test.stats.Size || wf.Stats != test.stats {
+				t.Errorf("WriteTo() wrote %d bytes with stats %+v, want %+v", written, wf.Stats, test.stats)
+			}
+			if wf.Stats.BytesSaved() != test.saved {
+				t.Errorf("BytesSaved() = %d, want %d", wf.Stats.BytesSaved(), test.saved)
+			}
+
+			read, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			for i, lump := range read.Lumps {
+				if lump.Name != lumps[i].Name || !bytes.Equal(lump.Data, lumps[i].Data) {
+					t.Errorf("lump %d = %s %q, want %s %q", i, lump.Name, lump.Data, lumps[i].Name, lumps[i].Data)
+				}
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.wad")
+
+	wf, err := CreateFile(path)
+	if err != nil {
+		t.Fatalf("CreateFile() error = %v", err)
+	}
+	if _, err = os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("CreateFile() created the file, stat error = %v", err)
+	}
+
+	wf.Lumps = []Lump{{Name: "DEMO1", Data: []byte{1}}}
+	err = wf.Save()
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	first := readTestFile(t, path)
+
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf.Lumps = append(wf.Lumps, Lump{Name: "DEMO2", Data: []byte{2}})
+	wf.Backup = true
+	err = wf.Save()
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if backup := readTestFile(t, path+".bak"); !bytes.Equal(backup, first) {
+		t.Errorf("backup isn't the file that was replaced")
+	}
+	saved, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if len(saved.Lumps) != 2 {
+		t.Errorf("saved WAD has %d lumps, want 2", len(saved.Lumps))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("saved WAD mode = %v, want %v", info.Mode().Perm(), fs.FileMode(0600))
+	}
+	checkTestDir(t, dir, "test.wad", "test.wad.bak")
+}
+
+func TestSaveError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.wad")
+	data := rawWad(t, Lump{Name: "DEMO1", Data: []byte{1}})
+	err := os.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lumps of an index-only WAD can't be loaded, so saving it fails
+	wf, err := OpenFileIndex(path)
+	if err != nil {
+		t.Fatalf("OpenFileIndex() error = %v", err)
+	}
+	wf.Backup = true
+	if err = wf.Save(); !errors.Is(err, ErrIndexOnly) {
+		t.Errorf("Save() error = %v, want %v", err, ErrIndexOnly)
+	}
+	if err = wf.SaveAs(filepath.Join(dir, "new.wad")); !errors.Is(err, ErrIndexOnly) {
+		t.Errorf("SaveAs() error = %v, want %v", err, ErrIndexOnly)
+	}
+
+	if saved := readTestFile(t, path); !bytes.Equal(saved, data) {
+		t.Errorf("failed Save() changed the file")
+	}
+	checkTestDir(t, dir, "test.wad")
+}
+
+func TestBackupFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.wad")
+
+	for _, data := range []string{"first", "second"} {
+		err := os.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = backupFile(path)
+		if err != nil {
+			t.Fatalf("backupFile() error = %v", err)
+		}
+		if backup := readTestFile(t, path+".bak"); string(backup) != data {
+			t.Errorf("backup = %q, want %q", backup, data)
+		}
+	}
+
+	if err := backupFile(filepath.Join(dir, "missing.wad")); err == nil {
+		t.Errorf("backupFile() of a missing file error = nil, want an error")
+	}
+	checkTestDir(t, dir, "test.wad", "test.wad.bak")
+}
+
+func readTestFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Checks that nothing, such as a temporary file, was left behind
+func checkTestDir(t *testing.T, dir string, want ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("files = %q, want %q", names, want)
+	}
+}